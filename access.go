@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	libs "administrator/ipfs-node/libs"
+)
+
+// writeAccessError answers a request that was not accepted because of the
+// access of the producer. The ingestion is paused with 403 Forbidden while
+// the account is not allowed.
+func writeAccessError(w http.ResponseWriter, err error) {
+	log.Println(err)
+	if errors.Is(err, libs.ErrNoAccess) {
+		w.WriteHeader(http.StatusForbidden)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	w.Write([]byte(err.Error()))
+}
+
+// AccessStatus returns the cached access of the producer account
+func (myLocalClient localClient) AccessStatus(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(myLocalClient.Access.Status())
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	libs "administrator/ipfs-node/libs"
+	anchor "administrator/ipfs-node/libs/anchor"
+	merkle "administrator/ipfs-node/libs/merkle"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+)
+
+// proofVerification is the body of POST /measurements/verify and its answer
+type proofVerification struct {
+	Root     common.Hash  `json:"root"`
+	Proof    merkle.Proof `json:"proof"`
+	Valid    bool         `json:"valid"`
+	Anchored bool         `json:"anchored"`
+}
+
+// anchorBatch is run by the anchorer at the end of every window. It stores
+// the root of the batch in the Blockchain.
+func (myLocalClient localClient) anchorBatch(batch *anchor.Batch) error {
+	log.Printf("Anchoring a batch of %d measurements\n", len(batch.Entries))
+	return libs.AnchorBatch(libs.ComponentConfig(myLocalClient), batch)
+}
+
+// MeasurementProof returns the inclusion proof of a measurement anchored in
+// a batch and the root that was stored in the Blockchain
+func (myLocalClient localClient) MeasurementProof(w http.ResponseWriter, req *http.Request) {
+	if myLocalClient.Anchorer == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("The anchoring in batches is not enabled"))
+		return
+	}
+
+	hashString := strings.TrimPrefix(strings.ToLower(mux.Vars(req)["hash"]), "0x")
+	hashBytes, err := hex.DecodeString(hashString)
+	if err != nil || len(hashBytes) != 32 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("The hash must be a 32 bytes long hex string"))
+		return
+	}
+
+	record, state := myLocalClient.Anchorer.Lookup(common.BytesToHash(hashBytes))
+	switch state {
+	case anchor.StateAnchored:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(record)
+	case anchor.StatePending:
+		// The proof is known once the batch is anchored
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(measurementStatus{Hash: "0x" + hashString, State: anchor.StatePending})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// VerifyProof checks an inclusion proof against its root and tells whether
+// the root has been anchored in the Blockchain
+func (myLocalClient localClient) VerifyProof(w http.ResponseWriter, req *http.Request) {
+	var verification proofVerification
+	err := json.NewDecoder(req.Body).Decode(&verification)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	verification.Valid, verification.Anchored, err = libs.VerifyAnchoredProof(libs.ComponentConfig(myLocalClient), verification.Root, verification.Proof)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(verification)
+}
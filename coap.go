@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+
+	libs "administrator/ipfs-node/libs"
+	coapLib "administrator/ipfs-node/libs/coapLib"
+	ngsi "administrator/ipfs-node/libs/ngsi"
+	ratelimit "administrator/ipfs-node/libs/ratelimit"
+)
+
+// handleCoAP serves the /notify resource of the CoAP listener. It has the
+// same semantics as the /notify HTTP route: the measurements are stored in
+// the ingestion queue. Confirmable requests are only acknowledged once the
+// measurements have been accepted.
+func (myLocalClient localClient) handleCoAP(addr net.Addr, req *coapLib.Message) (*coapLib.Response, error) {
+	if req.Path() != "notify" {
+		return &coapLib.Response{Code: coapLib.NotFound}, nil
+	}
+	if req.Code != coapLib.POST {
+		return &coapLib.Response{Code: coapLib.MethodNotAllowed}, nil
+	}
+
+	// Convert the localClient to libs.ComponentConfig
+	ethClient := libs.ComponentConfig(myLocalClient)
+
+	// Decode the payload. JSON is assumed if no format is indicated. Signed
+	// payloads are JSON envelopes; CBOR payloads cannot be signed, so they
+	// are refused when the signatures are required.
+	body := make(map[string]interface{})
+	var provenance *ngsi.Provenance
+	var err error
+	format, _ := req.ContentFormat()
+	switch format {
+	case coapLib.FormatJSON:
+		var payload []byte
+		payload, provenance, err = verifyEnvelope(ethClient, req.Payload)
+		if err != nil {
+			return &coapLib.Response{Code: coapLib.Unauthorized, Payload: []byte(err.Error())}, nil
+		}
+		err = json.Unmarshal(payload, &body)
+	case coapLib.FormatCBOR:
+		if ethClient.Config.Get().Sensors.Required {
+			return &coapLib.Response{Code: coapLib.Unauthorized, Payload: []byte("CBOR payloads cannot be signed, send a signed JSON envelope")}, nil
+		}
+		body, err = coapLib.DecodeCBOR(req.Payload)
+	default:
+		return &coapLib.Response{Code: coapLib.UnsupportedContentFormat}, nil
+	}
+	if err != nil {
+		return &coapLib.Response{Code: coapLib.BadRequest, Payload: []byte(err.Error())}, nil
+	}
+
+	// The callers are identified by their IP address
+	caller := addr.String()
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		caller = udpAddr.IP.String()
+	}
+	var limitErr *ratelimit.LimitError
+	if err := ethClient.CallerLimits.Allow(caller); errors.As(err, &limitErr) {
+		return tooManyRequests(limitErr), nil
+	}
+
+	// Check whether the IoT producer has access to the platform
+	err = libs.CheckAccess(ethClient)
+	if errors.Is(err, libs.ErrNoAccess) {
+		return &coapLib.Response{Code: coapLib.Forbidden, Payload: []byte(err.Error())}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = acceptBody(ethClient, body, configuredInputFormat(ethClient), provenance)
+	if errors.As(err, &limitErr) {
+		return tooManyRequests(limitErr), nil
+	}
+	if errors.Is(err, errRejected) {
+		return &coapLib.Response{Code: coapLib.BadRequest, Payload: []byte(err.Error())}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &coapLib.Response{Code: coapLib.Created}, nil
+}
+
+// tooManyRequests answers a request that exceeded a limit. Max-Age tells
+// the client when it may retry.
+func tooManyRequests(limitErr *ratelimit.LimitError) *coapLib.Response {
+	maxAge := uint32(limitErr.RetryAfterSeconds())
+	return &coapLib.Response{Code: coapLib.TooManyRequests, MaxAge: &maxAge, Payload: []byte(limitErr.Error())}
+}
@@ -39,6 +39,15 @@ contract balanceContract is ERC20Basic
     }
 
 
+    // Sets the price of a measurement that the data contract is storing in
+    // the same transaction
+    function setPriceFromDataContract(bytes32 hash, uint256 price) public {
+        require(msg.sender == address(dataContractDef), "Only the data contract can set the price of the data it stores");
+        prices[hash] = price;
+        emit PriceSet(hash, price);
+    }
+
+
     function getPriceMeasurement(bytes32 hash) public view returns(uint256) {
         return prices[hash];
     }
@@ -1,3 +1,14 @@
+# The bindings embed the bytecode of the contracts, so they must be
+# regenerated whenever a contract changes. The contracts are compiled with
+# solc 0.5.16, like the deployed ones.
+set -e
+cd "$(dirname "$0")"
+
+if ! solc --version 2>/dev/null | grep -q "0\.5\.16"; then
+    echo "solc 0.5.16 is required to compile the contracts" >&2
+    exit 1
+fi
+
 # Compile dataContract
 abigen -sol dataContract/data.sol -pkg dataContract --out=dataContract/dataContract.go
 
@@ -5,4 +16,4 @@ abigen -sol dataContract/data.sol -pkg dataContract --out=dataContract/dataContr
 abigen -sol accessContract/accessContract.sol -pkg accessControlContract -out accessContract/accessControlContract.go
 
 # Compile balanceContract
-abigen --sol balanceContract/balance.sol --pkg balanceContract --out balanceContract/balanceContract.go
\ No newline at end of file
+abigen --sol balanceContract/balance.sol --pkg balanceContract --out balanceContract/balanceContract.go
@@ -7,6 +7,12 @@ contract accessControlContract
 }
 
 
+interface balanceContract
+{
+    function setPriceFromDataContract(bytes32 hash, uint256 price) external;
+}
+
+
 contract dataLedgerContract 
 {
     struct dataStruct 
@@ -17,6 +23,7 @@ contract dataLedgerContract
     }
     
     accessControlContract accessContract;
+    balanceContract balanceContractDef;
     
     event evtStoreInfo(bytes32 indexed _hash, string _uri, string _description);
     event deleteInfo(bytes32 indexed _hash);
@@ -42,6 +49,16 @@ contract dataLedgerContract
     }
     
     
+    // Stores information in the blockchain and sets its price in the
+    // balance contract in the same transaction, so a measurement is never
+    // left without a price
+    function storeInfoWithPrice(bytes32 hash, string memory uri, string memory description, uint256 price) public
+    {
+        storeInfo(hash, uri, description);
+        balanceContractDef.setPriceFromDataContract(hash, price);
+    }
+    
+    
 
     
     // Deletes a measurement from the blockchain
@@ -67,6 +84,13 @@ contract dataLedgerContract
         accessContract = accessControlContract(_address);
     }
     
+    // Set the address where the balance contract is stored
+    function setBalanceAddress(address _address) public
+    {
+        require(msg.sender == admin, "You do not have privileges to do this action");
+        balanceContractDef = balanceContract(_address);
+    }
+    
     // Get the value of the mapping
     function checkAccess(address producer) private view returns (bool)
     {
@@ -224,8 +224,179 @@ func (_AccessControlContract *AccessControlContractCallerSession) AllowedAccount
 	return _AccessControlContract.Contract.AllowedAccounts(&_AccessControlContract.CallOpts, arg0)
 }
 
+// BalanceContractABI is the input ABI used to generate the binding from.
+const BalanceContractABI = "[{\"constant\":false,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"hash\",\"type\":\"bytes32\"},{\"internalType\":\"uint256\",\"name\":\"price\",\"type\":\"uint256\"}],\"name\":\"setPriceFromDataContract\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"}]"
+
+// BalanceContractFuncSigs maps the 4-byte function signature to its string representation.
+var BalanceContractFuncSigs = map[string]string{
+	"5da15302": "setPriceFromDataContract(bytes32,uint256)",
+}
+
+// BalanceContract is an auto generated Go binding around an Ethereum contract.
+type BalanceContract struct {
+	BalanceContractCaller     // Read-only binding to the contract
+	BalanceContractTransactor // Write-only binding to the contract
+	BalanceContractFilterer   // Log filterer for contract events
+}
+
+// BalanceContractCaller is an auto generated read-only Go binding around an Ethereum contract.
+type BalanceContractCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// BalanceContractTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type BalanceContractTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// BalanceContractFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type BalanceContractFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// BalanceContractSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type BalanceContractSession struct {
+	Contract     *BalanceContract  // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts     // Call options to use throughout this session
+	TransactOpts bind.TransactOpts // Transaction auth options to use throughout this session
+}
+
+// BalanceContractCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type BalanceContractCallerSession struct {
+	Contract *BalanceContractCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts          // Call options to use throughout this session
+}
+
+// BalanceContractTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type BalanceContractTransactorSession struct {
+	Contract     *BalanceContractTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts          // Transaction auth options to use throughout this session
+}
+
+// BalanceContractRaw is an auto generated low-level Go binding around an Ethereum contract.
+type BalanceContractRaw struct {
+	Contract *BalanceContract // Generic contract binding to access the raw methods on
+}
+
+// BalanceContractCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type BalanceContractCallerRaw struct {
+	Contract *BalanceContractCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// BalanceContractTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type BalanceContractTransactorRaw struct {
+	Contract *BalanceContractTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewBalanceContract creates a new instance of BalanceContract, bound to a specific deployed contract.
+func NewBalanceContract(address common.Address, backend bind.ContractBackend) (*BalanceContract, error) {
+	contract, err := bindBalanceContract(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &BalanceContract{BalanceContractCaller: BalanceContractCaller{contract: contract}, BalanceContractTransactor: BalanceContractTransactor{contract: contract}, BalanceContractFilterer: BalanceContractFilterer{contract: contract}}, nil
+}
+
+// NewBalanceContractCaller creates a new read-only instance of BalanceContract, bound to a specific deployed contract.
+func NewBalanceContractCaller(address common.Address, caller bind.ContractCaller) (*BalanceContractCaller, error) {
+	contract, err := bindBalanceContract(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &BalanceContractCaller{contract: contract}, nil
+}
+
+// NewBalanceContractTransactor creates a new write-only instance of BalanceContract, bound to a specific deployed contract.
+func NewBalanceContractTransactor(address common.Address, transactor bind.ContractTransactor) (*BalanceContractTransactor, error) {
+	contract, err := bindBalanceContract(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &BalanceContractTransactor{contract: contract}, nil
+}
+
+// NewBalanceContractFilterer creates a new log filterer instance of BalanceContract, bound to a specific deployed contract.
+func NewBalanceContractFilterer(address common.Address, filterer bind.ContractFilterer) (*BalanceContractFilterer, error) {
+	contract, err := bindBalanceContract(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &BalanceContractFilterer{contract: contract}, nil
+}
+
+// bindBalanceContract binds a generic wrapper to an already deployed contract.
+func bindBalanceContract(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := abi.JSON(strings.NewReader(BalanceContractABI))
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_BalanceContract *BalanceContractRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _BalanceContract.Contract.BalanceContractCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_BalanceContract *BalanceContractRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _BalanceContract.Contract.BalanceContractTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_BalanceContract *BalanceContractRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _BalanceContract.Contract.BalanceContractTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_BalanceContract *BalanceContractCallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _BalanceContract.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_BalanceContract *BalanceContractTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _BalanceContract.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_BalanceContract *BalanceContractTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _BalanceContract.Contract.contract.Transact(opts, method, params...)
+}
+
+// SetPriceFromDataContract is a paid mutator transaction binding the contract method 0x5da15302.
+//
+// Solidity: function setPriceFromDataContract(bytes32 hash, uint256 price) returns()
+func (_BalanceContract *BalanceContractTransactor) SetPriceFromDataContract(opts *bind.TransactOpts, hash [32]byte, price *big.Int) (*types.Transaction, error) {
+	return _BalanceContract.contract.Transact(opts, "setPriceFromDataContract", hash, price)
+}
+
+// SetPriceFromDataContract is a paid mutator transaction binding the contract method 0x5da15302.
+//
+// Solidity: function setPriceFromDataContract(bytes32 hash, uint256 price) returns()
+func (_BalanceContract *BalanceContractSession) SetPriceFromDataContract(hash [32]byte, price *big.Int) (*types.Transaction, error) {
+	return _BalanceContract.Contract.SetPriceFromDataContract(&_BalanceContract.TransactOpts, hash, price)
+}
+
+// SetPriceFromDataContract is a paid mutator transaction binding the contract method 0x5da15302.
+//
+// Solidity: function setPriceFromDataContract(bytes32 hash, uint256 price) returns()
+func (_BalanceContract *BalanceContractTransactorSession) SetPriceFromDataContract(hash [32]byte, price *big.Int) (*types.Transaction, error) {
+	return _BalanceContract.Contract.SetPriceFromDataContract(&_BalanceContract.TransactOpts, hash, price)
+}
+
 // DataLedgerContractABI is the input ABI used to generate the binding from.
-const DataLedgerContractABI = "[{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"bytes32\",\"name\":\"_hash\",\"type\":\"bytes32\"}],\"name\":\"deleteInfo\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"bytes32\",\"name\":\"_hash\",\"type\":\"bytes32\"},{\"indexed\":false,\"internalType\":\"string\",\"name\":\"_uri\",\"type\":\"string\"},{\"indexed\":false,\"internalType\":\"string\",\"name\":\"_description\",\"type\":\"string\"}],\"name\":\"evtStoreInfo\",\"type\":\"event\"},{\"constant\":false,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"hash\",\"type\":\"bytes32\"}],\"name\":\"deleteMeasurement\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"hash\",\"type\":\"bytes32\"}],\"name\":\"getIoTAddress\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"}],\"name\":\"ledger\",\"outputs\":[{\"internalType\":\"string\",\"name\":\"uri\",\"type\":\"string\"},{\"internalType\":\"string\",\"name\":\"description\",\"type\":\"string\"},{\"internalType\":\"address\",\"name\":\"addr\",\"type\":\"address\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[{\"internalType\":\"address\",\"name\":\"_address\",\"type\":\"address\"}],\"name\":\"setAddress\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"hash\",\"type\":\"bytes32\"},{\"internalType\":\"string\",\"name\":\"uri\",\"type\":\"string\"},{\"internalType\":\"string\",\"name\":\"description\",\"type\":\"string\"}],\"name\":\"storeInfo\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"}]"
+const DataLedgerContractABI = "[{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"bytes32\",\"name\":\"_hash\",\"type\":\"bytes32\"}],\"name\":\"deleteInfo\",\"type\":\"event\"},{\"anonymous\":false,\"inputs\":[{\"indexed\":true,\"internalType\":\"bytes32\",\"name\":\"_hash\",\"type\":\"bytes32\"},{\"indexed\":false,\"internalType\":\"string\",\"name\":\"_uri\",\"type\":\"string\"},{\"indexed\":false,\"internalType\":\"string\",\"name\":\"_description\",\"type\":\"string\"}],\"name\":\"evtStoreInfo\",\"type\":\"event\"},{\"constant\":false,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"hash\",\"type\":\"bytes32\"}],\"name\":\"deleteMeasurement\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"hash\",\"type\":\"bytes32\"}],\"name\":\"getIoTAddress\",\"outputs\":[{\"internalType\":\"address\",\"name\":\"\",\"type\":\"address\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":true,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"\",\"type\":\"bytes32\"}],\"name\":\"ledger\",\"outputs\":[{\"internalType\":\"string\",\"name\":\"uri\",\"type\":\"string\"},{\"internalType\":\"string\",\"name\":\"description\",\"type\":\"string\"},{\"internalType\":\"address\",\"name\":\"addr\",\"type\":\"address\"}],\"payable\":false,\"stateMutability\":\"view\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[{\"internalType\":\"address\",\"name\":\"_address\",\"type\":\"address\"}],\"name\":\"setAddress\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[{\"internalType\":\"address\",\"name\":\"_address\",\"type\":\"address\"}],\"name\":\"setBalanceAddress\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"hash\",\"type\":\"bytes32\"},{\"internalType\":\"string\",\"name\":\"uri\",\"type\":\"string\"},{\"internalType\":\"string\",\"name\":\"description\",\"type\":\"string\"}],\"name\":\"storeInfo\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"},{\"constant\":false,\"inputs\":[{\"internalType\":\"bytes32\",\"name\":\"hash\",\"type\":\"bytes32\"},{\"internalType\":\"string\",\"name\":\"uri\",\"type\":\"string\"},{\"internalType\":\"string\",\"name\":\"description\",\"type\":\"string\"},{\"internalType\":\"uint256\",\"name\":\"price\",\"type\":\"uint256\"}],\"name\":\"storeInfoWithPrice\",\"outputs\":[],\"payable\":false,\"stateMutability\":\"nonpayable\",\"type\":\"function\"}]"
 
 // DataLedgerContractFuncSigs maps the 4-byte function signature to its string representation.
 var DataLedgerContractFuncSigs = map[string]string{
@@ -233,7 +404,9 @@ var DataLedgerContractFuncSigs = map[string]string{
 	"6ade0219": "getIoTAddress(bytes32)",
 	"15977d45": "ledger(bytes32)",
 	"e30081a0": "setAddress(address)",
+	"aeaf65e3": "setBalanceAddress(address)",
 	"b7e2a1b8": "storeInfo(bytes32,string,string)",
+	"2c6079f2": "storeInfoWithPrice(bytes32,string,string,uint256)",
 }
 
 // DataLedgerContractBin is the compiled bytecode used for deploying new contracts.
@@ -515,6 +688,27 @@ func (_DataLedgerContract *DataLedgerContractTransactorSession) SetAddress(_addr
 	return _DataLedgerContract.Contract.SetAddress(&_DataLedgerContract.TransactOpts, _address)
 }
 
+// SetBalanceAddress is a paid mutator transaction binding the contract method 0xaeaf65e3.
+//
+// Solidity: function setBalanceAddress(address _address) returns()
+func (_DataLedgerContract *DataLedgerContractTransactor) SetBalanceAddress(opts *bind.TransactOpts, _address common.Address) (*types.Transaction, error) {
+	return _DataLedgerContract.contract.Transact(opts, "setBalanceAddress", _address)
+}
+
+// SetBalanceAddress is a paid mutator transaction binding the contract method 0xaeaf65e3.
+//
+// Solidity: function setBalanceAddress(address _address) returns()
+func (_DataLedgerContract *DataLedgerContractSession) SetBalanceAddress(_address common.Address) (*types.Transaction, error) {
+	return _DataLedgerContract.Contract.SetBalanceAddress(&_DataLedgerContract.TransactOpts, _address)
+}
+
+// SetBalanceAddress is a paid mutator transaction binding the contract method 0xaeaf65e3.
+//
+// Solidity: function setBalanceAddress(address _address) returns()
+func (_DataLedgerContract *DataLedgerContractTransactorSession) SetBalanceAddress(_address common.Address) (*types.Transaction, error) {
+	return _DataLedgerContract.Contract.SetBalanceAddress(&_DataLedgerContract.TransactOpts, _address)
+}
+
 // StoreInfo is a paid mutator transaction binding the contract method 0xb7e2a1b8.
 //
 // Solidity: function storeInfo(bytes32 hash, string uri, string description) returns()
@@ -536,6 +730,27 @@ func (_DataLedgerContract *DataLedgerContractTransactorSession) StoreInfo(hash [
 	return _DataLedgerContract.Contract.StoreInfo(&_DataLedgerContract.TransactOpts, hash, uri, description)
 }
 
+// StoreInfoWithPrice is a paid mutator transaction binding the contract method 0x2c6079f2.
+//
+// Solidity: function storeInfoWithPrice(bytes32 hash, string uri, string description, uint256 price) returns()
+func (_DataLedgerContract *DataLedgerContractTransactor) StoreInfoWithPrice(opts *bind.TransactOpts, hash [32]byte, uri string, description string, price *big.Int) (*types.Transaction, error) {
+	return _DataLedgerContract.contract.Transact(opts, "storeInfoWithPrice", hash, uri, description, price)
+}
+
+// StoreInfoWithPrice is a paid mutator transaction binding the contract method 0x2c6079f2.
+//
+// Solidity: function storeInfoWithPrice(bytes32 hash, string uri, string description, uint256 price) returns()
+func (_DataLedgerContract *DataLedgerContractSession) StoreInfoWithPrice(hash [32]byte, uri string, description string, price *big.Int) (*types.Transaction, error) {
+	return _DataLedgerContract.Contract.StoreInfoWithPrice(&_DataLedgerContract.TransactOpts, hash, uri, description, price)
+}
+
+// StoreInfoWithPrice is a paid mutator transaction binding the contract method 0x2c6079f2.
+//
+// Solidity: function storeInfoWithPrice(bytes32 hash, string uri, string description, uint256 price) returns()
+func (_DataLedgerContract *DataLedgerContractTransactorSession) StoreInfoWithPrice(hash [32]byte, uri string, description string, price *big.Int) (*types.Transaction, error) {
+	return _DataLedgerContract.Contract.StoreInfoWithPrice(&_DataLedgerContract.TransactOpts, hash, uri, description, price)
+}
+
 // DataLedgerContractDeleteInfoIterator is returned from FilterDeleteInfo and is used to iterate over the raw logs and unpacked data for DeleteInfo events raised by the DataLedgerContract contract.
 type DataLedgerContractDeleteInfoIterator struct {
 	Event *DataLedgerContractDeleteInfo // Event containing the contract specifics and raw log
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// EthereumStatus returns the state of the RPC endpoints of the Ethereum
+// network
+func (myLocalClient localClient) EthereumStatus(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(myLocalClient.EthereumClient.Status())
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	libs "administrator/ipfs-node/libs"
+	ngsi "administrator/ipfs-node/libs/ngsi"
+	queue "administrator/ipfs-node/libs/queue"
+	ratelimit "administrator/ipfs-node/libs/ratelimit"
+	transactions "administrator/ipfs-node/libs/transactions"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gorilla/mux"
+)
+
+// enqueueEntity normalizes an entity and stores it in the ingestion queue.
+// The provenance, if any, is kept with the measurement.
+func enqueueEntity(ethClient libs.ComponentConfig, entity map[string]interface{}, format string, provenance *ngsi.Provenance) entityResult {
+	result := entityResult{}
+	result.ID, _ = entity["id"].(string)
+
+	// Convert the entity to the canonical measurement model
+	measurement, err := ngsi.Normalize(entity, format)
+	if err != nil {
+		log.Println(err)
+		result.Status = entityRejected
+		result.Error = err.Error()
+		return result
+	}
+	measurement.Provenance = provenance
+
+	job, err := enqueueMeasurement(ethClient, measurement)
+	var limitErr *ratelimit.LimitError
+	if errors.As(err, &limitErr) {
+		log.Println(err)
+		result.Status = entityThrottled
+		result.Error = err.Error()
+		return result
+	}
+	if err != nil {
+		log.Println(err)
+		result.Status = entityRejected
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = entityAccepted
+	result.JobID = job.ID
+	result.Hash = "0x" + job.Key
+	return result
+}
+
+// errRejected is wrapped by acceptBody when a body can never be accepted
+var errRejected = errors.New("The measurement has been rejected")
+
+// acceptBody stores the entities of a decoded body, either a single entity
+// or a notification, in the ingestion queue. It is used by the listeners
+// that cannot report the outcome of every entity: entities that are not
+// valid or not bound to the sensor that signed the body are logged and
+// dropped. A *ratelimit.LimitError is returned if a sensor exceeded its
+// limits.
+func acceptBody(ethClient libs.ComponentConfig, body map[string]interface{}, format string, provenance *ngsi.Provenance) error {
+	entities := []map[string]interface{}{body}
+	if notification, ok := ngsi.ParseNotification(body); ok {
+		entities = notification.Data
+	}
+
+	accepted := 0
+	for _, entity := range entities {
+		measurement, err := ngsi.Normalize(entity, format)
+		if err != nil {
+			log.Printf("Dropping invalid entity: %v\n", err)
+			continue
+		}
+		measurement.Provenance = provenance
+
+		job, err := enqueueMeasurement(ethClient, measurement)
+		if isSensorError(err) {
+			log.Printf("Dropping entity: %v\n", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Measurement %s queued as job %s\n", measurement.ID, job.ID)
+		accepted++
+	}
+
+	if accepted == 0 {
+		return fmt.Errorf("%w: the body does not contain valid entities", errRejected)
+	}
+	return nil
+}
+
+// enqueueMeasurement stores a normalized measurement in the ingestion queue.
+// The job is keyed by the hash of the measurement. A measurement that is
+// already queued, e.g. by an earlier delivery of the same message, is not
+// queued again nor counted against the limits of its sensor, unless both
+// deliveries arrive at the same time: then both are counted but only one is
+// queued. A *ratelimit.LimitError is returned if the sensor exceeded its
+// limits.
+func enqueueMeasurement(ethClient libs.ComponentConfig, measurement *ngsi.Measurement) (*queue.Job, error) {
+	err := authorizeSensor(ethClient, measurement)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := libs.MeasurementHash(measurement)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%x", hash)
+
+	if job, ok := ethClient.Queue.GetByKey(key); ok && job.State != queue.StateFailed {
+		return job, nil
+	}
+
+	err = ethClient.SensorLimits.Allow(measurement.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signed body is stored once for all its measurements, which only
+	// reference it
+	err = libs.StoreSignedBody(ethClient, measurement.Provenance)
+	if err != nil {
+		return nil, err
+	}
+
+	job, _, err := ethClient.Queue.EnqueueUnique(key, measurement)
+	return job, err
+}
+
+// processJob is run by the workers of the ingestion queue. It stores the
+// queued measurement in the platform. The jobs that fail because of the
+// node, IPFS or a transaction not confirmed in time are attempted again;
+// those whose transactions revert are not.
+func (myLocalClient localClient) processJob(payload json.RawMessage) (interface{}, error) {
+	measurement := &ngsi.Measurement{}
+	err := json.Unmarshal(payload, measurement)
+	if err != nil {
+		return nil, queue.Permanent(err)
+	}
+
+	log.Printf("Processing Measurement %s\n", measurement.ID)
+	result, err := processMeasurement(libs.ComponentConfig(myLocalClient), measurement)
+	if transactions.IsRevert(err) {
+		return result, queue.Permanent(err)
+	}
+	return result, err
+}
+
+// settledTransaction updates the job of a measurement whose transaction was
+// not confirmed in time but was settled later. The transactions are keyed
+// by their kind and the hash of the measurement, which is the key of the
+// job. If only the measurement was stored, the job is queued again to set
+// its price.
+func (myLocalClient localClient) settledTransaction(key string, tx *types.Transaction, receipt *types.Receipt, err error) {
+	if err != nil {
+		log.Printf("The transaction submitted for %s was not confirmed: %v\n", key, err)
+		return
+	}
+	log.Printf("The transaction %s submitted for %s was confirmed\n", tx.Hash().Hex(), key)
+
+	kind := strings.SplitN(key, ":", 2)
+	if len(kind) != 2 {
+		return
+	}
+	job, ok := myLocalClient.Queue.GetByKey(kind[1])
+	if !ok || job.State != queue.StateFailed {
+		// The job is still being processed and waits for the transaction
+		return
+	}
+
+	switch kind[0] {
+	case "store":
+		err = myLocalClient.Queue.Retry(job.ID)
+	case "store-with-price", "price":
+		result := entityResult{}
+		json.Unmarshal(job.Result, &result)
+		if kind[0] == "store-with-price" {
+			result.TxHash = tx.Hash().Hex()
+		}
+		result.PriceTxHash = tx.Hash().Hex()
+		result.GasUsed += receipt.GasUsed
+		result.Status = entityStored
+		result.Error = ""
+		err = myLocalClient.Queue.Complete(job.ID, result)
+		if err == nil {
+			myLocalClient.recordMeasurement(job)
+		}
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("Could not update the job %s: %v\n", job.ID, err)
+	}
+}
+
+// recordMeasurement records the measurement of a job completed after its
+// transaction was settled in the revenue index
+func (myLocalClient localClient) recordMeasurement(job *queue.Job) {
+	if myLocalClient.Revenue == nil {
+		return
+	}
+
+	measurement := &ngsi.Measurement{}
+	hash, err := libs.HexStringToBytes32(job.Key)
+	if err == nil {
+		err = json.Unmarshal(job.Payload, measurement)
+	}
+	if err == nil {
+		err = myLocalClient.Revenue.RecordMeasurement(hash, measurement.ID, measurement.Type)
+	}
+	if err != nil {
+		log.Printf("Could not record the measurement of job %s in the revenue index: %v\n", job.ID, err)
+	}
+}
+
+// JobStatus returns the state of a job of the ingestion queue
+func (myLocalClient localClient) JobStatus(w http.ResponseWriter, req *http.Request) {
+	job, ok := myLocalClient.Queue.Get(mux.Vars(req)["id"])
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,292 @@
+// Package accesscache caches the state of the access control contract that
+// is checked for every measurement: whether the account of the producer is
+// allowed and the public key of the administrator. The cache is kept fresh
+// by the events of the contract and resynchronized periodically, so it
+// also recovers from missed events and changes that emit none.
+package accesscache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	accessControlContract "administrator/ipfs-node/contracts/accessContract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// ErrNotLoaded is returned when the state of the contract has not been read
+// yet
+var ErrNotLoaded = errors.New("The state of the access control contract has not been read yet")
+
+// Config is the configuration of the cache. The state of the contract is
+// read again every Resync seconds.
+type Config struct {
+	Resync int `json:"resync"`
+}
+
+// Contract is the part of the access control contract that is cached
+type Contract interface {
+	AllowedAccounts(opts *bind.CallOpts, arg0 common.Address) (bool, error)
+	AdminPublicKey(opts *bind.CallOpts) (string, error)
+	WatchNewAddrRegistered(opts *bind.WatchOpts, sink chan<- *accessControlContract.AccessControlContractNewAddrRegistered, _addr []common.Address) (event.Subscription, error)
+	WatchNewAddrRemove(opts *bind.WatchOpts, sink chan<- *accessControlContract.AccessControlContractNewAddrRemove, _addr []common.Address) (event.Subscription, error)
+}
+
+// Status is the state of the cache
+type Status struct {
+	Allowed    bool      `json:"allowed"`
+	Subscribed bool      `json:"subscribed"`
+	LastSync   time.Time `json:"lastSync"`
+}
+
+// Cache caches the access of an account and the public key of the
+// administrator
+type Cache struct {
+	contract Contract
+	account  common.Address
+	resync   time.Duration
+
+	mu         sync.RWMutex
+	loaded     bool
+	allowed    bool
+	adminKey   string
+	subscribed bool
+	lastSync   time.Time
+	notify     func(allowed bool)
+
+	// The subscriptions are only used by Start and the watch goroutine
+	registered chan *accessControlContract.AccessControlContractNewAddrRegistered
+	removed    chan *accessControlContract.AccessControlContractNewAddrRemove
+	subs       []event.Subscription
+	subErr     <-chan error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates the cache of the access of account to the contract
+func New(contract Contract, account common.Address, config Config) *Cache {
+	return &Cache{
+		contract: contract,
+		account:  account,
+		resync:   time.Duration(config.Resync) * time.Second,
+
+		registered: make(chan *accessControlContract.AccessControlContractNewAddrRegistered),
+		removed:    make(chan *accessControlContract.AccessControlContractNewAddrRemove),
+
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Start reads the state of the contract, subscribes to its events and
+// keeps the cache fresh in background until Stop is called
+func (c *Cache) Start() error {
+	err := c.Sync(context.Background())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.subscribe(ctx)
+	go c.watch(ctx, cancel)
+	return nil
+}
+
+// Stop stops keeping the cache fresh
+func (c *Cache) Stop() {
+	close(c.stop)
+	<-c.done
+}
+
+// Allowed tells whether the account has access to the marketplace
+func (c *Cache) Allowed() (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.loaded {
+		return false, ErrNotLoaded
+	}
+	return c.allowed, nil
+}
+
+// Notify registers f to be called with the access of the account once it
+// is known and every time it changes. f is called with the cache locked, so
+// it must not use the cache.
+func (c *Cache) Notify(f func(allowed bool)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notify = f
+	if c.loaded {
+		f(c.allowed)
+	}
+}
+
+// AdminPublicKey returns the public key of the administrator, hex encoded
+func (c *Cache) AdminPublicKey() (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.loaded {
+		return "", ErrNotLoaded
+	}
+	return c.adminKey, nil
+}
+
+// Status returns the state of the cache
+func (c *Cache) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return Status{Allowed: c.allowed, Subscribed: c.subscribed, LastSync: c.lastSync}
+}
+
+// Sync reads the state of the contract
+func (c *Cache) Sync(ctx context.Context) error {
+	opts := &bind.CallOpts{Context: ctx}
+	allowed, err := c.contract.AllowedAccounts(opts, c.account)
+	if err != nil {
+		return err
+	}
+
+	adminKey, err := c.contract.AdminPublicKey(opts)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.change(allowed)
+	c.loaded = true
+	c.allowed = allowed
+	c.adminKey = adminKey
+	c.lastSync = time.Now().UTC()
+	return nil
+}
+
+// setAllowed applies an event of the contract
+func (c *Cache) setAllowed(allowed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.change(allowed)
+	c.allowed = allowed
+}
+
+// change logs a change of the access of the account and notifies it. The
+// caller must hold the lock.
+func (c *Cache) change(allowed bool) {
+	if c.loaded && allowed == c.allowed {
+		return
+	}
+	if c.notify != nil {
+		c.notify(allowed)
+	}
+	if !c.loaded {
+		return
+	}
+	if allowed {
+		log.Printf("The account %s has been granted access to the marketplace, ingestion resumed\n", c.account.Hex())
+	} else {
+		log.Printf("The account %s has been removed from the marketplace, ingestion paused\n", c.account.Hex())
+	}
+}
+
+// setSubscribed records whether the events of the contract are received
+func (c *Cache) setSubscribed(subscribed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribed = subscribed
+}
+
+// subscribe subscribes to the events of the contract about the account
+func (c *Cache) subscribe(ctx context.Context) {
+	opts := &bind.WatchOpts{Context: ctx}
+	filter := []common.Address{c.account}
+
+	registeredSub, err := c.contract.WatchNewAddrRegistered(opts, c.registered, filter)
+	if err != nil {
+		log.Printf("Could not subscribe to the events of the access control contract: %v\n", err)
+		return
+	}
+	removedSub, err := c.contract.WatchNewAddrRemove(opts, c.removed, filter)
+	if err != nil {
+		registeredSub.Unsubscribe()
+		log.Printf("Could not subscribe to the events of the access control contract: %v\n", err)
+		return
+	}
+
+	c.subs = []event.Subscription{registeredSub, removedSub}
+	errs := make(chan error, len(c.subs))
+	for _, sub := range c.subs {
+		go func(sub event.Subscription) {
+			if err, ok := <-sub.Err(); ok && err != nil {
+				errs <- err
+			}
+		}(sub)
+	}
+	c.subErr = errs
+	c.setSubscribed(true)
+}
+
+// unsubscribe ends the subscriptions to the events of the contract
+func (c *Cache) unsubscribe() {
+	for _, sub := range c.subs {
+		sub.Unsubscribe()
+	}
+	c.subs, c.subErr = nil, nil
+	c.setSubscribed(false)
+}
+
+// watch applies the events of the contract and resynchronizes the cache
+// periodically. If the events cannot be subscribed to, they are
+// subscribed to again at the next resynchronization.
+func (c *Cache) watch(ctx context.Context, cancel context.CancelFunc) {
+	defer close(c.done)
+	defer cancel()
+	defer c.unsubscribe()
+
+	ticker := time.NewTicker(c.resync)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+
+		case e := <-c.registered:
+			// A log removed by a reorganization is fixed by a resync
+			if e.Raw.Removed {
+				c.resyncNow(ctx)
+			} else {
+				c.setAllowed(true)
+			}
+
+		case e := <-c.removed:
+			if e.Raw.Removed {
+				c.resyncNow(ctx)
+			} else {
+				c.setAllowed(false)
+			}
+
+		case err := <-c.subErr:
+			log.Printf("The subscription to the access control contract ended: %v\n", err)
+			c.unsubscribe()
+
+		case <-ticker.C:
+			if c.subs == nil {
+				c.subscribe(ctx)
+			}
+			c.resyncNow(ctx)
+		}
+	}
+}
+
+// resyncNow reads the state of the contract, logging the errors
+func (c *Cache) resyncNow(ctx context.Context) {
+	err := c.Sync(ctx)
+	if err != nil {
+		log.Printf("Could not read the state of the access control contract: %v\n", err)
+	}
+}
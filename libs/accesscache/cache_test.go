@@ -0,0 +1,167 @@
+package accesscache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	accessControlContract "administrator/ipfs-node/contracts/accessContract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// contract is an access control contract that counts the calls
+type contract struct {
+	mu       sync.Mutex
+	allowed  bool
+	adminKey string
+	calls    int
+	noEvents bool
+
+	registered event.Feed
+	removed    event.Feed
+}
+
+func (c *contract) AllowedAccounts(opts *bind.CallOpts, arg0 common.Address) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return c.allowed, nil
+}
+
+func (c *contract) AdminPublicKey(opts *bind.CallOpts) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return c.adminKey, nil
+}
+
+func (c *contract) WatchNewAddrRegistered(opts *bind.WatchOpts, sink chan<- *accessControlContract.AccessControlContractNewAddrRegistered, _addr []common.Address) (event.Subscription, error) {
+	if c.noEvents {
+		return nil, errors.New("notifications not supported")
+	}
+	return c.registered.Subscribe(sink), nil
+}
+
+func (c *contract) WatchNewAddrRemove(opts *bind.WatchOpts, sink chan<- *accessControlContract.AccessControlContractNewAddrRemove, _addr []common.Address) (event.Subscription, error) {
+	if c.noEvents {
+		return nil, errors.New("notifications not supported")
+	}
+	return c.removed.Subscribe(sink), nil
+}
+
+// set changes the state of the contract without emitting events
+func (c *contract) set(allowed bool, adminKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.allowed = allowed
+	c.adminKey = adminKey
+}
+
+func (c *contract) callCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// eventually waits until the cache reports allowed
+func eventually(t *testing.T, cache *Cache, allowed bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if ok, _ := cache.Allowed(); ok == allowed {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("the cache did not report allowed=%t", allowed)
+}
+
+func TestEventsUpdateTheCache(t *testing.T) {
+	c := &contract{allowed: true, adminKey: "04ab"}
+	cache := New(c, common.HexToAddress("0x1"), Config{Resync: 3600})
+	if err := cache.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Stop()
+
+	calls := c.callCount()
+	for i := 0; i < 10; i++ {
+		if ok, err := cache.Allowed(); !ok || err != nil {
+			t.Fatalf("unexpected access %t, %v", ok, err)
+		}
+		if key, _ := cache.AdminPublicKey(); key != "04ab" {
+			t.Fatalf("unexpected key %q", key)
+		}
+	}
+	if c.callCount() != calls {
+		t.Error("the cached values were read from the contract")
+	}
+
+	c.removed.Send(&accessControlContract.AccessControlContractNewAddrRemove{})
+	eventually(t, cache, false)
+
+	c.registered.Send(&accessControlContract.AccessControlContractNewAddrRegistered{})
+	eventually(t, cache, true)
+}
+
+func TestNotify(t *testing.T) {
+	c := &contract{allowed: true}
+	cache := New(c, common.HexToAddress("0x1"), Config{Resync: 3600})
+	if err := cache.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Stop()
+
+	changes := make(chan bool, 3)
+	cache.Notify(func(allowed bool) { changes <- allowed })
+
+	c.removed.Send(&accessControlContract.AccessControlContractNewAddrRemove{})
+	eventually(t, cache, false)
+	c.removed.Send(&accessControlContract.AccessControlContractNewAddrRemove{})
+	c.registered.Send(&accessControlContract.AccessControlContractNewAddrRegistered{})
+	eventually(t, cache, true)
+
+	for _, expected := range []bool{true, false, true} {
+		if allowed := <-changes; allowed != expected {
+			t.Fatalf("expected a notification of allowed=%t", expected)
+		}
+	}
+	if len(changes) != 0 {
+		t.Error("a notification was sent without a change")
+	}
+}
+
+func TestResync(t *testing.T) {
+	c := &contract{allowed: true, noEvents: true}
+	cache := New(c, common.HexToAddress("0x1"), Config{Resync: 1})
+	if err := cache.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Stop()
+
+	if cache.Status().Subscribed {
+		t.Error("the cache reports a subscription")
+	}
+
+	c.set(false, "04cd")
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if key, _ := cache.AdminPublicKey(); key == "04cd" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ok, _ := cache.Allowed(); ok {
+		t.Error("the removal was not picked up by the resync")
+	}
+}
+
+func TestNotLoaded(t *testing.T) {
+	cache := New(&contract{}, common.Address{}, Config{Resync: 1})
+	if _, err := cache.Allowed(); err != ErrNotLoaded {
+		t.Errorf("expected ErrNotLoaded, got %v", err)
+	}
+}
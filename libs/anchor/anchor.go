@@ -0,0 +1,409 @@
+// Package anchor collects the measurements to be stored over a window and
+// anchors them in batches: the measurements of a batch are the leaves of a
+// Merkle tree and only its root is stored in the Blockchain. The inclusion
+// proofs of the measurements are kept on disk, so they can be handed to the
+// buyers and verified against the anchored root.
+package anchor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	merkle "administrator/ipfs-node/libs/merkle"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// States of a measurement
+const (
+	StatePending  = "pending"
+	StateAnchored = "anchored"
+)
+
+// pendingFile is the file where the measurements waiting for their batch
+// are stored
+const pendingFile = "pending.json"
+
+// batchPrefix is the prefix of the files of the anchored batches
+const batchPrefix = "batch-"
+
+// ErrDuplicate is returned when a measurement is already pending or anchored
+var ErrDuplicate = errors.New("The measurement is already pending or anchored")
+
+// Config is the configuration of the batched anchoring. When it is enabled,
+// the measurements are anchored every Window seconds, or as soon as MaxSize
+// of them are pending. The batches are stored in the folder Path.
+type Config struct {
+	Enabled bool   `json:"enabled"`
+	Window  int    `json:"window"`
+	MaxSize int    `json:"maxSize"`
+	Path    string `json:"path"`
+}
+
+// Entry is a measurement waiting to be anchored, with the record that would
+// be stored in the Blockchain for it on its own. Sensor and Type are the
+// entity of the measurement.
+type Entry struct {
+	Hash         common.Hash `json:"hash"`
+	Description  string      `json:"description"`
+	EncryptedURL string      `json:"encryptedUrl"`
+	Price        int64       `json:"price"`
+	Sensor       string      `json:"sensor,omitempty"`
+	Type         string      `json:"type,omitempty"`
+}
+
+// Batch is a set of measurements anchored by the root of their Merkle tree.
+// Proofs[i] is the inclusion proof of Entries[i]. The fields after Price are
+// set by the AnchorFunc.
+type Batch struct {
+	Root        common.Hash    `json:"root"`
+	Entries     []Entry        `json:"entries"`
+	Proofs      []merkle.Proof `json:"proofs"`
+	Price       int64          `json:"price"`
+	ManifestCID string         `json:"manifestCid"`
+	TxHash      common.Hash    `json:"txHash"`
+	PriceTxHash common.Hash    `json:"priceTxHash"`
+	GasUsed     uint64         `json:"gasUsed"`
+	AnchoredAt  time.Time      `json:"anchoredAt"`
+}
+
+// Record is the anchoring record of a measurement
+type Record struct {
+	Root        common.Hash  `json:"root"`
+	Proof       merkle.Proof `json:"proof"`
+	ManifestCID string       `json:"manifestCid"`
+	TxHash      common.Hash  `json:"txHash"`
+	AnchoredAt  time.Time    `json:"anchoredAt"`
+}
+
+// AnchorFunc stores the root of a batch in the Blockchain and fills the
+// fields of the batch that describe where it has been stored. If an error
+// is returned, the measurements of the batch stay pending.
+type AnchorFunc func(batch *Batch) error
+
+// Anchorer collects the measurements and anchors them in batches
+type Anchorer struct {
+	dir     string
+	window  time.Duration
+	maxSize int
+
+	// flushMu makes sure a single batch is anchored at a time
+	flushMu sync.Mutex
+
+	mu       sync.Mutex
+	pending  []Entry
+	known    map[common.Hash]bool
+	anchored map[common.Hash]*Batch
+
+	full chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open opens the batches stored in the folder of the configuration,
+// creating it if required. The measurements that were pending when the
+// process stopped are anchored in the next batch.
+func Open(config Config) (*Anchorer, error) {
+	if err := os.MkdirAll(config.Path, 0700); err != nil {
+		return nil, err
+	}
+
+	a := &Anchorer{
+		dir:      config.Path,
+		window:   time.Duration(config.Window) * time.Second,
+		maxSize:  config.MaxSize,
+		known:    make(map[common.Hash]bool),
+		anchored: make(map[common.Hash]*Batch),
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+
+	files, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), batchPrefix) || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		batch := &Batch{}
+		if err := a.read(f.Name(), batch); err != nil {
+			log.Printf("Skipping corrupted batch %s: %v\n", f.Name(), err)
+			continue
+		}
+		a.index(batch)
+	}
+
+	var pending []Entry
+	if err := a.read(pendingFile, &pending); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// The measurements of a batch that was stored right before the process
+	// stopped may still be in the pending file
+	for _, entry := range pending {
+		if !a.known[entry.Hash] {
+			a.known[entry.Hash] = true
+			a.pending = append(a.pending, entry)
+		}
+	}
+
+	if len(a.pending) > 0 {
+		log.Printf("Recovered %d measurements waiting to be anchored from %s\n", len(a.pending), a.dir)
+	}
+
+	return a, nil
+}
+
+// Add stores a measurement until it is anchored in the next batch. The
+// measurement has been persisted when this function returns without error.
+// ErrDuplicate is returned if it is already pending or anchored.
+func (a *Anchorer) Add(entry Entry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.known[entry.Hash] {
+		return fmt.Errorf("%s: %w", entry.Hash.Hex(), ErrDuplicate)
+	}
+
+	pending := append(a.pending[:len(a.pending):len(a.pending)], entry)
+	if err := a.save(pendingFile, pending); err != nil {
+		return err
+	}
+	a.pending = pending
+	a.known[entry.Hash] = true
+
+	// Do not wait for the end of the window if the batch is full
+	if len(a.pending) >= a.maxSize {
+		select {
+		case a.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Lookup returns the state of a measurement and, once it is anchored, its
+// record. The state is empty if the measurement is unknown.
+func (a *Anchorer) Lookup(hash common.Hash) (*Record, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	batch, ok := a.anchored[hash]
+	if !ok {
+		if a.known[hash] {
+			return nil, StatePending
+		}
+		return nil, ""
+	}
+
+	for i, entry := range batch.Entries {
+		if entry.Hash == hash {
+			return &Record{
+				Root:        batch.Root,
+				Proof:       batch.Proofs[i],
+				ManifestCID: batch.ManifestCID,
+				TxHash:      batch.TxHash,
+				AnchoredAt:  batch.AnchoredAt,
+			}, StateAnchored
+		}
+	}
+	return nil, ""
+}
+
+// Pending returns the number of measurements waiting to be anchored
+func (a *Anchorer) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
+
+// Start anchors the pending measurements with anchor at the end of every
+// window and whenever a batch is full
+func (a *Anchorer) Start(anchor AnchorFunc) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(a.window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stop:
+				return
+			case <-ticker.C:
+			case <-a.full:
+			}
+
+			if err := a.Flush(anchor); err != nil {
+				log.Printf("Could not anchor the pending measurements: %v\n", err)
+			}
+		}
+	}()
+}
+
+// Stop waits until the batch that is being anchored, if any, is stored. The
+// measurements that are still pending remain on disk.
+func (a *Anchorer) Stop() {
+	close(a.stop)
+	a.wg.Wait()
+}
+
+// Flush anchors the pending measurements with anchor, in batches of at
+// most MaxSize measurements. The batches that were anchored before an error
+// are kept.
+func (a *Anchorer) Flush(anchor AnchorFunc) error {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	for {
+		a.mu.Lock()
+		size := len(a.pending)
+		if size > a.maxSize {
+			size = a.maxSize
+		}
+		entries := append([]Entry(nil), a.pending[:size]...)
+		a.mu.Unlock()
+
+		if len(entries) == 0 {
+			return nil
+		}
+
+		batch, err := newBatch(entries)
+		if err != nil {
+			return err
+		}
+
+		err = anchor(batch)
+		if err != nil {
+			return err
+		}
+		batch.AnchoredAt = time.Now().UTC()
+
+		err = a.commit(batch)
+		if err != nil {
+			return err
+		}
+		log.Printf("Anchored %d measurements under the root %s\n", len(entries), batch.Root.Hex())
+	}
+}
+
+// newBatch builds the Merkle tree of the measurements
+func newBatch(entries []Entry) (*Batch, error) {
+	leaves := make([]common.Hash, len(entries))
+	batch := &Batch{Entries: entries, Proofs: make([]merkle.Proof, len(entries))}
+	for i, entry := range entries {
+		leaves[i] = entry.Hash
+		batch.Price += entry.Price
+	}
+
+	tree, err := merkle.New(leaves)
+	if err != nil {
+		return nil, err
+	}
+
+	batch.Root = tree.Root()
+	for i := range entries {
+		batch.Proofs[i] = tree.Proof(i)
+	}
+	return batch, nil
+}
+
+// commit stores an anchored batch and removes its measurements from the
+// pending ones. The measurements are always the first pending ones, as
+// batches are anchored one at a time.
+func (a *Anchorer) commit(batch *Batch) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.save(batchPrefix+batch.Root.Hex()[2:]+".json", batch); err != nil {
+		return err
+	}
+	a.index(batch)
+
+	pending := append([]Entry(nil), a.pending[len(batch.Entries):]...)
+	a.pending = pending
+
+	// If the pending file cannot be updated, the measurements of the
+	// batch are skipped when it is read again
+	if err := a.save(pendingFile, pending); err != nil {
+		log.Printf("Could not update the pending measurements: %v\n", err)
+	}
+	return nil
+}
+
+// index adds an anchored batch to the in-memory indexes. The caller must
+// hold the lock.
+func (a *Anchorer) index(batch *Batch) {
+	for _, entry := range batch.Entries {
+		a.known[entry.Hash] = true
+		a.anchored[entry.Hash] = batch
+	}
+}
+
+// read decodes a file of the folder
+func (a *Anchorer) read(name string, v interface{}) error {
+	jsonBytes, err := ioutil.ReadFile(filepath.Join(a.dir, name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonBytes, v)
+}
+
+// save atomically writes a file of the folder
+func (a *Anchorer) save(name string, v interface{}) error {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(a.dir, name)
+	tmpPath := path + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(jsonBytes); err != nil {
+		f.Close()
+		return err
+	}
+
+	// Make sure the file reaches the disk before it is acknowledged
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(a.dir)
+}
+
+// syncDir flushes the entries of a folder so that renames are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
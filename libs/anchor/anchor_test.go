@@ -0,0 +1,139 @@
+package anchor
+
+import (
+	"errors"
+	"testing"
+
+	merkle "administrator/ipfs-node/libs/merkle"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// entry returns the entry of the measurement i
+func entry(i int) Entry {
+	return Entry{Hash: crypto.Keccak256Hash([]byte{byte(i)}), Price: int64(i)}
+}
+
+func open(t *testing.T, dir string, maxSize int) *Anchorer {
+	a, err := Open(Config{Enabled: true, Window: 60, MaxSize: maxSize, Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// chain records the roots that are anchored
+type chain struct {
+	roots []common.Hash
+	fail  bool
+}
+
+func (c *chain) anchor(batch *Batch) error {
+	if c.fail {
+		return errors.New("the node is down")
+	}
+	c.roots = append(c.roots, batch.Root)
+	batch.TxHash = crypto.Keccak256Hash(batch.Root[:])
+	return nil
+}
+
+func TestBatches(t *testing.T) {
+	a := open(t, t.TempDir(), 4)
+	for i := 0; i < 10; i++ {
+		if err := a.Add(entry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &chain{}
+	if err := a.Flush(c.anchor); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.roots) != 3 || a.Pending() != 0 {
+		t.Fatalf("expected 3 batches and no pending measurements, got %d and %d", len(c.roots), a.Pending())
+	}
+
+	for i := 0; i < 10; i++ {
+		record, state := a.Lookup(entry(i).Hash)
+		if state != StateAnchored {
+			t.Fatalf("measurement %d: unexpected state %q", i, state)
+		}
+		if record.Root != c.roots[i/4] || !merkle.Verify(record.Root, record.Proof) {
+			t.Errorf("measurement %d: the proof is not valid for its root", i)
+		}
+	}
+}
+
+func TestFailedBatchStaysPending(t *testing.T) {
+	a := open(t, t.TempDir(), 10)
+	for i := 0; i < 3; i++ {
+		if err := a.Add(entry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &chain{fail: true}
+	if err := a.Flush(c.anchor); err == nil {
+		t.Fatal("expected the error of the anchoring")
+	}
+	if _, state := a.Lookup(entry(0).Hash); state != StatePending || a.Pending() != 3 {
+		t.Errorf("expected 3 pending measurements, got state %q and %d", state, a.Pending())
+	}
+
+	c.fail = false
+	if err := a.Flush(c.anchor); err != nil {
+		t.Fatal(err)
+	}
+	if _, state := a.Lookup(entry(0).Hash); state != StateAnchored {
+		t.Errorf("unexpected state %q", state)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	dir := t.TempDir()
+	a := open(t, dir, 2)
+	for i := 0; i < 3; i++ {
+		if err := a.Add(entry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the first batch is anchored before the restart
+	c := &chain{}
+	batch, err := newBatch(a.pending[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.anchor(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.commit(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := open(t, dir, 2)
+	if reopened.Pending() != 1 {
+		t.Errorf("expected 1 pending measurement, got %d", reopened.Pending())
+	}
+	record, state := reopened.Lookup(entry(1).Hash)
+	if state != StateAnchored || record.Root != c.roots[0] || record.TxHash != batch.TxHash {
+		t.Errorf("the anchored batch was not recovered: %q %+v", state, record)
+	}
+	if err := reopened.Add(entry(0)); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	a := open(t, t.TempDir(), 10)
+	if err := a.Add(entry(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Add(entry(0)); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+	if _, state := a.Lookup(entry(1).Hash); state != "" {
+		t.Errorf("unexpected state %q of an unknown measurement", state)
+	}
+}
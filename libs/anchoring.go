@@ -0,0 +1,146 @@
+package libs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+
+	anchor "administrator/ipfs-node/libs/anchor"
+	cipher "administrator/ipfs-node/libs/cipher"
+	ipfsLib "administrator/ipfs-node/libs/ipfsLib"
+	merkle "administrator/ipfs-node/libs/merkle"
+	ngsi "administrator/ipfs-node/libs/ngsi"
+	revenue "administrator/ipfs-node/libs/revenue"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// batchManifest is stored in IPFS for every anchored batch. It lists the
+// records of the measurements of the batch next to their inclusion proofs.
+type batchManifest struct {
+	Root    common.Hash     `json:"root"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+// manifestEntry is the record of a measurement in a batch manifest
+type manifestEntry struct {
+	Hash         common.Hash  `json:"hash"`
+	Description  string       `json:"description"`
+	EncryptedURL string       `json:"encryptedUrl"`
+	Price        int64        `json:"price"`
+	Proof        merkle.Proof `json:"proof"`
+}
+
+// anchorMeasurement adds a measurement to the batch that is anchored next,
+// instead of storing it in the Blockchain on its own
+func anchorMeasurement(ethClient ComponentConfig, m *ngsi.Measurement, dataStruct DataBlockchain, price int64, receipt *MeasurementReceipt) error {
+	// Check that the measurement has not already been stored on its own
+	measurement, err := ethClient.DataCon.Ledger(nil, dataStruct.Hash)
+	if err != nil {
+		return err
+	}
+	if measurement.Uri != "" {
+		return fmt.Errorf("%x: %w", dataStruct.Hash[:], ErrAlreadyStored)
+	}
+
+	err = ethClient.Anchorer.Add(anchor.Entry{
+		Hash:         dataStruct.Hash,
+		Description:  dataStruct.Description,
+		EncryptedURL: dataStruct.EncryptedURL,
+		Price:        price,
+		Sensor:       m.ID,
+		Type:         m.Type,
+	})
+	if errors.Is(err, anchor.ErrDuplicate) {
+		return fmt.Errorf("%x: %w", dataStruct.Hash[:], ErrAlreadyStored)
+	}
+	if err != nil {
+		return err
+	}
+
+	receipt.Batched = true
+	return nil
+}
+
+// AnchorBatch stores the manifest of a batch in IPFS and the root of the
+// batch in the Blockchain. The URL of the manifest is stored encrypted with
+// the public key of the administrator, like the URLs of the measurements,
+// and the price of the root is the sum of the prices of the measurements.
+func AnchorBatch(ethClient ComponentConfig, batch *anchor.Batch) error {
+	manifest := batchManifest{Root: batch.Root, Entries: make([]manifestEntry, len(batch.Entries))}
+	for i, entry := range batch.Entries {
+		manifest.Entries[i] = manifestEntry{
+			Hash:         entry.Hash,
+			Description:  entry.Description,
+			EncryptedURL: entry.EncryptedURL,
+			Price:        entry.Price,
+			Proof:        batch.Proofs[i],
+		}
+	}
+
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	cid, err := ipfsLib.AddToIPFS(ethClient.IPFSConfig.IpfsCore, bytes.NewReader(manifestBytes))
+	if err != nil {
+		return err
+	}
+	batch.ManifestCID = cid
+
+	adminPubKey, err := adminPublicKey(ethClient)
+	if err != nil {
+		return err
+	}
+
+	encryptedURL, err := cipher.EncryptWithPublicKey(*adminPubKey, []byte(cid))
+	if err != nil {
+		return err
+	}
+
+	dataStruct := DataBlockchain{
+		batch.Root,
+		fmt.Sprintf("Merkle root of %d measurements by %s", len(batch.Entries), ethClient.Config.Get().GatewayID),
+		fmt.Sprintf("%x", encryptedURL),
+	}
+
+	// A root that is already stored was anchored right before a restart
+	receipt := &MeasurementReceipt{Hash: batch.Root}
+	err = insertDataInBlockchain(ethClient, dataStruct, big.NewInt(batch.Price), receipt)
+	batch.TxHash = receipt.StoreTx
+	batch.PriceTxHash = receipt.PriceTx
+	batch.GasUsed = receipt.GasUsed
+	if err != nil && !errors.Is(err, ErrAlreadyStored) {
+		return err
+	}
+
+	log.Printf("Gas used by the transactions of the batch: %d\n", receipt.GasUsed)
+
+	// The revenue of the root is shared by its measurements by their prices
+	if ethClient.Revenue != nil {
+		parts := make([]revenue.Part, len(batch.Entries))
+		for i, entry := range batch.Entries {
+			parts[i] = revenue.Part{Sensor: entry.Sensor, Type: entry.Type, Weight: entry.Price}
+		}
+		if err := ethClient.Revenue.RecordBatch(batch.Root, parts); err != nil {
+			log.Printf("Could not record the batch 0x%x in the revenue index: %v\n", batch.Root[:], err)
+		}
+	}
+	return nil
+}
+
+// VerifyAnchoredProof checks that the proof leads to root and that root has
+// been anchored in the Blockchain
+func VerifyAnchoredProof(ethClient ComponentConfig, root common.Hash, proof merkle.Proof) (valid bool, anchored bool, err error) {
+	valid = merkle.Verify(root, proof)
+
+	record, err := ethClient.DataCon.Ledger(nil, root)
+	if err != nil {
+		return valid, false, err
+	}
+	return valid, record.Uri != "", nil
+}
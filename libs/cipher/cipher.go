@@ -10,10 +10,10 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/crypto/secp256k1"
 
 	ecies "administrator/ipfs-node/libs/ecies"
+	signer "administrator/ipfs-node/libs/signer"
 )
 
 // EncryptWithPublicKey encrypts a message using ECIES
@@ -117,9 +117,9 @@ func HashData(msg []byte) []byte {
 	return hash[:]
 }
 
-// SignData Sign with private key
-func SignData(privateKey *ecdsa.PrivateKey, data []byte) ([]byte, error) {
-	signedData, err := secp256k1.Sign(HashData(data), crypto.FromECDSA(privateKey))
+// SignData Sign with the key of the signer
+func SignData(s signer.Signer, data []byte) ([]byte, error) {
+	signedData, err := s.SignHash(HashData(data))
 	if err != nil {
 		fmt.Println(err)
 		return nil, err
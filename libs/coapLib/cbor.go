@@ -0,0 +1,67 @@
+package coapLib
+
+import (
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// DecodeCBOR decodes a CBOR map into the same representation that
+// encoding/json produces, so that the payload can be handled as a JSON body
+func DecodeCBOR(data []byte) (map[string]interface{}, error) {
+	var value interface{}
+	if err := cbor.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+
+	converted, err := jsonValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	body, ok := converted.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the CBOR payload is not a map")
+	}
+	return body, nil
+}
+
+// jsonValue converts a decoded CBOR value to its JSON representation
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported CBOR map key %v", key)
+			}
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[keyString] = converted
+		}
+		return m, nil
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			converted, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = converted
+		}
+		return items, nil
+	case uint64:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64, string, bool, nil:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unsupported CBOR value of type %T", value)
+	}
+}
@@ -0,0 +1,158 @@
+package coapLib
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	msg := &Message{
+		Type:      Confirmable,
+		Code:      POST,
+		MessageID: 0x1234,
+		Token:     []byte{1, 2, 3},
+		Options: []Option{
+			{OptionURIPath, []byte("notify")},
+			{OptionURIHost, []byte("proxy.example.org")},
+			{OptionURIQuery, bytes.Repeat([]byte("a"), 300)},
+		},
+		Payload: []byte(`{"id": "urn:1"}`),
+	}
+	msg.SetContentFormat(FormatCBOR)
+
+	parsed, err := Parse(msg.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Type != Confirmable || parsed.Code != POST || parsed.MessageID != 0x1234 {
+		t.Errorf("unexpected header %+v", parsed)
+	}
+	if !bytes.Equal(parsed.Token, msg.Token) || !bytes.Equal(parsed.Payload, msg.Payload) {
+		t.Errorf("unexpected token or payload %+v", parsed)
+	}
+	if parsed.Path() != "notify" {
+		t.Errorf("unexpected path %q", parsed.Path())
+	}
+	if format, ok := parsed.ContentFormat(); !ok || format != FormatCBOR {
+		t.Errorf("unexpected content format %d", format)
+	}
+	if len(parsed.Options) != 4 || len(parsed.Options[3].Value) != 300 {
+		t.Errorf("unexpected options %+v", parsed.Options)
+	}
+}
+
+func TestParseRejectsInvalidMessages(t *testing.T) {
+	invalid := [][]byte{
+		{},
+		{0x00, 0x01, 0x00, 0x01},             // version 0
+		{0x49, 0x01, 0x00, 0x01},             // token longer than the message
+		{0x40, 0x01, 0x00, 0x01, 0xff},       // payload marker without payload
+		{0x40, 0x01, 0x00, 0x01, 0xf0, 0x00}, // reserved option delta
+	}
+	for _, data := range invalid {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("expected an error for %x", data)
+		}
+	}
+}
+
+func TestConfirmableRequestsAreAcknowledgedAfterAcceptance(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	server := NewServer(func(addr net.Addr, req *Message) (*Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("queue unavailable")
+		}
+		return &Response{Code: Created}, nil
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(conn)
+	defer server.Close()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	req := &Message{Type: Confirmable, Code: POST, MessageID: 7, Token: []byte{9}}
+	buf := make([]byte, maxMessageSize)
+
+	// The first transmission fails, so no acknowledgement is sent
+	client.Write(req.Marshal())
+	client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := client.Read(buf); err == nil {
+		t.Fatal("the request was acknowledged before it was accepted")
+	}
+
+	// The retransmission is accepted and acknowledged
+	client.Write(req.Marshal())
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := Parse(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != Acknowledgement || resp.MessageID != 7 || resp.Code != Created || !bytes.Equal(resp.Token, []byte{9}) {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	// A duplicate of an accepted request gets the same response and is not
+	// processed again
+	client.Write(req.Marshal())
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := client.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	data, err := cbor.Marshal(map[string]interface{}{
+		"id":           "urn:1",
+		"dateObserved": map[string]interface{}{"value": "2020-09-09T11:58:00Z"},
+		"intensity":    map[string]interface{}{"value": 281},
+		"coordinates":  []interface{}{-3.8, 43.4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := DecodeCBOR(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intensity := body["intensity"].(map[string]interface{})["value"]
+	if intensity != float64(281) {
+		t.Errorf("unexpected intensity %#v", intensity)
+	}
+
+	if _, err := DecodeCBOR([]byte{0x01}); err == nil {
+		t.Error("expected an error for a payload that is not a map")
+	}
+}
@@ -0,0 +1,242 @@
+// Package coapLib implements the subset of CoAP (RFC 7252) used by the
+// constrained sensors to send their measurements to the proxy
+package coapLib
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Message types
+const (
+	Confirmable     uint8 = 0
+	NonConfirmable  uint8 = 1
+	Acknowledgement uint8 = 2
+	Reset           uint8 = 3
+)
+
+// Method and response codes (class << 5 | detail)
+const (
+	GET                      uint8 = 1
+	POST                     uint8 = 2
+	PUT                      uint8 = 3
+	DELETE                   uint8 = 4
+	Created                  uint8 = 2<<5 | 1
+	Changed                  uint8 = 2<<5 | 4
+	BadRequest               uint8 = 4<<5 | 0
+	Unauthorized             uint8 = 4<<5 | 1
+	Forbidden                uint8 = 4<<5 | 3
+	NotFound                 uint8 = 4<<5 | 4
+	MethodNotAllowed         uint8 = 4<<5 | 5
+	TooManyRequests          uint8 = 4<<5 | 29
+	UnsupportedContentFormat uint8 = 4<<5 | 15
+	InternalServerError      uint8 = 5<<5 | 0
+	ServiceUnavailable       uint8 = 5<<5 | 3
+)
+
+// Option numbers
+const (
+	OptionURIHost       uint16 = 3
+	OptionURIPath       uint16 = 11
+	OptionContentFormat uint16 = 12
+	OptionMaxAge        uint16 = 14
+	OptionURIQuery      uint16 = 15
+	OptionAccept        uint16 = 17
+)
+
+// Content formats
+const (
+	FormatTextPlain uint32 = 0
+	FormatJSON      uint32 = 50
+	FormatCBOR      uint32 = 60
+)
+
+const payloadMarker = 0xff
+
+// ErrInvalidMessage is returned when a datagram is not a valid CoAP message
+var ErrInvalidMessage = errors.New("invalid CoAP message")
+
+// Option is a CoAP option
+type Option struct {
+	Number uint16
+	Value  []byte
+}
+
+// Message is a CoAP message
+type Message struct {
+	Type      uint8
+	Code      uint8
+	MessageID uint16
+	Token     []byte
+	Options   []Option
+	Payload   []byte
+}
+
+// Path returns the URI path of the message without leading slash
+func (m *Message) Path() string {
+	var segments []string
+	for _, o := range m.Options {
+		if o.Number == OptionURIPath {
+			segments = append(segments, string(o.Value))
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// ContentFormat returns the content format of the payload. The second
+// value is false if the option is not present.
+func (m *Message) ContentFormat() (uint32, bool) {
+	for _, o := range m.Options {
+		if o.Number == OptionContentFormat {
+			return decodeUint(o.Value), true
+		}
+	}
+	return 0, false
+}
+
+// SetContentFormat sets the content format of the payload
+func (m *Message) SetContentFormat(format uint32) {
+	m.Options = append(m.Options, Option{OptionContentFormat, encodeUint(format)})
+}
+
+// Parse decodes a CoAP message
+func Parse(data []byte) (*Message, error) {
+	if len(data) < 4 || data[0]>>6 != 1 {
+		return nil, ErrInvalidMessage
+	}
+
+	m := &Message{
+		Type:      (data[0] >> 4) & 0x3,
+		Code:      data[1],
+		MessageID: binary.BigEndian.Uint16(data[2:4]),
+	}
+
+	tokenLength := int(data[0] & 0xf)
+	if tokenLength > 8 || len(data) < 4+tokenLength {
+		return nil, ErrInvalidMessage
+	}
+	m.Token = append([]byte(nil), data[4:4+tokenLength]...)
+	data = data[4+tokenLength:]
+
+	var number uint16
+	for len(data) > 0 {
+		if data[0] == payloadMarker {
+			if len(data) == 1 {
+				return nil, ErrInvalidMessage
+			}
+			m.Payload = append([]byte(nil), data[1:]...)
+			break
+		}
+
+		delta := int(data[0] >> 4)
+		length := int(data[0] & 0xf)
+		data = data[1:]
+
+		var err error
+		if delta, data, err = extendedValue(delta, data); err != nil {
+			return nil, err
+		}
+		if length, data, err = extendedValue(length, data); err != nil {
+			return nil, err
+		}
+		if len(data) < length || int(number)+delta > 0xffff {
+			return nil, ErrInvalidMessage
+		}
+
+		number += uint16(delta)
+		m.Options = append(m.Options, Option{number, append([]byte(nil), data[:length]...)})
+		data = data[length:]
+	}
+
+	return m, nil
+}
+
+// Marshal encodes a CoAP message
+func (m *Message) Marshal() []byte {
+	data := make([]byte, 4, 4+len(m.Token)+len(m.Payload)+16)
+	data[0] = 1<<6 | (m.Type&0x3)<<4 | uint8(len(m.Token))
+	data[1] = m.Code
+	binary.BigEndian.PutUint16(data[2:4], m.MessageID)
+	data = append(data, m.Token...)
+
+	// Options are encoded as deltas, so they must be sorted
+	options := append([]Option(nil), m.Options...)
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Number < options[j].Number
+	})
+
+	var number uint16
+	for _, o := range options {
+		delta, deltaExt := splitValue(int(o.Number - number))
+		length, lengthExt := splitValue(len(o.Value))
+		data = append(data, byte(delta<<4|length))
+		data = append(data, deltaExt...)
+		data = append(data, lengthExt...)
+		data = append(data, o.Value...)
+		number = o.Number
+	}
+
+	if len(m.Payload) > 0 {
+		data = append(data, payloadMarker)
+		data = append(data, m.Payload...)
+	}
+
+	return data
+}
+
+// extendedValue decodes the extended option delta and length fields
+func extendedValue(value int, data []byte) (int, []byte, error) {
+	switch value {
+	case 13:
+		if len(data) < 1 {
+			return 0, nil, ErrInvalidMessage
+		}
+		return int(data[0]) + 13, data[1:], nil
+	case 14:
+		if len(data) < 2 {
+			return 0, nil, ErrInvalidMessage
+		}
+		return int(binary.BigEndian.Uint16(data)) + 269, data[2:], nil
+	case 15:
+		return 0, nil, ErrInvalidMessage
+	default:
+		return value, data, nil
+	}
+}
+
+// splitValue encodes an option delta or length in its nibble and its
+// extended bytes
+func splitValue(value int) (int, []byte) {
+	switch {
+	case value < 13:
+		return value, nil
+	case value < 269:
+		return 13, []byte{byte(value - 13)}
+	default:
+		ext := make([]byte, 2)
+		binary.BigEndian.PutUint16(ext, uint16(value-269))
+		return 14, ext
+	}
+}
+
+// encodeUint encodes an uint option value with the minimum number of bytes
+func encodeUint(value uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], value)
+	i := 0
+	for i < 4 && buf[i] == 0 {
+		i++
+	}
+	return buf[i:]
+}
+
+// decodeUint decodes an uint option value
+func decodeUint(value []byte) uint32 {
+	var v uint32
+	for _, b := range value {
+		v = v<<8 | uint32(b)
+	}
+	return v
+}
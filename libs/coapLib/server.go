@@ -0,0 +1,198 @@
+package coapLib
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// exchangeLifetime is the time during which a retransmission of a
+// confirmable message may be received (EXCHANGE_LIFETIME in RFC 7252)
+const exchangeLifetime = 247 * time.Second
+
+// maxMessageSize is the size of the buffer used to read datagrams
+const maxMessageSize = 1152
+
+// Config is the configuration of the CoAP listener. The listener is
+// disabled if Addr is empty, which is the default.
+//
+// DTLS is not supported: the requests are neither encrypted nor
+// authenticated by the transport. Unless the sensors are required to sign
+// their measurements, anyone who can reach the listener can post them, so
+// it must only be exposed to trusted networks.
+type Config struct {
+	Addr string `json:"addr"`
+}
+
+// Response is the response of a Handler to a request. MaxAge is sent with
+// 4.29 (Too Many Requests) to tell the client when it may retry.
+type Response struct {
+	Code    uint8
+	Format  *uint32
+	MaxAge  *uint32
+	Payload []byte
+}
+
+// Handler processes a request. If it returns an error, the request is
+// considered not processed: confirmable requests are not acknowledged, so
+// the client retransmits them, and non-confirmable ones are answered with
+// 5.03 (Service Unavailable).
+type Handler func(addr net.Addr, req *Message) (*Response, error)
+
+// exchange is the state of a request received from an endpoint
+type exchange struct {
+	response []byte
+	expires  time.Time
+}
+
+// Server serves CoAP requests received over UDP
+type Server struct {
+	handler Handler
+	conn    net.PacketConn
+
+	mu        sync.Mutex
+	exchanges map[string]*exchange
+	messageID uint16
+}
+
+// NewServer creates a CoAP server
+func NewServer(handler Handler) *Server {
+	return &Server{
+		handler:   handler,
+		exchanges: make(map[string]*exchange),
+		messageID: uint16(rand.Intn(0x10000)),
+	}
+}
+
+// ListenAndServe listens on the UDP address addr and serves the requests
+func (s *Server) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(conn)
+}
+
+// Serve serves the requests received on conn until it is closed
+func (s *Server) Serve(conn net.PacketConn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		msg, err := Parse(buf[:n])
+		if err != nil {
+			continue
+		}
+		go s.serveMessage(conn, addr, msg)
+	}
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// serveMessage processes a message and sends its response
+func (s *Server) serveMessage(conn net.PacketConn, addr net.Addr, req *Message) {
+	// Only requests are served. Acknowledgements and resets of the
+	// responses sent by the server are ignored.
+	if req.Type == Acknowledgement || req.Type == Reset || req.Code == 0 || req.Code>>5 != 0 {
+		return
+	}
+
+	// Deduplicate the retransmissions of a request. If the request is
+	// still being processed, the retransmission is ignored.
+	key := fmt.Sprintf("%s/%d", addr, req.MessageID)
+	s.mu.Lock()
+	s.expireExchanges()
+	if ex, ok := s.exchanges[key]; ok {
+		response := ex.response
+		s.mu.Unlock()
+		if response != nil {
+			conn.WriteTo(response, addr)
+		}
+		return
+	}
+	ex := &exchange{expires: time.Now().Add(exchangeLifetime)}
+	s.exchanges[key] = ex
+	s.mu.Unlock()
+
+	resp, err := s.handler(addr, req)
+	if err != nil {
+		log.Printf("Could not process CoAP request from %s: %v\n", addr, err)
+		if req.Type == Confirmable {
+			// Forget the exchange so that the retransmission is processed
+			s.mu.Lock()
+			delete(s.exchanges, key)
+			s.mu.Unlock()
+			return
+		}
+		resp = &Response{Code: ServiceUnavailable}
+	}
+
+	msg := &Message{
+		Code:    resp.Code,
+		Token:   req.Token,
+		Payload: resp.Payload,
+	}
+	if resp.Format != nil {
+		msg.SetContentFormat(*resp.Format)
+	}
+	if resp.MaxAge != nil {
+		msg.Options = append(msg.Options, Option{OptionMaxAge, encodeUint(*resp.MaxAge)})
+	}
+
+	// Confirmable requests are answered with a piggybacked acknowledgement
+	if req.Type == Confirmable {
+		msg.Type = Acknowledgement
+		msg.MessageID = req.MessageID
+	} else {
+		msg.Type = NonConfirmable
+		msg.MessageID = s.nextMessageID()
+	}
+
+	data := msg.Marshal()
+	s.mu.Lock()
+	ex.response = data
+	s.mu.Unlock()
+
+	if _, err := conn.WriteTo(data, addr); err != nil {
+		log.Printf("Could not send CoAP response to %s: %v\n", addr, err)
+	}
+}
+
+// expireExchanges removes the exchanges that can no longer be retransmitted.
+// The caller must hold the lock.
+func (s *Server) expireExchanges() {
+	now := time.Now()
+	for key, ex := range s.exchanges {
+		if now.After(ex.expires) {
+			delete(s.exchanges, key)
+		}
+	}
+}
+
+// nextMessageID returns the message ID of a new message
+func (s *Server) nextMessageID() uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messageID++
+	return s.messageID
+}
@@ -4,24 +4,30 @@ import (
 	accessControlContract "administrator/ipfs-node/contracts/accessContract"
 	balanceContract "administrator/ipfs-node/contracts/balanceContract"
 	dataContract "administrator/ipfs-node/contracts/dataContract"
+	accesscache "administrator/ipfs-node/libs/accesscache"
+	anchor "administrator/ipfs-node/libs/anchor"
+	config "administrator/ipfs-node/libs/config"
+	ethpool "administrator/ipfs-node/libs/ethpool"
+	queue "administrator/ipfs-node/libs/queue"
+	ratelimit "administrator/ipfs-node/libs/ratelimit"
+	revenue "administrator/ipfs-node/libs/revenue"
+	sensors "administrator/ipfs-node/libs/sensors"
+	signer "administrator/ipfs-node/libs/signer"
+	transactions "administrator/ipfs-node/libs/transactions"
 	"bytes"
 	"encoding/hex"
-	"encoding/json"
-	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
+	"math/big"
 
 	"crypto/ecdsa"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 	icore "github.com/ipfs/interface-go-ipfs-core"
 	// This package is needed so that all the preloaded plugins are loaded automatically
 )
 
-// ConfigIPFS is a struct used to unmarshal the
-// config JSON to a go Object
+// ConfigIPFS holds the settings of the IPFS node
+// and its API
 type ConfigIPFS struct {
 	IpfsPath     string
 	IpfsBoostrap []string
@@ -29,17 +35,32 @@ type ConfigIPFS struct {
 }
 
 // ComponentConfig stores the configuration of
-// this component
+// this component. ChainID is the chain the transactions are signed for.
+// AtomicStore is set when the deployed contracts can store
+// and price a measurement in one transaction. Revenue is the index of the
+// purchases, where the entities of the stored measurements are recorded.
 type ComponentConfig struct {
-	EthereumClient *ethclient.Client
-	PrivateKey     *ecdsa.PrivateKey
+	EthereumClient *ethpool.Pool
+	Signer         signer.Signer
+	ChainID        *big.Int
 	PublicKey      ecdsa.PublicKey
 	Address        common.Address
 	DataCon        *dataContract.DataLedgerContract
 	AccessCon      *accessControlContract.AccessControlContract
 	BalanceCon     *balanceContract.BalanceContract
 	IPFSConfig     ConfigIPFS
-	GeneralConfig  map[string]interface{}
+	Config         *config.Store
+	Queue          *queue.Queue
+	Sensors        *sensors.Verifier
+	SensorLimits   *ratelimit.Limiter
+	CallerLimits   *ratelimit.Limiter
+	Confirmer      *transactions.Confirmer
+	Nonces         *transactions.NonceManager
+	Gas            *transactions.GasStrategy
+	Anchorer       *anchor.Anchorer
+	AtomicStore    bool
+	Access         *accesscache.Cache
+	Revenue        *revenue.Index
 }
 
 // DataBlockchain is a struct that stores the information which will
@@ -50,6 +71,21 @@ type DataBlockchain struct {
 	EncryptedURL string
 }
 
+// MeasurementReceipt identifies where a measurement has been stored. CID is
+// empty when the URL stored in the Blockchain was uploaded by an earlier
+// attempt, since it points to that copy. GasUsed is the gas spent by the transactions of the measurement. Batched
+// is set when the measurement waits to be anchored in a batch.
+type MeasurementReceipt struct {
+	Hash      [32]byte
+	CID       string
+	StoreTx   common.Hash
+	PriceTx   common.Hash
+	Price     int64
+	PriceRule string
+	GasUsed   uint64
+	Batched   bool
+}
+
 // HexStringToBytes32 converts hex string to [32]byte
 func HexStringToBytes32(str string) ([32]byte, error) {
 	var bytes32 [32]byte
@@ -78,28 +114,3 @@ func StreamToByte(stream io.Reader) []byte {
 	buf.ReadFrom(stream)
 	return buf.Bytes()
 }
-
-// ReadConfigFile Reads configuration file
-func ReadConfigFile(name string) map[string]interface{} {
-	config := make(map[string]interface{})
-
-	// Open the configuration file
-	jsonFile, err := os.Open("./config/" + name)
-	if err != nil {
-		fmt.Println(err)
-		panic(err)
-	}
-	defer jsonFile.Close()
-
-	// Parse to bytes
-	byteValue, _ := ioutil.ReadAll(jsonFile)
-
-	// Load the object in the map[string]interface{} variable
-	err = json.Unmarshal(byteValue, &config)
-	if err != nil {
-		fmt.Println(err)
-		panic(err)
-	}
-
-	return config
-}
@@ -0,0 +1,388 @@
+// Package config loads the configuration of the IoT proxy. The settings are
+// read from a JSON file, can be overridden with environment variables and
+// are validated before the proxy starts.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	accesscache "administrator/ipfs-node/libs/accesscache"
+	anchor "administrator/ipfs-node/libs/anchor"
+	coapLib "administrator/ipfs-node/libs/coapLib"
+	ethpool "administrator/ipfs-node/libs/ethpool"
+	lorawan "administrator/ipfs-node/libs/lorawan"
+	mqttLib "administrator/ipfs-node/libs/mqttLib"
+	ngsi "administrator/ipfs-node/libs/ngsi"
+	pricing "administrator/ipfs-node/libs/pricing"
+	queue "administrator/ipfs-node/libs/queue"
+	ratelimit "administrator/ipfs-node/libs/ratelimit"
+	revenue "administrator/ipfs-node/libs/revenue"
+	secrets "administrator/ipfs-node/libs/secrets"
+	sensors "administrator/ipfs-node/libs/sensors"
+	signer "administrator/ipfs-node/libs/signer"
+	tlsLib "administrator/ipfs-node/libs/tlsLib"
+	transactions "administrator/ipfs-node/libs/transactions"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultPath is the path of the configuration file if none is given
+const DefaultPath = "./config/config.json"
+
+// DefaultDescriptionTemplate is the template of the descriptions of the
+// measurements stored in the Blockchain if none is configured
+const DefaultDescriptionTemplate = "{{.ID}} by {{.GatewayID}} at {{.ObservedAt}}"
+
+// Config is the configuration of the IoT proxy
+type Config struct {
+	IpfsPath            string   `json:"ipfsPath"`
+	IpfsBoostrap        []string `json:"ipfsBoostrap"`
+	NodePath            string   `json:"nodePath"`
+	Addr                string   `json:"addr"`
+	Password            string   `json:"password" env:"-"`
+	GatewayID           string   `json:"gatewayID"`
+	BalanceContractAddr string   `json:"balanceContractAddr"`
+	AccessContractAddr  string   `json:"accessContractAddr"`
+	DataContractAddr    string   `json:"dataContractAddr"`
+	HTTPport            string   `json:"HTTPport" env:"HTTP_PORT"`
+	HTTPSport           string   `json:"HTTPSport" env:"HTTPS_PORT"`
+	PriceMeasurements   int64    `json:"priceMeasurements"`
+	DescriptionTemplate string   `json:"descriptionTemplate"`
+	InputFormat         string   `json:"inputFormat"`
+	QueuePath           string   `json:"queuePath"`
+	QueueWorkers        int      `json:"queueWorkers"`
+	AdminToken          string   `json:"adminToken"`
+
+	Queue      queue.Config     `json:"queue"`
+	MQTT       mqttLib.Config   `json:"mqtt"`
+	CoAP       coapLib.Config   `json:"coap"`
+	LoRaWAN    lorawan.Config   `json:"lorawan"`
+	Sensors    sensors.Config   `json:"sensors"`
+	RateLimits ratelimit.Config `json:"rateLimits"`
+	TLS        tlsLib.Config    `json:"tls"`
+	Pricing    pricing.Config   `json:"pricing"`
+
+	Ethereum     ethpool.Config      `json:"ethereum"`
+	Transactions transactions.Config `json:"transactions"`
+	Anchoring    anchor.Config       `json:"anchoring"`
+	Access       accesscache.Config  `json:"access"`
+	Revenue      revenue.Config      `json:"revenue"`
+
+	KeystorePassword secrets.Source `json:"keystorePassword"`
+	Signer           signer.Config  `json:"signer"`
+}
+
+// FieldError is returned when a field of the configuration is not valid.
+// Field is the path of the field in the configuration file.
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("Invalid configuration field %s: %s", e.Field, e.Reason)
+}
+
+// Default returns the configuration used for the fields that are not set
+func Default() *Config {
+	return &Config{
+		HTTPport:            "5053",
+		DescriptionTemplate: DefaultDescriptionTemplate,
+		InputFormat:         ngsi.FormatAuto,
+		QueuePath:           "./queue",
+		QueueWorkers:        1,
+		Queue: queue.Config{
+			MaxAttempts: 5,
+			Backoff:     10,
+			Retention:   168,
+		},
+		MQTT: mqttLib.Config{
+			QoS: 1,
+		},
+		Sensors: sensors.Config{
+			Window: 300,
+		},
+		Ethereum: ethpool.Config{
+			HealthCheck: 10,
+		},
+		Transactions: transactions.Config{
+			Path:          "./submissions",
+			Timeout:       60,
+			Confirmations: 1,
+			Gas: transactions.GasConfig{
+				Limit:      transactions.LimitFixed,
+				GasLimit:   3000000,
+				Multiplier: 1.2,
+				Price:      transactions.PriceFixed,
+			},
+			Replacement: transactions.ReplacementConfig{
+				After:       20,
+				BumpPercent: 15,
+			},
+		},
+		Anchoring: anchor.Config{
+			Window:  60,
+			MaxSize: 256,
+			Path:    "./anchors",
+		},
+		Access: accesscache.Config{
+			Resync: 300,
+		},
+		Revenue: revenue.Config{
+			Path:          "./revenue",
+			Poll:          30,
+			Confirmations: 1,
+		},
+		KeystorePassword: secrets.Source{
+			Credential: "keystore-password",
+			Env:        "IOTPROXY_KEYSTORE_PASSWORD",
+			Prompt:     true,
+		},
+		Signer: signer.Config{
+			Type: signer.TypeKeystore,
+			PKCS11: signer.PKCS11Config{
+				Pin: secrets.Source{
+					Credential: "pkcs11-pin",
+					Env:        "IOTPROXY_PKCS11_PIN",
+					Prompt:     true,
+				},
+			},
+		},
+	}
+}
+
+// Load reads the configuration file, applies the overrides of the
+// environment and validates the result
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := Default()
+
+	// Unknown fields are rejected, so a typo is not silently ignored
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(config)
+	if err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return nil, &FieldError{typeErr.Field, fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+		}
+		return nil, fmt.Errorf("Invalid configuration file %s: %v", path, err)
+	}
+
+	err = ApplyEnv(config, EnvPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks the configuration. The error names the first field that
+// is not valid.
+func (c *Config) Validate() error {
+	required := []struct {
+		field string
+		value string
+	}{
+		{"nodePath", c.NodePath},
+		{"addr", c.Addr},
+		{"gatewayID", c.GatewayID},
+		{"balanceContractAddr", c.BalanceContractAddr},
+		{"accessContractAddr", c.AccessContractAddr},
+		{"dataContractAddr", c.DataContractAddr},
+		{"queuePath", c.QueuePath},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			return &FieldError{r.field, "it is required"}
+		}
+	}
+
+	// The password of the keystore is read from the sources of
+	// keystorePassword, never from the configuration file
+	if c.Password != "" {
+		return &FieldError{"password", "the password of the keystore cannot be stored in the configuration file, use keystorePassword instead"}
+	}
+
+	addresses := []struct {
+		field string
+		value string
+	}{
+		{"addr", c.Addr},
+		{"balanceContractAddr", c.BalanceContractAddr},
+		{"accessContractAddr", c.AccessContractAddr},
+		{"dataContractAddr", c.DataContractAddr},
+	}
+	for _, a := range addresses {
+		if !common.IsHexAddress(a.value) {
+			return &FieldError{a.field, fmt.Sprintf("%q is not an Ethereum address", a.value)}
+		}
+	}
+
+	if c.HTTPport == "" && (c.HTTPSport == "" || c.TLS.CertFile == "") {
+		return &FieldError{"HTTPport", "it is required unless the HTTPS listener is configured"}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return &FieldError{"tls.keyFile", "the certificate and the key must be set together"}
+	}
+	if c.PriceMeasurements < 0 {
+		return &FieldError{"priceMeasurements", "it cannot be negative"}
+	}
+
+	if _, err := pricing.NewEngine(c.Pricing, c.PriceMeasurements); err != nil {
+		if ruleErr, ok := err.(*pricing.RuleError); ok {
+			return &FieldError{fmt.Sprintf("pricing.rules[%d].%s", ruleErr.Rule, ruleErr.Field), ruleErr.Reason}
+		}
+		return &FieldError{"pricing", err.Error()}
+	}
+
+	if _, err := template.New("description").Parse(c.DescriptionTemplate); err != nil {
+		return &FieldError{"descriptionTemplate", err.Error()}
+	}
+
+	switch c.InputFormat {
+	case ngsi.FormatAuto, ngsi.FormatNGSIv2, ngsi.FormatNGSILD:
+	default:
+		return &FieldError{"inputFormat", fmt.Sprintf("unknown format %q", c.InputFormat)}
+	}
+
+	if c.QueueWorkers < 1 {
+		return &FieldError{"queueWorkers", "at least one worker is required"}
+	}
+	if c.Queue.MaxAttempts < 1 {
+		return &FieldError{"queue.maxAttempts", "at least one attempt is required"}
+	}
+	if c.Queue.Backoff < 0 {
+		return &FieldError{"queue.backoff", "it cannot be negative"}
+	}
+	if c.Queue.Retention < 0 {
+		return &FieldError{"queue.retention", "it cannot be negative"}
+	}
+
+	if c.MQTT.BrokerURL != "" && len(c.MQTT.Topics) == 0 {
+		return &FieldError{"mqtt.topics", "at least one topic is required"}
+	}
+	if c.MQTT.QoS > 2 {
+		return &FieldError{"mqtt.qos", "it must be 0, 1 or 2"}
+	}
+
+	if c.Sensors.Required && c.Sensors.RegistryFile == "" {
+		return &FieldError{"sensors.registryFile", "it is required when the signatures are required"}
+	}
+	if c.Sensors.Window <= 0 {
+		return &FieldError{"sensors.window", "it must be positive"}
+	}
+
+	limits := []struct {
+		field string
+		limit ratelimit.Limit
+	}{
+		{"rateLimits.sensor", c.RateLimits.Sensor},
+		{"rateLimits.caller", c.RateLimits.Caller},
+	}
+	for _, l := range limits {
+		if l.limit.Rate < 0 || l.limit.Burst < 0 || l.limit.Daily < 0 {
+			return &FieldError{l.field, "the limits cannot be negative"}
+		}
+	}
+
+	if c.Ethereum.HealthCheck <= 0 {
+		return &FieldError{"ethereum.healthCheck", "it must be positive"}
+	}
+
+	if c.Transactions.Path == "" {
+		return &FieldError{"transactions.path", "it is required"}
+	}
+	if c.Transactions.Timeout <= 0 {
+		return &FieldError{"transactions.timeout", "it must be positive"}
+	}
+	if c.Transactions.Confirmations < 1 {
+		return &FieldError{"transactions.confirmations", "at least one confirmation is required"}
+	}
+
+	replacement := c.Transactions.Replacement
+	if replacement.After < 0 || replacement.After >= c.Transactions.Timeout {
+		return &FieldError{"transactions.replacement.after", "it must be between 0 (disabled) and the timeout"}
+	}
+	if replacement.After > 0 && replacement.BumpPercent < 10 {
+		return &FieldError{"transactions.replacement.bumpPercent", "the nodes require at least 10"}
+	}
+
+	gas := c.Transactions.Gas
+	switch gas.Limit {
+	case transactions.LimitFixed:
+		if gas.GasLimit == 0 {
+			return &FieldError{"transactions.gas.gasLimit", "it is required with a fixed gas limit"}
+		}
+	case transactions.LimitEstimate:
+		if gas.Multiplier < 1 {
+			return &FieldError{"transactions.gas.multiplier", "it must be at least 1"}
+		}
+	default:
+		return &FieldError{"transactions.gas.limit", fmt.Sprintf("unknown strategy %q", gas.Limit)}
+	}
+	switch gas.Price {
+	case transactions.PriceFixed, transactions.PriceOracle, transactions.PriceEIP1559:
+	default:
+		return &FieldError{"transactions.gas.price", fmt.Sprintf("unknown strategy %q", gas.Price)}
+	}
+
+	switch c.Signer.Type {
+	case signer.TypeKeystore:
+	case signer.TypeClef:
+		if strings.TrimSpace(c.Signer.Clef.Endpoint) == "" {
+			return &FieldError{"signer.clef.endpoint", "it is required by the Clef signer"}
+		}
+	case signer.TypePKCS11:
+		if !signer.PKCS11Supported {
+			return &FieldError{"signer.type", "the proxy was built without PKCS#11 support, build it with -tags pkcs11"}
+		}
+		if strings.TrimSpace(c.Signer.PKCS11.Module) == "" {
+			return &FieldError{"signer.pkcs11.module", "it is required by the PKCS#11 signer"}
+		}
+		if c.Signer.PKCS11.KeyLabel == "" {
+			return &FieldError{"signer.pkcs11.keyLabel", "it is required by the PKCS#11 signer"}
+		}
+	default:
+		return &FieldError{"signer.type", fmt.Sprintf("unknown signer %q", c.Signer.Type)}
+	}
+
+	if c.Access.Resync <= 0 {
+		return &FieldError{"access.resync", "it must be positive"}
+	}
+
+	if c.Anchoring.Enabled {
+		if c.Anchoring.Window <= 0 {
+			return &FieldError{"anchoring.window", "it must be positive"}
+		}
+		if c.Anchoring.MaxSize < 1 {
+			return &FieldError{"anchoring.maxSize", "at least one measurement per batch is required"}
+		}
+		if strings.TrimSpace(c.Anchoring.Path) == "" {
+			return &FieldError{"anchoring.path", "it is required when the anchoring in batches is enabled"}
+		}
+	}
+
+	if c.Revenue.Enabled {
+		if c.Revenue.Poll <= 0 {
+			return &FieldError{"revenue.poll", "it must be positive"}
+		}
+		if strings.TrimSpace(c.Revenue.Path) == "" {
+			return &FieldError{"revenue.path", "it is required when the revenue watcher is enabled"}
+		}
+	}
+
+	return nil
+}
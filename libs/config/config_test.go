@@ -0,0 +1,244 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	signer "administrator/ipfs-node/libs/signer"
+)
+
+// writeConfig writes a configuration file in a temporary folder
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setenv sets an environment variable for the duration of the test
+func setenv(t *testing.T, key, value string) {
+	os.Setenv(key, value)
+	t.Cleanup(func() { os.Unsetenv(key) })
+}
+
+func TestLoadShippedConfig(t *testing.T) {
+	config, err := Load(filepath.Join("..", "..", "config", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.GatewayID != "SmartSantander" || config.PriceMeasurements != 2 || config.MQTT.QoS != 1 {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+	if limit := config.RateLimits.Sensor; limit.Rate != 1 || limit.Burst != 5 || limit.Daily != 20000 || config.RateLimits.Caller.Burst != 100 {
+		t.Errorf("unexpected rate limits %+v", config.RateLimits)
+	}
+}
+
+const minimalConfig = `{
+  "nodePath": "/node/",
+  "addr": "0x47a267d59baDb1577CEe26c7A42E4E19aFC85cBA",
+  "gatewayID": "gw",
+  "balanceContractAddr": "0xf2a0f8885b0C014fe369b8527a63161A1405eFDa",
+  "accessContractAddr": "0x0F47d696A98ABE52CfBC399f989A687dcF4791A2",
+  "dataContractAddr": "0x584430546B9D14135Cce4438190840a240d12E93"
+}`
+
+func TestDefaults(t *testing.T) {
+	config, err := Load(writeConfig(t, minimalConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.HTTPport != "5053" || config.QueueWorkers != 1 || config.InputFormat != "auto" || config.Sensors.Window != 300 {
+		t.Errorf("defaults not applied: %+v", config)
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	setenv(t, "IOTPROXY_NODE_PATH", "/other/")
+	setenv(t, "IOTPROXY_HTTP_PORT", "6000")
+	setenv(t, "IOTPROXY_IPFS_BOOSTRAP", "/ip4/1.2.3.4/tcp/4001, /ip4/5.6.7.8/tcp/4001")
+	setenv(t, "IOTPROXY_MQTT_BROKER_URL", "tcp://broker:1883")
+	setenv(t, "IOTPROXY_MQTT_TOPICS", "a,b")
+	setenv(t, "IOTPROXY_RATE_LIMITS_SENSOR_RATE", "0.5")
+	setenv(t, "IOTPROXY_TLS_CLIENT_CA_FILE", "/ca.crt")
+	setenv(t, "IOTPROXY_TLS_GATEWAYS", `{"gw.example.com": "gw"}`)
+
+	config, err := Load(writeConfig(t, minimalConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.NodePath != "/other/" || config.HTTPport != "6000" {
+		t.Errorf("strings not overridden: %+v", config)
+	}
+	if len(config.IpfsBoostrap) != 2 || config.IpfsBoostrap[1] != "/ip4/5.6.7.8/tcp/4001" {
+		t.Errorf("lists not overridden: %v", config.IpfsBoostrap)
+	}
+	if config.MQTT.BrokerURL != "tcp://broker:1883" || len(config.MQTT.Topics) != 2 {
+		t.Errorf("nested fields not overridden: %+v", config.MQTT)
+	}
+	if config.RateLimits.Sensor.Rate != 0.5 || config.TLS.ClientCAFile != "/ca.crt" || config.TLS.Gateways["gw.example.com"] != "gw" {
+		t.Errorf("nested fields not overridden: %+v %+v", config.RateLimits, config.TLS)
+	}
+}
+
+func TestErrorsNameTheField(t *testing.T) {
+	// The PKCS#11 signer is refused when the proxy is built without it
+	pkcs11Field := "signer.pkcs11.module"
+	if !signer.PKCS11Supported {
+		pkcs11Field = "signer.type"
+	}
+
+	cases := map[string]struct {
+		config string
+		env    map[string]string
+		field  string
+	}{
+		"missing field": {
+			config: `{"nodePath": "/node/"}`,
+			field:  "addr",
+		},
+		"invalid address": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "addr": "0x1234"}`,
+			field:  "addr",
+		},
+		"wrong type": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "queueWorkers": "two"}`,
+			field:  "queueWorkers",
+		},
+		"invalid value": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "mqtt": {"qos": 3}}`,
+			field:  "mqtt.qos",
+		},
+		"plain text password": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "password": "1"}`,
+			field:  "password",
+		},
+		"invalid pricing rule": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "pricing": {"rules": [{"idPattern": "("}]}}`,
+			field:  "pricing.rules[0].idPattern",
+		},
+		"no submissions path": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "transactions": {"path": ""}}`,
+			field:  "transactions.path",
+		},
+		"no confirmations": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "transactions": {"timeout": 60, "confirmations": 0}}`,
+			field:  "transactions.confirmations",
+		},
+		"unknown gas strategy": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "transactions": {"timeout": 60, "confirmations": 1, "gas": {"limit": "fixed", "gasLimit": 1, "price": "auction"}}}`,
+			field:  "transactions.gas.price",
+		},
+		"empty anchoring batches": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "anchoring": {"enabled": true, "window": 60, "maxSize": 0}}`,
+			field:  "anchoring.maxSize",
+		},
+		"no access resync": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "access": {"resync": 0}}`,
+			field:  "access.resync",
+		},
+		"clef without endpoint": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "signer": {"type": "clef"}}`,
+			field:  "signer.clef.endpoint",
+		},
+		"pkcs11 signer": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "signer": {"type": "pkcs11"}}`,
+			field:  pkcs11Field,
+		},
+		"no queue attempts": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "queue": {"maxAttempts": 0}}`,
+			field:  "queue.maxAttempts",
+		},
+		"unknown signer": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "signer": {"type": "ledger"}}`,
+			field:  "signer.type",
+		},
+		"revenue without path": {
+			config: minimalConfig[:len(minimalConfig)-1] + `, "revenue": {"enabled": true, "path": " "}}`,
+			field:  "revenue.path",
+		},
+		"invalid env value": {
+			config: minimalConfig,
+			env:    map[string]string{"IOTPROXY_QUEUE_WORKERS": "many"},
+			field:  "queueWorkers",
+		},
+	}
+
+	for name, c := range cases {
+		for key, value := range c.env {
+			setenv(t, key, value)
+		}
+
+		_, err := Load(writeConfig(t, c.config))
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) {
+			t.Errorf("%s: expected a field error, got %v", name, err)
+		} else if fieldErr.Field != c.field {
+			t.Errorf("%s: expected an error in %s, got %v", name, c.field, err)
+		}
+
+		for key := range c.env {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestUnknownFieldsAreRejected(t *testing.T) {
+	_, err := Load(writeConfig(t, minimalConfig[:len(minimalConfig)-1]+`, "priceMeasurement": 2}`))
+	if err == nil {
+		t.Error("expected an error for a misspelt field")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeConfig(t, minimalConfig)
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(path, config)
+
+	changed := minimalConfig[:len(minimalConfig)-1] + `, "priceMeasurements": 5, "descriptionTemplate": "{{.ID}}", "nodePath": "/other/"}`
+	if err := ioutil.WriteFile(path, []byte(changed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, restart, err := store.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.PriceMeasurements != 5 || reloaded.DescriptionTemplate != "{{.ID}}" {
+		t.Errorf("live settings not applied: %+v", reloaded)
+	}
+	if reloaded.NodePath != "/node/" {
+		t.Errorf("a setting that needs a restart was applied: %s", reloaded.NodePath)
+	}
+	if len(restart) != 1 || restart[0] != "nodePath" {
+		t.Errorf("unexpected settings that need a restart: %v", restart)
+	}
+	if store.Get() != reloaded || config.PriceMeasurements != 0 {
+		t.Error("the previous configuration was modified")
+	}
+
+	// Invalid files keep the current configuration
+	if err := ioutil.WriteFile(path, []byte(`{"descriptionTemplate": "{{.ID"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Reload(); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+	if store.Get() != reloaded {
+		t.Error("the configuration changed after an invalid reload")
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of the environment variables that override the
+// fields of the configuration
+const EnvPrefix = "IOTPROXY"
+
+// ApplyEnv overrides the fields of a configuration struct with the
+// environment variables. The name of the variable of a field is the prefix
+// followed by the path of the field in the configuration file in upper
+// snake case, e.g. IOTPROXY_NODE_PATH or IOTPROXY_MQTT_BROKER_URL, unless
+// the field has an env tag ("-" for fields that cannot be overridden). Lists of strings are separated by commas, and
+// maps and lists of objects are JSON.
+func ApplyEnv(config interface{}, prefix string) error {
+	v := reflect.ValueOf(config)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("The configuration must be a pointer to a struct")
+	}
+	return applyEnv(v.Elem(), "", prefix)
+}
+
+// applyEnv overrides the fields of the struct v. path is the path of the
+// struct in the configuration file and envName the name of its variable.
+func applyEnv(v reflect.Value, path string, envName string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := fieldName(field)
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+		fieldEnv := field.Tag.Get("env")
+		if fieldEnv == "-" {
+			continue
+		}
+		if fieldEnv == "" {
+			fieldEnv = snakeCase(fieldName(field))
+		}
+		fieldEnv = envName + "_" + fieldEnv
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(v.Field(i), fieldPath, fieldEnv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(fieldEnv)
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return &FieldError{fieldPath, fmt.Sprintf("invalid value of %s: %v", fieldEnv, err)}
+		}
+	}
+	return nil
+}
+
+// setField parses the value of an environment variable into a field
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			var list []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			field.Set(reflect.ValueOf(list))
+			return nil
+		}
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+	default:
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+	return nil
+}
+
+// fieldName returns the name of a field in the configuration file: its
+// JSON name or, if it has none, its name starting with lower case
+func fieldName(field reflect.StructField) string {
+	if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" {
+		return tag
+	}
+	name := []rune(field.Name)
+	name[0] = unicode.ToLower(name[0])
+	return string(name)
+}
+
+// snakeCase converts a camel case name to upper snake case. Acronyms are
+// kept together: brokerURL is BROKER_URL and clientCAFile is CLIENT_CA_FILE.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])
+			if prevLower || nextLower {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
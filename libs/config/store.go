@@ -0,0 +1,72 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+)
+
+// liveFields are the fields of the configuration that are applied when the
+// configuration is reloaded. Changes to the other fields need a restart.
+var liveFields = map[string]bool{
+	"PriceMeasurements":   true,
+	"Pricing":             true,
+	"GatewayID":           true,
+	"DescriptionTemplate": true,
+	"RateLimits":          true,
+	"IpfsBoostrap":        true,
+}
+
+// Store holds the current configuration and reloads it from its file
+type Store struct {
+	path string
+
+	mu      sync.RWMutex
+	current *Config
+}
+
+// NewStore creates a store of the configuration loaded from path
+func NewStore(path string, config *Config) *Store {
+	return &Store{path: path, current: config}
+}
+
+// Get returns the current configuration. It must not be modified.
+func (s *Store) Get() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Reload loads the configuration file again and applies the fields that can
+// be changed live. The fields that changed but need a restart are returned
+// by their name in the configuration file. If the file is not valid, the
+// current configuration is kept.
+func (s *Store) Reload() (*Config, []string, error) {
+	loaded, err := Load(s.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := *s.current
+	var restart []string
+
+	current := reflect.ValueOf(s.current).Elem()
+	nextValue := reflect.ValueOf(&next).Elem()
+	loadedValue := reflect.ValueOf(loaded).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		if reflect.DeepEqual(current.Field(i).Interface(), loadedValue.Field(i).Interface()) {
+			continue
+		}
+		if liveFields[field.Name] {
+			nextValue.Field(i).Set(loadedValue.Field(i))
+		} else {
+			restart = append(restart, fieldName(field))
+		}
+	}
+
+	s.current = &next
+	return &next, restart, nil
+}
@@ -0,0 +1,59 @@
+package libs
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// push4 is the opcode that pushes the selectors of the functions in the
+// dispatcher of a contract
+const push4 = 0x63
+
+// balanceAddressSlot is the storage slot of the address of the balance
+// contract in the data contract, set by setBalanceAddress
+var balanceAddressSlot = common.BigToHash(big.NewInt(1))
+
+// ContractReader is the part of the Ethereum client used to inspect the
+// deployed contracts
+type ContractReader interface {
+	bind.ContractCaller
+	StorageAt(ctx context.Context, contract common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+}
+
+// SupportsAtomicStore tells whether the deployed data and balance contracts
+// can store and price a measurement in one transaction. The dispatchers of
+// the contracts deployed before storeInfoWithPrice was added do not know
+// its selector, and the data contract must have been given the address of
+// the balance contract with setBalanceAddress.
+func SupportsAtomicStore(backend ContractReader, dataAddr, balanceAddr common.Address) (bool, error) {
+	functions := []struct {
+		addr      common.Address
+		signature string
+	}{
+		{dataAddr, "storeInfoWithPrice(bytes32,string,string,uint256)"},
+		{balanceAddr, "setPriceFromDataContract(bytes32,uint256)"},
+	}
+
+	for _, f := range functions {
+		code, err := backend.CodeAt(context.Background(), f.addr, nil)
+		if err != nil {
+			return false, err
+		}
+
+		selector := crypto.Keccak256([]byte(f.signature))[:4]
+		if !bytes.Contains(code, append([]byte{push4}, selector...)) {
+			return false, nil
+		}
+	}
+
+	linked, err := backend.StorageAt(context.Background(), dataAddr, balanceAddressSlot, nil)
+	if err != nil {
+		return false, err
+	}
+	return common.BytesToAddress(linked) == balanceAddr, nil
+}
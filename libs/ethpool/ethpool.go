@@ -0,0 +1,579 @@
+// Package ethpool connects to several RPC endpoints (IPC, HTTP or
+// WebSocket) of the Ethereum network and fails over between them. The pool
+// implements the backends used by the contract bindings, so the bound
+// contracts keep working when an endpoint goes down.
+package ethpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrNoEndpoint is returned when no endpoint could be reached
+var ErrNoEndpoint = errors.New("None of the Ethereum RPC endpoints could be reached")
+
+// checkTimeout is the time an endpoint has to answer a health check
+const checkTimeout = 5 * time.Second
+
+// Config is the configuration of the endpoints. Endpoints are IPC paths or
+// http(s):// or ws(s):// URLs, in order of preference. HealthCheck is the
+// time between the health checks, in seconds.
+type Config struct {
+	Endpoints   []string `json:"endpoints"`
+	HealthCheck int      `json:"healthCheck"`
+}
+
+// Status is the state of an endpoint
+type Status struct {
+	Endpoint string `json:"endpoint"`
+	Healthy  bool   `json:"healthy"`
+	Error    string `json:"error,omitempty"`
+}
+
+// endpoint is a connection to an RPC endpoint
+type endpoint struct {
+	url  string
+	name string
+
+	mu      sync.Mutex
+	client  *rpc.Client
+	healthy bool
+	err     error
+}
+
+// Pool sends the requests to the first healthy endpoint. The requests that
+// fail because the endpoint cannot be reached are retried against the next
+// one. Unhealthy endpoints are dialed again by the health checks.
+type Pool struct {
+	endpoints []*endpoint
+	interval  time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Dial connects to the endpoints and starts their health checks. It fails
+// if none of them can be reached.
+func Dial(config Config) (*Pool, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	p := &Pool{
+		interval: time.Duration(config.HealthCheck) * time.Second,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, rawurl := range config.Endpoints {
+		p.endpoints = append(p.endpoints, &endpoint{url: rawurl, name: redact(rawurl)})
+	}
+
+	if p.Check(context.Background()) == 0 {
+		p.disconnect()
+		return nil, ErrNoEndpoint
+	}
+
+	go p.watch()
+	return p, nil
+}
+
+// Close stops the health checks and closes the connections
+func (p *Pool) Close() {
+	select {
+	case <-p.stop:
+		return
+	default:
+		close(p.stop)
+	}
+	<-p.done
+	p.disconnect()
+}
+
+// disconnect closes the connections to the endpoints
+func (p *Pool) disconnect() {
+	for _, e := range p.endpoints {
+		e.mu.Lock()
+		if e.client != nil {
+			e.client.Close()
+			e.client = nil
+		}
+		e.mu.Unlock()
+	}
+}
+
+// Check checks the health of every endpoint, dialing those that are not
+// connected, and returns the number of healthy ones
+func (p *Pool) Check(ctx context.Context) int {
+	healthy := 0
+	for _, e := range p.endpoints {
+		if e.check(ctx) {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// Status returns the state of the endpoints
+func (p *Pool) Status() []Status {
+	status := make([]Status, len(p.endpoints))
+	for i, e := range p.endpoints {
+		e.mu.Lock()
+		status[i] = Status{Endpoint: e.name, Healthy: e.healthy}
+		if e.err != nil {
+			status[i].Error = e.err.Error()
+		}
+		e.mu.Unlock()
+	}
+	return status
+}
+
+// watch checks the health of the endpoints periodically
+func (p *Pool) watch() {
+	defer close(p.done)
+	if p.interval <= 0 {
+		<-p.stop
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.Check(context.Background())
+		}
+	}
+}
+
+// check dials the endpoint if needed and asks for the last block
+func (e *endpoint) check(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	client, err := e.connect(ctx)
+	if err == nil {
+		var number string
+		err = client.CallContext(ctx, &number, "eth_blockNumber")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil && e.healthy {
+		log.Printf("The Ethereum RPC endpoint %s is down: %v\n", e.name, err)
+	} else if err == nil && !e.healthy && e.err != nil {
+		log.Printf("The Ethereum RPC endpoint %s is up again\n", e.name)
+	}
+	e.healthy = err == nil
+	e.err = err
+	return e.healthy
+}
+
+// connect returns the client of the endpoint, dialing it if needed
+func (e *endpoint) connect(ctx context.Context) (*rpc.Client, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.client != nil {
+		return e.client, nil
+	}
+	client, err := rpc.DialContext(ctx, e.url)
+	if err != nil {
+		return nil, err
+	}
+	e.client = client
+	return client, nil
+}
+
+// fail marks the endpoint as unhealthy after a request failed
+func (e *endpoint) fail(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.healthy {
+		log.Printf("The Ethereum RPC endpoint %s failed, trying the next one: %v\n", e.name, err)
+	}
+	e.healthy = false
+	e.err = err
+}
+
+// candidates returns the healthy endpoints, in order of preference,
+// followed by the unhealthy ones as a last resort
+func (p *Pool) candidates() []*endpoint {
+	var healthy, unhealthy []*endpoint
+	for _, e := range p.endpoints {
+		e.mu.Lock()
+		if e.healthy {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+		e.mu.Unlock()
+	}
+	return append(healthy, unhealthy...)
+}
+
+// do runs a request against the endpoints until one of them answers
+func (p *Pool) do(ctx context.Context, request func(client *ethclient.Client, raw *rpc.Client) error) error {
+	lastErr := ErrNoEndpoint
+	for _, e := range p.candidates() {
+		client, err := e.connect(ctx)
+		if err == nil {
+			err = request(ethclient.NewClient(client), client)
+			if !retryable(err) {
+				return err
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		e.fail(err)
+		lastErr = err
+	}
+	return lastErr
+}
+
+// retryable checks whether a request failed because the endpoint could not
+// be reached, rather than being answered with an error
+func retryable(err error) bool {
+	if err == nil || err == ethereum.NotFound || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return false
+	}
+	var dataErr rpc.DataError
+	return !errors.As(err, &dataErr)
+}
+
+// redact removes the credentials of an endpoint URL so that it can be logged
+func redact(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return rawurl
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
+
+// CallContext calls a method of the RPC API
+func (p *Pool) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return p.do(ctx, func(_ *ethclient.Client, raw *rpc.Client) error {
+		return raw.CallContext(ctx, result, method, args...)
+	})
+}
+
+// ChainID returns the chain ID used to sign the transactions
+func (p *Pool) ChainID(ctx context.Context) (chainID *big.Int, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		chainID, err = client.ChainID(ctx)
+		return err
+	})
+	return chainID, err
+}
+
+// BlockNumber returns the number of the latest block
+func (p *Pool) BlockNumber(ctx context.Context) (number uint64, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		number, err = client.BlockNumber(ctx)
+		return err
+	})
+	return number, err
+}
+
+// HeaderByNumber returns a block header, the latest one if number is nil
+func (p *Pool) HeaderByNumber(ctx context.Context, number *big.Int) (header *types.Header, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		header, err = client.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+// TransactionReceipt returns the receipt of a mined transaction
+func (p *Pool) TransactionReceipt(ctx context.Context, txHash common.Hash) (receipt *types.Receipt, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		receipt, err = client.TransactionReceipt(ctx, txHash)
+		return err
+	})
+	return receipt, err
+}
+
+// CodeAt returns the code of a contract
+func (p *Pool) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) (code []byte, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		code, err = client.CodeAt(ctx, contract, blockNumber)
+		return err
+	})
+	return code, err
+}
+
+// StorageAt returns the value of a storage slot of a contract
+func (p *Pool) StorageAt(ctx context.Context, contract common.Address, key common.Hash, blockNumber *big.Int) (value []byte, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		value, err = client.StorageAt(ctx, contract, key, blockNumber)
+		return err
+	})
+	return value, err
+}
+
+// CallContract executes a call to a contract
+func (p *Pool) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) (result []byte, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		result, err = client.CallContract(ctx, call, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+// PendingCodeAt returns the code of a contract in the pending state
+func (p *Pool) PendingCodeAt(ctx context.Context, contract common.Address) (code []byte, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		code, err = client.PendingCodeAt(ctx, contract)
+		return err
+	})
+	return code, err
+}
+
+// PendingCallContract executes a call to a contract in the pending state
+func (p *Pool) PendingCallContract(ctx context.Context, call ethereum.CallMsg) (result []byte, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		result, err = client.PendingCallContract(ctx, call)
+		return err
+	})
+	return result, err
+}
+
+// NonceAt returns the nonce of an account at a block, the latest one if
+// blockNumber is nil
+func (p *Pool) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (nonce uint64, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		nonce, err = client.NonceAt(ctx, account, blockNumber)
+		return err
+	})
+	return nonce, err
+}
+
+// PendingNonceAt returns the next nonce of an account
+func (p *Pool) PendingNonceAt(ctx context.Context, account common.Address) (nonce uint64, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		nonce, err = client.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+// SuggestGasPrice returns the gas price suggested by the node
+func (p *Pool) SuggestGasPrice(ctx context.Context) (price *big.Int, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		price, err = client.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+// SuggestGasTipCap returns the priority fee suggested by the node (EIP-1559)
+func (p *Pool) SuggestGasTipCap(ctx context.Context) (tip *big.Int, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		tip, err = client.SuggestGasTipCap(ctx)
+		return err
+	})
+	return tip, err
+}
+
+// EstimateGas estimates the gas needed by a transaction
+func (p *Pool) EstimateGas(ctx context.Context, call ethereum.CallMsg) (gas uint64, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		gas, err = client.EstimateGas(ctx, call)
+		return err
+	})
+	return gas, err
+}
+
+// SendTransaction sends a signed transaction. If it is retried against
+// another endpoint that already knows it, it is not sent again.
+func (p *Pool) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	attempts := 0
+	return p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		attempts++
+		err := client.SendTransaction(ctx, tx)
+		if err != nil && attempts > 1 && knownTransaction(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// knownTransaction checks whether the node rejected a transaction because
+// it already had it
+func knownTransaction(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "already known") || strings.Contains(message, "known transaction")
+}
+
+// FilterLogs returns the logs that match a query
+func (p *Pool) FilterLogs(ctx context.Context, query ethereum.FilterQuery) (logs []types.Log, err error) {
+	err = p.do(ctx, func(client *ethclient.Client, _ *rpc.Client) error {
+		logs, err = client.FilterLogs(ctx, query)
+		return err
+	})
+	return logs, err
+}
+
+// SubscribeFilterLogs subscribes to the logs that match a query. Only the
+// IPC and WebSocket endpoints support subscriptions. If the endpoint of the
+// subscription goes down, the pool subscribes again to the next one; the
+// logs emitted in between are not delivered.
+func (p *Pool) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return p.resubscribe(ctx, func(ctx context.Context, client *ethclient.Client) (ethereum.Subscription, error) {
+		return client.SubscribeFilterLogs(ctx, query, ch)
+	})
+}
+
+// SubscribeNewHead subscribes to the new blocks. Only the IPC and WebSocket
+// endpoints support subscriptions. If the endpoint of the subscription goes
+// down, the pool subscribes again to the next one.
+func (p *Pool) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return p.resubscribe(ctx, func(ctx context.Context, client *ethclient.Client) (ethereum.Subscription, error) {
+		return client.SubscribeNewHead(ctx, ch)
+	})
+}
+
+// subscribeFunc creates a subscription with the client of an endpoint
+type subscribeFunc func(ctx context.Context, client *ethclient.Client) (ethereum.Subscription, error)
+
+// Delays between the attempts to subscribe again
+const (
+	minResubscribeDelay = time.Second
+	maxResubscribeDelay = time.Minute
+)
+
+// subscribe creates a subscription in the first endpoint that supports them
+func (p *Pool) subscribe(ctx context.Context, subscribe subscribeFunc) (ethereum.Subscription, *endpoint, error) {
+	lastErr := error(rpc.ErrNotificationsUnsupported)
+	for _, e := range p.candidates() {
+		client, err := e.connect(ctx)
+		if err == nil {
+			var sub ethereum.Subscription
+			sub, err = subscribe(ctx, ethclient.NewClient(client))
+			if err == nil {
+				return sub, e, nil
+			}
+			if err == rpc.ErrNotificationsUnsupported {
+				continue
+			}
+			if !retryable(err) {
+				return nil, nil, err
+			}
+		}
+		e.fail(err)
+		lastErr = err
+	}
+	return nil, nil, fmt.Errorf("Could not subscribe: %w", lastErr)
+}
+
+// resubscription is a subscription that is moved to another endpoint when
+// its endpoint goes down. It only ends with an error when the pool is
+// closed.
+type resubscription struct {
+	unsubscribe chan struct{}
+	once        sync.Once
+	err         chan error
+	done        chan struct{}
+}
+
+// resubscribe creates a subscription in the first endpoint that supports
+// them, and creates it again in the next one every time it ends
+func (p *Pool) resubscribe(ctx context.Context, subscribe subscribeFunc) (ethereum.Subscription, error) {
+	sub, e, err := p.subscribe(ctx, subscribe)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &resubscription{
+		unsubscribe: make(chan struct{}),
+		err:         make(chan error, 1),
+		done:        make(chan struct{}),
+	}
+	go r.loop(p, subscribe, sub, e)
+	return r, nil
+}
+
+// loop follows the current subscription and replaces it when it ends
+func (r *resubscription) loop(p *Pool, subscribe subscribeFunc, sub ethereum.Subscription, e *endpoint) {
+	defer close(r.done)
+
+	for {
+		select {
+		case <-r.unsubscribe:
+			sub.Unsubscribe()
+			return
+		case <-p.stop:
+			sub.Unsubscribe()
+			r.err <- errors.New("The pool of Ethereum RPC endpoints has been closed")
+			return
+		case err := <-sub.Err():
+			if err == nil {
+				err = errors.New("the subscription was closed")
+			}
+			e.fail(err)
+			log.Printf("The subscription to the Ethereum RPC endpoint %s ended: %v\n", e.name, err)
+		}
+
+		// Subscribe again, to the next healthy endpoint if any
+		delay := minResubscribeDelay
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+			var err error
+			sub, e, err = p.subscribe(ctx, subscribe)
+			cancel()
+			if err == nil {
+				log.Printf("Subscribed again to the Ethereum RPC endpoint %s\n", e.name)
+				break
+			}
+
+			log.Printf("%v, retrying in %s\n", err, delay)
+			select {
+			case <-r.unsubscribe:
+				return
+			case <-p.stop:
+				r.err <- errors.New("The pool of Ethereum RPC endpoints has been closed")
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+			if delay > maxResubscribeDelay {
+				delay = maxResubscribeDelay
+			}
+		}
+	}
+}
+
+// Unsubscribe ends the subscription and closes its error channel
+func (r *resubscription) Unsubscribe() {
+	r.once.Do(func() {
+		close(r.unsubscribe)
+		<-r.done
+		close(r.err)
+	})
+}
+
+// Err returns the channel that receives an error if the pool is closed
+func (r *resubscription) Err() <-chan error {
+	return r.err
+}
@@ -0,0 +1,142 @@
+package lorawan
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	ngsi "administrator/ipfs-node/libs/ngsi"
+)
+
+// Field describes how a field of a measurement is encoded in the payload
+// of the uplinks of a device profile
+type Field struct {
+	Name         string  `json:"name"`
+	Index        int     `json:"index"`
+	Type         string  `json:"type"`
+	LittleEndian bool    `json:"littleEndian"`
+	Scale        float64 `json:"scale"`
+}
+
+// Profile is the decoder of a device profile. If FPorts is not empty, only
+// the uplinks sent on those ports are decoded; the devices use the other
+// ports for payloads that are not measurements.
+type Profile struct {
+	EntityType string  `json:"entityType"`
+	FPorts     []int   `json:"fPorts"`
+	Fields     []Field `json:"fields"`
+}
+
+// Config is the configuration of the LoRaWAN adapter. Profiles are the
+// decoders indexed by profile name (the device profile in ChirpStack, the
+// model ID in The Things Stack). Devices assigns a profile to a DevEUI,
+// overriding the one reported by the network server.
+type Config struct {
+	Profiles map[string]Profile `json:"profiles"`
+	Devices  map[string]string  `json:"devices"`
+}
+
+// fieldSizes is the size in bytes of the supported field types
+var fieldSizes = map[string]int{
+	"uint8":   1,
+	"int8":    1,
+	"uint16":  2,
+	"int16":   2,
+	"uint32":  4,
+	"int32":   4,
+	"float32": 4,
+}
+
+// Decode decodes the payload of an uplink with the decoder of its profile
+// and builds the measurement
+func (c Config) Decode(uplink *Uplink) (*ngsi.Measurement, error) {
+	profileName := uplink.Profile
+	if name, ok := c.Devices[uplink.DevEUI]; ok {
+		profileName = name
+	}
+
+	profile, ok := c.Profiles[profileName]
+	if !ok {
+		return nil, fmt.Errorf("No decoder configured for the profile %q of device %s", profileName, uplink.DevEUI)
+	}
+
+	if !profile.accepts(uplink.FPort) {
+		return nil, fmt.Errorf("The profile %q of device %s does not decode the uplinks on fPort %d", profileName, uplink.DevEUI, uplink.FPort)
+	}
+
+	entityType := profile.EntityType
+	if entityType == "" {
+		entityType = "Device"
+	}
+
+	m := &ngsi.Measurement{
+		ID:         "urn:ngsi-ld:" + entityType + ":" + uplink.DevEUI,
+		Type:       entityType,
+		ObservedAt: uplink.ReceivedAt.UTC().Format(time.RFC3339Nano),
+		Attributes: make(map[string]interface{}, len(profile.Fields)),
+	}
+
+	for _, field := range profile.Fields {
+		value, err := decodeField(field, uplink.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("Field %s of device %s: %v", field.Name, uplink.DevEUI, err)
+		}
+		m.Attributes[field.Name] = value
+	}
+
+	return m, nil
+}
+
+// accepts checks whether the uplinks sent on fPort are decoded
+func (p Profile) accepts(fPort int) bool {
+	if len(p.FPorts) == 0 {
+		return true
+	}
+	for _, port := range p.FPorts {
+		if port == fPort {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeField extracts the value of a field from the payload
+func decodeField(field Field, payload []byte) (float64, error) {
+	size, ok := fieldSizes[field.Type]
+	if !ok {
+		return 0, fmt.Errorf("unknown type %q", field.Type)
+	}
+	if field.Index < 0 || field.Index+size > len(payload) {
+		return 0, fmt.Errorf("the payload is %d bytes long", len(payload))
+	}
+	b := payload[field.Index : field.Index+size]
+
+	var order binary.ByteOrder = binary.BigEndian
+	if field.LittleEndian {
+		order = binary.LittleEndian
+	}
+
+	var value float64
+	switch field.Type {
+	case "uint8":
+		value = float64(b[0])
+	case "int8":
+		value = float64(int8(b[0]))
+	case "uint16":
+		value = float64(order.Uint16(b))
+	case "int16":
+		value = float64(int16(order.Uint16(b)))
+	case "uint32":
+		value = float64(order.Uint32(b))
+	case "int32":
+		value = float64(int32(order.Uint32(b)))
+	case "float32":
+		value = float64(math.Float32frombits(order.Uint32(b)))
+	}
+
+	if field.Scale != 0 {
+		value *= field.Scale
+	}
+	return value, nil
+}
@@ -0,0 +1,141 @@
+package lorawan
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Payload 0x0119 0x08 0xfff6: intensity 281, occupancy 8 %, temperature -1.0
+const (
+	chirpStackV3Uplink = `{
+  "applicationName": "traffic",
+  "deviceName": "flow-1001",
+  "deviceProfileName": "traffic-sensor",
+  "devEUI": "cHZ1dHJhZmY=",
+  "rxInfo": [{"gatewayID": "AAAAAAAAAAE=", "time": "2020-09-09T11:58:00.123Z"}],
+  "fPort": 2,
+  "data": "ARkI//Y="
+}`
+	chirpStackV4Uplink = `{
+  "time": "2020-09-09T11:58:01Z",
+  "deviceInfo": {"deviceProfileName": "traffic-sensor", "devEui": "7076757472616666"},
+  "rxInfo": [{"gatewayId": "0000000000000001", "gwTime": "2020-09-09T11:58:00.123Z"}],
+  "fPort": 2,
+  "data": "ARkI//Y="
+}`
+	ttnUplinkMessage = `{
+  "end_device_ids": {"device_id": "flow-1001", "dev_eui": "7076757472616666"},
+  "received_at": "2020-09-09T11:58:01Z",
+  "uplink_message": {
+    "f_port": 2,
+    "frm_payload": "ARkI//Y=",
+    "rx_metadata": [{"gateway_ids": {"gateway_id": "gw"}, "time": "2020-09-09T11:58:00.123Z"}],
+    "version_ids": {"model_id": "traffic-sensor"}
+  }
+}`
+)
+
+var testConfig = Config{
+	Profiles: map[string]Profile{
+		"traffic-sensor": {
+			EntityType: "TrafficFlowObserved",
+			Fields: []Field{
+				{Name: "intensity", Index: 0, Type: "uint16"},
+				{Name: "occupancy", Index: 2, Type: "uint8", Scale: 0.01},
+				{Name: "temperature", Index: 3, Type: "int16", Scale: 0.1},
+			},
+		},
+	},
+}
+
+func TestNetworkServerFormatsDecodeConsistently(t *testing.T) {
+	parsers := map[string]func([]byte) (*Uplink, error){
+		"chirpstack v3": ParseChirpStack,
+		"chirpstack v4": ParseChirpStack,
+		"ttn":           ParseTTN,
+	}
+	bodies := map[string]string{
+		"chirpstack v3": chirpStackV3Uplink,
+		"chirpstack v4": chirpStackV4Uplink,
+		"ttn":           ttnUplinkMessage,
+	}
+
+	for name, parse := range parsers {
+		uplink, err := parse([]byte(bodies[name]))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		m, err := testConfig.Decode(uplink)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if m.ID != "urn:ngsi-ld:TrafficFlowObserved:7076757472616666" {
+			t.Errorf("%s: unexpected id %s", name, m.ID)
+		}
+		if m.ObservedAt != "2020-09-09T11:58:00.123Z" {
+			t.Errorf("%s: unexpected observation date %s", name, m.ObservedAt)
+		}
+
+		attributes, _ := json.Marshal(m.Attributes)
+		if string(attributes) != `{"intensity":281,"occupancy":0.08,"temperature":-1}` {
+			t.Errorf("%s: unexpected attributes %s", name, attributes)
+		}
+	}
+}
+
+func TestDevicesOverrideProfile(t *testing.T) {
+	config := Config{
+		Profiles: testConfig.Profiles,
+		Devices:  map[string]string{"7076757472616666": "traffic-sensor"},
+	}
+
+	uplink, err := ParseChirpStack([]byte(chirpStackV3Uplink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uplink.Profile = "unknown"
+
+	if _, err := config.Decode(uplink); err != nil {
+		t.Error(err)
+	}
+	if _, err := testConfig.Decode(uplink); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+}
+
+func TestShortPayload(t *testing.T) {
+	uplink := &Uplink{DevEUI: "7076757472616666", Profile: "traffic-sensor", Payload: []byte{1, 2}}
+	if _, err := testConfig.Decode(uplink); err == nil {
+		t.Error("expected an error for a short payload")
+	}
+}
+
+func TestProfileRestrictsFPorts(t *testing.T) {
+	profile := testConfig.Profiles["traffic-sensor"]
+	profile.FPorts = []int{2, 3}
+	config := Config{Profiles: map[string]Profile{"traffic-sensor": profile}}
+
+	uplink := &Uplink{DevEUI: "7076757472616666", Profile: "traffic-sensor", FPort: 3, Payload: []byte{1, 2, 3, 4, 5}}
+	if _, err := config.Decode(uplink); err != nil {
+		t.Error(err)
+	}
+
+	uplink.FPort = 1
+	if _, err := config.Decode(uplink); err == nil {
+		t.Error("expected an error for an uplink on another fPort")
+	}
+	if _, err := testConfig.Decode(uplink); err != nil {
+		t.Errorf("a profile without fPorts refused the uplink: %v", err)
+	}
+}
+
+func TestNonUplinkEvents(t *testing.T) {
+	if _, err := ParseChirpStack([]byte(`{"type": "join"}`)); err != ErrNotUplink {
+		t.Errorf("expected ErrNotUplink, got %v", err)
+	}
+	if _, err := ParseTTN([]byte(`{"join_accept": {}}`)); err != ErrNotUplink {
+		t.Errorf("expected ErrNotUplink, got %v", err)
+	}
+}
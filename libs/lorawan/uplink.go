@@ -0,0 +1,167 @@
+// Package lorawan converts the uplinks delivered by the HTTP integrations
+// of the LoRaWAN network servers (ChirpStack and The Things Stack) into
+// measurements
+package lorawan
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotUplink is returned when the event delivered by the network server
+// is not an uplink (joins, acks, status events, ...)
+var ErrNotUplink = errors.New("The event is not an uplink")
+
+// Uplink is an uplink received from a device
+type Uplink struct {
+	DevEUI     string
+	Profile    string
+	FPort      int
+	Payload    []byte
+	ReceivedAt time.Time
+}
+
+// chirpStackUplink covers the uplink events of ChirpStack v3 (devEUI,
+// deviceProfileName, rxInfo[].time) and v4 (deviceInfo, rxInfo[].gwTime)
+type chirpStackUplink struct {
+	DevEUI            string `json:"devEUI"`
+	DeviceProfileName string `json:"deviceProfileName"`
+	DeviceInfo        *struct {
+		DevEUI            string `json:"devEui"`
+		DeviceProfileName string `json:"deviceProfileName"`
+	} `json:"deviceInfo"`
+	FPort  int    `json:"fPort"`
+	Data   string `json:"data"`
+	Time   string `json:"time"`
+	RxInfo []struct {
+		Time   string `json:"time"`
+		GwTime string `json:"gwTime"`
+	} `json:"rxInfo"`
+}
+
+// ttnUplink covers the uplink messages of The Things Stack v3
+type ttnUplink struct {
+	EndDeviceIDs struct {
+		DeviceID string `json:"device_id"`
+		DevEUI   string `json:"dev_eui"`
+	} `json:"end_device_ids"`
+	ReceivedAt    string `json:"received_at"`
+	UplinkMessage *struct {
+		FPort      int    `json:"f_port"`
+		FrmPayload string `json:"frm_payload"`
+		ReceivedAt string `json:"received_at"`
+		RxMetadata []struct {
+			Time string `json:"time"`
+		} `json:"rx_metadata"`
+		VersionIDs struct {
+			ModelID string `json:"model_id"`
+		} `json:"version_ids"`
+	} `json:"uplink_message"`
+}
+
+// ParseChirpStack parses an uplink event of the ChirpStack HTTP integration
+func ParseChirpStack(body []byte) (*Uplink, error) {
+	var event chirpStackUplink
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+
+	uplink := &Uplink{
+		DevEUI:  event.DevEUI,
+		Profile: event.DeviceProfileName,
+		FPort:   event.FPort,
+	}
+	if event.DeviceInfo != nil {
+		uplink.DevEUI = event.DeviceInfo.DevEUI
+		uplink.Profile = event.DeviceInfo.DeviceProfileName
+	}
+	if uplink.DevEUI == "" {
+		return nil, ErrNotUplink
+	}
+
+	var err error
+	if uplink.DevEUI, err = normalizeDevEUI(uplink.DevEUI); err != nil {
+		return nil, err
+	}
+	if uplink.Payload, err = base64.StdEncoding.DecodeString(event.Data); err != nil {
+		return nil, fmt.Errorf("invalid uplink data: %v", err)
+	}
+
+	// Use the time at which a gateway received the uplink. The time of
+	// the network server is only used if no gateway reports it.
+	var times []string
+	for _, rx := range event.RxInfo {
+		times = append(times, rx.Time, rx.GwTime)
+	}
+	times = append(times, event.Time)
+	if uplink.ReceivedAt, err = firstTime(times); err != nil {
+		return nil, err
+	}
+
+	return uplink, nil
+}
+
+// ParseTTN parses an uplink message of a The Things Stack webhook
+func ParseTTN(body []byte) (*Uplink, error) {
+	var event ttnUplink
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+
+	if event.UplinkMessage == nil {
+		return nil, ErrNotUplink
+	}
+	msg := event.UplinkMessage
+
+	uplink := &Uplink{
+		Profile: msg.VersionIDs.ModelID,
+		FPort:   msg.FPort,
+	}
+
+	var err error
+	if uplink.DevEUI, err = normalizeDevEUI(event.EndDeviceIDs.DevEUI); err != nil {
+		return nil, err
+	}
+	if uplink.Payload, err = base64.StdEncoding.DecodeString(msg.FrmPayload); err != nil {
+		return nil, fmt.Errorf("invalid uplink payload: %v", err)
+	}
+
+	var times []string
+	for _, rx := range msg.RxMetadata {
+		times = append(times, rx.Time)
+	}
+	times = append(times, msg.ReceivedAt, event.ReceivedAt)
+	if uplink.ReceivedAt, err = firstTime(times); err != nil {
+		return nil, err
+	}
+
+	return uplink, nil
+}
+
+// normalizeDevEUI converts a DevEUI, encoded either as hex or as base64, to
+// lower case hex
+func normalizeDevEUI(devEUI string) (string, error) {
+	if b, err := hex.DecodeString(devEUI); err == nil && len(b) == 8 {
+		return hex.EncodeToString(b), nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(devEUI); err == nil && len(b) == 8 {
+		return hex.EncodeToString(b), nil
+	}
+	return "", fmt.Errorf("invalid DevEUI %q", devEUI)
+}
+
+// firstTime parses the first non empty time of the list
+func firstTime(times []string) (time.Time, error) {
+	for _, t := range times {
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+		return time.Parse(time.RFC3339Nano, t)
+	}
+	return time.Time{}, errors.New("The uplink does not contain a receive time")
+}
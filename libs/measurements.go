@@ -0,0 +1,46 @@
+package libs
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// LedgerRecord is the record of a measurement stored in the data contract
+type LedgerRecord struct {
+	URI         string
+	Description string
+	Addr        common.Address
+}
+
+// OnChainMeasurement is the information of a measurement stored in the
+// smart contracts of the marketplace
+type OnChainMeasurement struct {
+	Stored bool
+	Price  *big.Int
+	Ledger LedgerRecord
+}
+
+// GetOnChainMeasurement reads the ledger record and the current price of a
+// measurement from the Blockchain
+func GetOnChainMeasurement(ethClient ComponentConfig, hash [32]byte) (*OnChainMeasurement, error) {
+	record, err := ethClient.DataCon.Ledger(nil, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	price, err := ethClient.BalanceCon.GetPriceMeasurement(nil, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OnChainMeasurement{
+		Stored: record.Uri != "",
+		Price:  price,
+		Ledger: LedgerRecord{
+			URI:         record.Uri,
+			Description: record.Description,
+			Addr:        record.Addr,
+		},
+	}, nil
+}
@@ -0,0 +1,131 @@
+// Package merkle builds Merkle trees of measurement hashes and verifies the
+// inclusion proofs of the measurements against the root of their tree.
+//
+// Leaves and inner nodes are hashed with Keccak-256 under different
+// prefixes, so an inner node cannot be passed off as a leaf. The last node
+// of a level with an odd number of nodes is promoted to the next level
+// unchanged.
+package merkle
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Prefixes of the hashed nodes
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// ErrEmpty is returned when a tree is built without leaves
+var ErrEmpty = errors.New("A Merkle tree needs at least one leaf")
+
+// Proof proves that Leaf is the leaf Index of a tree of Size leaves.
+// Siblings are the nodes needed to compute the root, from the bottom up.
+type Proof struct {
+	Leaf     common.Hash   `json:"leaf"`
+	Index    uint64        `json:"index"`
+	Size     uint64        `json:"size"`
+	Siblings []common.Hash `json:"siblings"`
+}
+
+// Tree is a Merkle tree. levels[0] are the hashed leaves and the last
+// level is the root.
+type Tree struct {
+	leaves []common.Hash
+	levels [][]common.Hash
+}
+
+// New builds the tree of the given leaves, in order
+func New(leaves []common.Hash) (*Tree, error) {
+	if len(leaves) == 0 {
+		return nil, ErrEmpty
+	}
+
+	level := make([]common.Hash, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = hashLeaf(leaf)
+	}
+
+	t := &Tree{leaves: append([]common.Hash(nil), leaves...)}
+	t.levels = append(t.levels, level)
+	for len(level) > 1 {
+		next := make([]common.Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, hashNode(level[i], level[i+1]))
+			}
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+
+	return t, nil
+}
+
+// Root returns the root of the tree
+func (t *Tree) Root() common.Hash {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// Proof returns the inclusion proof of the leaf index
+func (t *Tree) Proof(index int) Proof {
+	proof := Proof{
+		Leaf:  t.leaves[index],
+		Index: uint64(index),
+		Size:  uint64(len(t.leaves)),
+	}
+
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Siblings = append(proof.Siblings, level[sibling])
+		}
+		index /= 2
+	}
+	return proof
+}
+
+// Verify checks that the proof leads to root
+func Verify(root common.Hash, proof Proof) bool {
+	if proof.Index >= proof.Size {
+		return false
+	}
+
+	node := hashLeaf(proof.Leaf)
+	index, size := proof.Index, proof.Size
+	siblings := proof.Siblings
+	for size > 1 {
+		// The last node of an odd level has no sibling
+		if !(index%2 == 0 && index == size-1) {
+			if len(siblings) == 0 {
+				return false
+			}
+			if index%2 == 0 {
+				node = hashNode(node, siblings[0])
+			} else {
+				node = hashNode(siblings[0], node)
+			}
+			siblings = siblings[1:]
+		}
+		index /= 2
+		size = (size + 1) / 2
+	}
+
+	return len(siblings) == 0 && node == root
+}
+
+// hashLeaf hashes a leaf of the tree
+func hashLeaf(leaf common.Hash) common.Hash {
+	return crypto.Keccak256Hash([]byte{leafPrefix}, leaf[:])
+}
+
+// hashNode hashes an inner node of the tree
+func hashNode(left, right common.Hash) common.Hash {
+	return crypto.Keccak256Hash([]byte{nodePrefix}, left[:], right[:])
+}
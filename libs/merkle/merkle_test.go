@@ -0,0 +1,79 @@
+package merkle
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// leaves returns n different leaves
+func leaves(n int) []common.Hash {
+	hashes := make([]common.Hash, n)
+	for i := range hashes {
+		hashes[i] = crypto.Keccak256Hash([]byte{byte(i)})
+	}
+	return hashes
+}
+
+func TestProofs(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		tree, err := New(leaves(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < n; i++ {
+			proof := tree.Proof(i)
+			if !Verify(tree.Root(), proof) {
+				t.Errorf("%d leaves: the proof of leaf %d is not valid", n, i)
+			}
+		}
+	}
+}
+
+func TestTamperedProofs(t *testing.T) {
+	tree, err := New(leaves(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root()
+
+	cases := map[string]func(p *Proof){
+		"other leaf":     func(p *Proof) { p.Leaf[0] ^= 1 },
+		"other index":    func(p *Proof) { p.Index = 2 },
+		"other size":     func(p *Proof) { p.Size = 4 },
+		"index too big":  func(p *Proof) { p.Index = 5 },
+		"other sibling":  func(p *Proof) { p.Siblings[0][0] ^= 1 },
+		"extra sibling":  func(p *Proof) { p.Siblings = append(p.Siblings, root) },
+		"missing levels": func(p *Proof) { p.Siblings = p.Siblings[:1] },
+	}
+	for name, tamper := range cases {
+		proof := tree.Proof(3)
+		proof.Siblings = append([]common.Hash(nil), proof.Siblings...)
+		tamper(&proof)
+		if Verify(root, proof) {
+			t.Errorf("%s: the tampered proof is valid", name)
+		}
+	}
+}
+
+func TestInnerNodesAreNotLeaves(t *testing.T) {
+	tree, err := New(leaves(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first inner node, proven as a leaf of the upper level
+	inner := tree.levels[1]
+	forged := Proof{Leaf: inner[0], Index: 0, Size: 2, Siblings: []common.Hash{inner[1]}}
+	if Verify(tree.Root(), forged) {
+		t.Error("an inner node was accepted as a leaf")
+	}
+}
+
+func TestEmptyTree(t *testing.T) {
+	if _, err := New(nil); err != ErrEmpty {
+		t.Errorf("expected ErrEmpty, got %v", err)
+	}
+}
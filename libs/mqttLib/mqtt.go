@@ -0,0 +1,149 @@
+// Package mqttLib subscribes to the MQTT topics where the field gateways
+// publish their measurements and hands the payloads to the proxy
+package mqttLib
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// ErrRejected must be wrapped by the AcceptFunc when a payload can never be
+// accepted (e.g. it is not a valid measurement). Those messages are
+// acknowledged and dropped instead of being retried.
+var ErrRejected = errors.New("The payload has been rejected")
+
+// Backoff applied while a payload cannot be accepted
+const (
+	minRetryDelay = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+// Config is the configuration of the MQTT listener
+type Config struct {
+	BrokerURL string   `json:"brokerURL"`
+	ClientID  string   `json:"clientID"`
+	Username  string   `json:"username"`
+	Password  string   `json:"password"`
+	Topics    []string `json:"topics"`
+	QoS       byte     `json:"qos"`
+}
+
+// AcceptFunc durably accepts the payload of a message. Messages are only
+// acknowledged once it returns without error or with ErrRejected.
+type AcceptFunc func(topic string, payload []byte) error
+
+// Listener feeds the messages of the subscribed topics to an AcceptFunc
+type Listener struct {
+	config Config
+	accept AcceptFunc
+	client mqtt.Client
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewListener creates a listener. Call Start to connect it to the broker.
+func NewListener(config Config, accept AcceptFunc) *Listener {
+	return &Listener{
+		config: config,
+		accept: accept,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start connects to the broker and subscribes to the configured topics. The
+// subscriptions are renewed every time the client reconnects.
+func (l *Listener) Start() error {
+	if len(l.config.Topics) == 0 {
+		return errors.New("No MQTT topics have been configured")
+	}
+	if l.config.QoS > 2 {
+		return fmt.Errorf("Invalid MQTT QoS %d", l.config.QoS)
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(l.config.BrokerURL).
+		SetClientID(l.config.ClientID).
+		SetUsername(l.config.Username).
+		SetPassword(l.config.Password).
+		// Keep the session so that the broker redelivers the messages
+		// that were not acknowledged before a disconnection
+		SetCleanSession(false).
+		// Handle every message in its own goroutine, so that a payload
+		// that is being retried does not hold back the others nor the
+		// client. The broker bounds the messages in flight.
+		SetOrderMatters(false).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(l.subscribe)
+
+	l.client = mqtt.NewClient(opts)
+	token := l.client.Connect()
+	token.Wait()
+	return token.Error()
+}
+
+// Stop disconnects from the broker. Messages that have not been accepted
+// are not acknowledged, so the broker delivers them again.
+func (l *Listener) Stop() {
+	l.stopOnce.Do(func() {
+		// Disconnect before releasing the pending handlers so that their
+		// acknowledgements are not sent to the broker
+		if l.client != nil {
+			l.client.Disconnect(250)
+		}
+		close(l.stop)
+	})
+}
+
+// subscribe subscribes to the configured topics
+func (l *Listener) subscribe(client mqtt.Client) {
+	filters := make(map[string]byte, len(l.config.Topics))
+	for _, topic := range l.config.Topics {
+		filters[topic] = l.config.QoS
+	}
+
+	token := client.SubscribeMultiple(filters, l.handleMessage)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		log.Printf("Could not subscribe to the MQTT topics: %v\n", err)
+		return
+	}
+
+	log.Printf("Subscribed to the MQTT topics %v\n", l.config.Topics)
+}
+
+// handleMessage passes a message to the AcceptFunc. The client acknowledges
+// the message when this function returns, so it does not return until the
+// payload has been accepted, rejected, or the listener is stopped. It runs
+// in its own goroutine, so the retries only delay this message.
+func (l *Listener) handleMessage(client mqtt.Client, msg mqtt.Message) {
+	delay := minRetryDelay
+	for {
+		err := l.accept(msg.Topic(), msg.Payload())
+		if err == nil {
+			return
+		}
+
+		if errors.Is(err, ErrRejected) {
+			log.Printf("Dropping MQTT message from %s: %v\n", msg.Topic(), err)
+			return
+		}
+
+		log.Printf("Could not accept MQTT message from %s, retrying in %s: %v\n", msg.Topic(), delay, err)
+		select {
+		case <-l.stop:
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package mqttLib
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// standInBroker is a minimal MQTT broker that accepts one client,
+// acknowledges its subscriptions and publishes QoS 1 messages to it, with
+// the IDs 42, 43...
+type standInBroker struct {
+	listener net.Listener
+	pubacks  chan uint16
+}
+
+func newStandInBroker(t *testing.T, topic string, payloads ...[]byte) *standInBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &standInBroker{listener: listener, pubacks: make(chan uint16, len(payloads))}
+	go b.serve(topic, payloads)
+	return b
+}
+
+func (b *standInBroker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *standInBroker) serve(topic string, payloads [][]byte) {
+	conn, err := b.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			connack.Write(conn)
+		case *packets.SubscribePacket:
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = p.MessageID
+			suback.ReturnCodes = p.Qoss
+			suback.Write(conn)
+
+			for i, payload := range payloads {
+				publish := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+				publish.TopicName = topic
+				publish.Qos = 1
+				publish.MessageID = uint16(42 + i)
+				publish.Payload = payload
+				publish.Write(conn)
+			}
+		case *packets.PubackPacket:
+			b.pubacks <- p.MessageID
+		case *packets.PingreqPacket:
+			packets.NewControlPacket(packets.Pingresp).Write(conn)
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func TestMessageIsAcknowledgedAfterAcceptance(t *testing.T) {
+	broker := newStandInBroker(t, "sensors/1", []byte(`{"id": "urn:1"}`))
+	defer broker.listener.Close()
+
+	// The first attempt fails, so the message must not be acknowledged
+	// until the second one succeeds
+	var mu sync.Mutex
+	attempts := 0
+	accepted := make(chan time.Time, 1)
+	accept := func(topic string, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			return fmt.Errorf("disk full")
+		}
+		accepted <- time.Now()
+		return nil
+	}
+
+	listener := NewListener(Config{
+		BrokerURL: broker.url(),
+		ClientID:  "test",
+		Topics:    []string{"sensors/#"},
+		QoS:       1,
+	}, accept)
+	if err := listener.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Stop()
+
+	select {
+	case id := <-broker.pubacks:
+		if id != 42 {
+			t.Errorf("unexpected message id %d", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message was not acknowledged")
+	}
+
+	select {
+	case <-accepted:
+	default:
+		t.Fatal("the message was acknowledged before it was accepted")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRejectedMessagesAreDropped(t *testing.T) {
+	broker := newStandInBroker(t, "sensors/1", []byte(`not json`))
+	defer broker.listener.Close()
+
+	listener := NewListener(Config{
+		BrokerURL: broker.url(),
+		ClientID:  "test",
+		Topics:    []string{"sensors/#"},
+		QoS:       1,
+	}, func(topic string, payload []byte) error {
+		return fmt.Errorf("%w: invalid JSON", ErrRejected)
+	})
+	if err := listener.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Stop()
+
+	select {
+	case <-broker.pubacks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the rejected message was not acknowledged")
+	}
+}
+
+func TestRetriesDoNotBlockOtherMessages(t *testing.T) {
+	broker := newStandInBroker(t, "sensors/1", []byte(`stuck`), []byte(`{"id": "urn:2"}`))
+	defer broker.listener.Close()
+
+	// The first message cannot be accepted while the second one is
+	listener := NewListener(Config{
+		BrokerURL: broker.url(),
+		ClientID:  "test",
+		Topics:    []string{"sensors/#"},
+		QoS:       1,
+	}, func(topic string, payload []byte) error {
+		if string(payload) == "stuck" {
+			return fmt.Errorf("queue unavailable")
+		}
+		return nil
+	})
+	if err := listener.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Stop()
+
+	select {
+	case id := <-broker.pubacks:
+		if id != 43 {
+			t.Errorf("unexpected message id %d", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second message was blocked by the retries of the first one")
+	}
+}
+
+func TestStartRequiresTopics(t *testing.T) {
+	listener := NewListener(Config{BrokerURL: "tcp://127.0.0.1:1"}, nil)
+	if err := listener.Start(); err == nil {
+		t.Error("expected an error")
+	}
+}
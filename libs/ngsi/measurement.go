@@ -0,0 +1,303 @@
+package ngsi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Input formats understood by the normalizer
+const (
+	FormatAuto   = "auto"
+	FormatNGSIv2 = "ngsiv2"
+	FormatNGSILD = "ngsi-ld"
+)
+
+// Attributes that are handled by the normalizer itself or that are only
+// bookkeeping of the context broker. They are not part of the measurement.
+var skippedAttributes = map[string]bool{
+	"id":           true,
+	"type":         true,
+	"@context":     true,
+	"dateObserved": true,
+	"dateModified": true,
+	"dateCreated":  true,
+	"createdAt":    true,
+	"modifiedAt":   true,
+	"observedAt":   true,
+}
+
+// Measurement is the canonical representation of a measurement. Entities
+// received in any of the supported formats are converted to it before they
+// are signed, hashed and described, so the same reading produces the same
+// result regardless of the format used by the sensor. SignatureScheme is
+// the scheme of the signature of the producer appended to the stored
+// document, set when it is not the signature of the hash of the document
+// itself.
+type Measurement struct {
+	ID              string                 `json:"id"`
+	Type            string                 `json:"type"`
+	ObservedAt      string                 `json:"observedAt"`
+	Attributes      map[string]interface{} `json:"attributes"`
+	Provenance      *Provenance            `json:"provenance,omitempty"`
+	SignatureScheme string                 `json:"signatureScheme,omitempty"`
+}
+
+// Provenance is the signature of the sensor that sent the measurement. The
+// body signed by the sensor may hold many measurements, so it is not copied
+// into each of them: it is stored once in IPFS, encrypted with BodyKey, and
+// referenced by BodyCID. BodyHash is its Keccak-256 hash. Buyers can fetch
+// it, verify the signature and normalize the body again to check that it
+// matches the measurement. Body is the signed body until it is stored; it
+// is not encoded.
+type Provenance struct {
+	SensorID  string `json:"sensorId"`
+	Algorithm string `json:"algorithm"`
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+	BodyHash  string `json:"bodyHash"`
+	BodyCID   string `json:"bodyCid,omitempty"`
+	BodyKey   string `json:"bodyKey,omitempty"`
+	Signature string `json:"signature"`
+	Body      []byte `json:"-"`
+}
+
+// Marshal returns the canonical JSON encoding of the measurement. The keys
+// of the attributes are sorted, so the encoding is deterministic. The
+// provenance and the signature scheme are not part of it: the same reading
+// has the same encoding whether it was signed by the sensor or not, and
+// whatever the signer of the producer.
+func (m *Measurement) Marshal() ([]byte, error) {
+	canonical := *m
+	canonical.Provenance = nil
+	canonical.SignatureScheme = ""
+	return json.Marshal(&canonical)
+}
+
+// MarshalDocument returns the JSON document stored for the measurement:
+// the canonical encoding plus the provenance and the signature scheme, if
+// any
+func (m *Measurement) MarshalDocument() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// DetectFormat guesses the format of an entity. NGSI-LD entities carry a
+// @context, attributes typed as Property or GeoProperty, or relationships
+// that point to an object (NGSIv2 relationships carry a value instead).
+func DetectFormat(entity map[string]interface{}) string {
+	if _, ok := entity["@context"]; ok {
+		return FormatNGSILD
+	}
+
+	for name, attr := range entity {
+		if skippedAttributes[name] {
+			continue
+		}
+		attrMap, ok := attr.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch attrMap["type"] {
+		case "Property", "GeoProperty":
+			return FormatNGSILD
+		case "Relationship":
+			if _, ok := attrMap["object"]; ok {
+				return FormatNGSILD
+			}
+		}
+	}
+
+	return FormatNGSIv2
+}
+
+// Normalize converts an entity in the given format to a Measurement. If the
+// format is FormatAuto, it is detected from the entity.
+func Normalize(entity map[string]interface{}, format string) (*Measurement, error) {
+	if entity == nil {
+		return nil, errors.New("The entity is not a JSON object")
+	}
+
+	if format == "" || format == FormatAuto {
+		format = DetectFormat(entity)
+	}
+
+	switch format {
+	case FormatNGSIv2:
+		return normalizeNGSIv2(entity)
+	case FormatNGSILD:
+		return normalizeNGSILD(entity)
+	default:
+		return nil, fmt.Errorf("Unknown input format %q", format)
+	}
+}
+
+// normalizeNGSIv2 converts a normalized or keyValues NGSIv2 entity
+func normalizeNGSIv2(entity map[string]interface{}) (*Measurement, error) {
+	m, err := newMeasurement(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	// The observation date is stored in the dateObserved attribute
+	dateObserved := entity["dateObserved"]
+	if attr, ok := dateObserved.(map[string]interface{}); ok {
+		dateObserved = attr["value"]
+	}
+	m.ObservedAt, err = normalizeTime(dateObserved)
+	if err != nil {
+		return nil, fmt.Errorf("The measurement does not contain a valid dateObserved: %v", err)
+	}
+
+	for name, attr := range entity {
+		if skippedAttributes[name] {
+			continue
+		}
+
+		// Normalized entities wrap the value together with its type and
+		// metadata. The keyValues representation contains the value only.
+		if attrMap, ok := attr.(map[string]interface{}); ok {
+			if value, ok := attrMap["value"]; ok {
+				m.Attributes[name] = value
+				continue
+			}
+		}
+		m.Attributes[name] = attr
+	}
+
+	return m, nil
+}
+
+// normalizeNGSILD converts an NGSI-LD entity
+func normalizeNGSILD(entity map[string]interface{}) (*Measurement, error) {
+	m, err := newMeasurement(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the dateObserved property if it is present. Otherwise, the
+	// measurement was observed when its latest property was observed.
+	var latest time.Time
+	if dateObserved, ok := entity["dateObserved"]; ok {
+		latest, err = parseTime(ldValue(dateObserved))
+		if err != nil {
+			return nil, fmt.Errorf("The measurement does not contain a valid dateObserved: %v", err)
+		}
+	}
+
+	for name, attr := range entity {
+		if skippedAttributes[name] {
+			continue
+		}
+
+		m.Attributes[name] = ldValue(attr)
+
+		if _, ok := entity["dateObserved"]; ok {
+			continue
+		}
+		for _, instance := range ldInstances(attr) {
+			observedAt, ok := instance["observedAt"]
+			if !ok {
+				continue
+			}
+			t, err := parseTime(observedAt)
+			if err != nil {
+				return nil, fmt.Errorf("Attribute %s does not contain a valid observedAt: %v", name, err)
+			}
+			if t.After(latest) {
+				latest = t
+			}
+		}
+	}
+
+	if latest.IsZero() {
+		return nil, errors.New("The measurement does not contain a valid observedAt")
+	}
+	m.ObservedAt = latest.UTC().Format(time.RFC3339Nano)
+
+	return m, nil
+}
+
+// newMeasurement creates a measurement with the identity of the entity
+func newMeasurement(entity map[string]interface{}) (*Measurement, error) {
+	id, ok := entity["id"].(string)
+	if !ok || id == "" {
+		return nil, errors.New("The measurement does not contain a valid id")
+	}
+
+	entityType, _ := entity["type"].(string)
+
+	return &Measurement{
+		ID:         id,
+		Type:       entityType,
+		Attributes: make(map[string]interface{}),
+	}, nil
+}
+
+// ldInstances returns the instances of an NGSI-LD attribute. Attributes
+// with several datasetIds are encoded as arrays.
+func ldInstances(attr interface{}) []map[string]interface{} {
+	switch v := attr.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		instances := make([]map[string]interface{}, 0, len(v))
+		for _, item := range v {
+			if instance, ok := item.(map[string]interface{}); ok {
+				instances = append(instances, instance)
+			}
+		}
+		return instances
+	default:
+		return nil
+	}
+}
+
+// ldValue extracts the value of an NGSI-LD attribute: the value of
+// properties, the object of relationships and the @value of typed literals
+func ldValue(attr interface{}) interface{} {
+	switch v := attr.(type) {
+	case map[string]interface{}:
+		if value, ok := v["@value"]; ok {
+			return value
+		}
+		switch v["type"] {
+		case "Property", "GeoProperty":
+			return ldValue(v["value"])
+		case "Relationship":
+			return v["object"]
+		}
+		return v
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = ldValue(item)
+		}
+		return values
+	default:
+		return v
+	}
+}
+
+// normalizeTime converts a date to RFC 3339 in UTC
+func normalizeTime(value interface{}) (string, error) {
+	t, err := parseTime(value)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format(time.RFC3339Nano), nil
+}
+
+// parseTime parses an ISO 8601 date
+func parseTime(value interface{}) (time.Time, error) {
+	if attr, ok := value.(map[string]interface{}); ok {
+		value = attr["@value"]
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return time.Time{}, errors.New("the date is not a string")
+	}
+
+	return time.Parse(time.RFC3339Nano, str)
+}
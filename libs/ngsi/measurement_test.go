@@ -0,0 +1,140 @@
+package ngsi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const ngsiv2Entity = `{
+  "id": "urn:ngsi-ld:TrafficFlowObserved:santander:traffic:flow:1001",
+  "type": "TrafficFlowObserved",
+  "dateModified": {"type": "ISO8601", "value": "2020-09-09T11:58:00.00Z", "metadata": {}},
+  "dateObserved": {"type": "ISO8601", "value": "2020-09-09T11:58:00.00Z", "metadata": {}},
+  "intensity": {"type": "Number", "value": 281, "metadata": {}},
+  "location": {"type": "geo:json", "value": {"type": "Point", "coordinates": [-3.8295937, 43.4535859]}, "metadata": {}},
+  "refRoadSegment": {"type": "Relationship", "value": "urn:ngsi-ld:RoadSegment:1"}
+}`
+
+const ngsiLDEntity = `{
+  "@context": ["https://smartdatamodels.org/context.jsonld"],
+  "id": "urn:ngsi-ld:TrafficFlowObserved:santander:traffic:flow:1001",
+  "type": "TrafficFlowObserved",
+  "modifiedAt": "2020-09-09T12:00:00Z",
+  "intensity": {"type": "Property", "value": 281, "observedAt": "2020-09-09T11:58:00Z"},
+  "location": {"type": "GeoProperty", "value": {"type": "Point", "coordinates": [-3.8295937, 43.4535859]}},
+  "refRoadSegment": {"type": "Relationship", "object": "urn:ngsi-ld:RoadSegment:1"}
+}`
+
+func decodeEntity(t *testing.T, str string) map[string]interface{} {
+	t.Helper()
+	entity := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(str), &entity); err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+func TestDetectFormat(t *testing.T) {
+	if format := DetectFormat(decodeEntity(t, ngsiv2Entity)); format != FormatNGSIv2 {
+		t.Errorf("expected %s, got %s", FormatNGSIv2, format)
+	}
+	if format := DetectFormat(decodeEntity(t, ngsiLDEntity)); format != FormatNGSILD {
+		t.Errorf("expected %s, got %s", FormatNGSILD, format)
+	}
+}
+
+func TestNormalizeFormatsConsistently(t *testing.T) {
+	v2, err := Normalize(decodeEntity(t, ngsiv2Entity), FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := Normalize(decodeEntity(t, ngsiLDEntity), FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v2.ObservedAt != "2020-09-09T11:58:00Z" {
+		t.Errorf("unexpected observation date %s", v2.ObservedAt)
+	}
+
+	v2JSON, err := v2.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ldJSON, err := ld.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v2JSON) != string(ldJSON) {
+		t.Errorf("formats are not normalized consistently:\n%s\n%s", v2JSON, ldJSON)
+	}
+}
+
+func TestNormalizeRejectsInvalidEntities(t *testing.T) {
+	cases := map[string]string{
+		"missing id":         `{"type": "T", "dateObserved": {"value": "2020-09-09T11:58:00Z"}}`,
+		"missing date":       `{"id": "urn:1", "type": "T"}`,
+		"invalid date":       `{"id": "urn:1", "type": "T", "dateObserved": {"value": "yesterday"}}`,
+		"ld without dates":   `{"@context": [], "id": "urn:1", "type": "T", "a": {"type": "Property", "value": 1}}`,
+		"ld invalid observe": `{"@context": [], "id": "urn:1", "type": "T", "a": {"type": "Property", "value": 1, "observedAt": 3}}`,
+	}
+
+	for name, entity := range cases {
+		if _, err := Normalize(decodeEntity(t, entity), FormatAuto); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := Normalize(nil, FormatAuto); err == nil {
+		t.Error("expected an error for a nil entity")
+	}
+}
+
+func TestParseNotification(t *testing.T) {
+	body := decodeEntity(t, `{"subscriptionId": "sub1", "data": [`+ngsiv2Entity+`, 3]}`)
+
+	notification, ok := ParseNotification(body)
+	if !ok {
+		t.Fatal("expected a notification")
+	}
+	if notification.SubscriptionID != "sub1" || len(notification.Data) != 2 {
+		t.Fatalf("unexpected notification %+v", notification)
+	}
+	if notification.Data[0] == nil || notification.Data[1] != nil {
+		t.Errorf("unexpected entities %v", notification.Data)
+	}
+
+	if _, ok := ParseNotification(decodeEntity(t, ngsiv2Entity)); ok {
+		t.Error("an entity is not a notification")
+	}
+}
+
+func TestProvenanceIsNotCanonical(t *testing.T) {
+	m, err := Normalize(decodeEntity(t, ngsiv2Entity), FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned, _ := m.Marshal()
+
+	m.Provenance = &Provenance{SensorID: "sensor", BodyCID: "bafy", Body: []byte(ngsiv2Entity)}
+	m.SignatureScheme = "eip191"
+	signed, _ := m.Marshal()
+	if string(signed) != string(unsigned) {
+		t.Errorf("the provenance changed the canonical encoding: %s", signed)
+	}
+
+	document, _ := m.MarshalDocument()
+	decoded := &Measurement{}
+	if err := json.Unmarshal(document, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Provenance == nil || decoded.Provenance.BodyCID != "bafy" {
+		t.Errorf("the provenance is not kept in the document: %s", document)
+	}
+	if decoded.Provenance.Body != nil {
+		t.Errorf("the signed body is copied into the document: %s", document)
+	}
+	if decoded.SignatureScheme != "eip191" {
+		t.Errorf("the signature scheme is not kept in the document: %s", document)
+	}
+}
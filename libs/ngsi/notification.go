@@ -0,0 +1,37 @@
+// Package ngsi contains the helpers used to handle the payloads that the
+// FIWARE context brokers send to the IoT proxy
+package ngsi
+
+// Notification is the envelope used by the context broker (Orion) to
+// deliver the entities that match a subscription
+type Notification struct {
+	SubscriptionID string
+	Data           []map[string]interface{}
+}
+
+// ParseNotification checks whether the body received on /notify is an
+// NGSIv2 notification ({"subscriptionId": ..., "data": [...]}) and, if so,
+// returns it. Elements of data that are not JSON objects are kept as nil
+// entries so that the caller can report them individually.
+func ParseNotification(body map[string]interface{}) (*Notification, bool) {
+	subscriptionID, ok := body["subscriptionId"].(string)
+	if !ok {
+		return nil, false
+	}
+
+	data, ok := body["data"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	notification := &Notification{
+		SubscriptionID: subscriptionID,
+		Data:           make([]map[string]interface{}, len(data)),
+	}
+	for i, item := range data {
+		entity, _ := item.(map[string]interface{})
+		notification.Data[i] = entity
+	}
+
+	return notification, true
+}
@@ -0,0 +1,238 @@
+// Package pricing sets the price of the measurements with configurable
+// rules. Rules match on the entity type, the sensor ID, the attributes, the
+// time of the observation and the location of the sensor. The first rule
+// that matches prices the measurement.
+package pricing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	ngsi "administrator/ipfs-node/libs/ngsi"
+)
+
+// DefaultRule is the name reported when no rule matches a measurement
+const DefaultRule = "default"
+
+// TimeWindow matches the measurements observed between From and To (HH:MM,
+// To excluded) in the time zone Timezone (UTC if empty). Windows can cross
+// midnight. If Days is set, only those week days (Mon, Tue, ...) match; the
+// day of a window that crosses midnight is the day it starts.
+type TimeWindow struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Days     []string `json:"days"`
+	Timezone string   `json:"timezone"`
+}
+
+// BoundingBox matches the measurements whose location, a GeoJSON point, is
+// inside the box
+type BoundingBox struct {
+	MinLon float64 `json:"minLon"`
+	MinLat float64 `json:"minLat"`
+	MaxLon float64 `json:"maxLon"`
+	MaxLat float64 `json:"maxLat"`
+}
+
+// Rule prices the measurements that match all its conditions. Empty
+// conditions match every measurement.
+type Rule struct {
+	Name        string       `json:"name"`
+	Type        string       `json:"type"`
+	IDPattern   string       `json:"idPattern"`
+	Attributes  []string     `json:"attributes"`
+	TimeWindow  *TimeWindow  `json:"timeWindow"`
+	BoundingBox *BoundingBox `json:"boundingBox"`
+	Price       int64        `json:"price"`
+}
+
+// Config is the configuration of the pricing rules. The measurements that
+// do not match any rule get the default price (priceMeasurements).
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// RuleError is returned when a field of a rule is not valid
+type RuleError struct {
+	Rule   int
+	Field  string
+	Reason string
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("Invalid field %s of pricing rule %d: %s", e.Field, e.Rule, e.Reason)
+}
+
+// Match is the price of a measurement and the rule that set it
+type Match struct {
+	Rule  string `json:"rule"`
+	Price int64  `json:"price"`
+}
+
+// Engine prices the measurements with compiled rules
+type Engine struct {
+	rules        []compiledRule
+	defaultPrice int64
+}
+
+// compiledRule is a rule ready to be matched
+type compiledRule struct {
+	Rule
+	id       *regexp.Regexp
+	location *time.Location
+	from, to int
+	days     map[time.Weekday]bool
+}
+
+// weekdays are the names of the days accepted in time windows
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// NewEngine compiles the rules. The measurements that do not match any of
+// them get the default price.
+func NewEngine(config Config, defaultPrice int64) (*Engine, error) {
+	engine := &Engine{defaultPrice: defaultPrice}
+
+	for i, rule := range config.Rules {
+		c := compiledRule{Rule: rule}
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("rule %d", i)
+		}
+		if rule.Price < 0 {
+			return nil, &RuleError{i, "price", "it cannot be negative"}
+		}
+
+		if rule.IDPattern != "" {
+			id, err := regexp.Compile(rule.IDPattern)
+			if err != nil {
+				return nil, &RuleError{i, "idPattern", err.Error()}
+			}
+			c.id = id
+		}
+
+		if w := rule.TimeWindow; w != nil {
+			var err error
+			if c.location, err = time.LoadLocation(w.Timezone); err != nil {
+				return nil, &RuleError{i, "timeWindow.timezone", err.Error()}
+			}
+			if c.from, err = parseClock(w.From); err != nil {
+				return nil, &RuleError{i, "timeWindow.from", err.Error()}
+			}
+			if c.to, err = parseClock(w.To); err != nil {
+				return nil, &RuleError{i, "timeWindow.to", err.Error()}
+			}
+			if len(w.Days) > 0 {
+				c.days = make(map[time.Weekday]bool, len(w.Days))
+				for _, day := range w.Days {
+					weekday, ok := weekdays[strings.ToLower(day)]
+					if !ok {
+						return nil, &RuleError{i, "timeWindow.days", fmt.Sprintf("unknown day %q", day)}
+					}
+					c.days[weekday] = true
+				}
+			}
+		}
+
+		if b := rule.BoundingBox; b != nil && (b.MinLon > b.MaxLon || b.MinLat > b.MaxLat) {
+			return nil, &RuleError{i, "boundingBox", "the minimum coordinates exceed the maximum ones"}
+		}
+
+		engine.rules = append(engine.rules, c)
+	}
+
+	return engine, nil
+}
+
+// Price returns the price of a measurement and the rule that set it
+func (e *Engine) Price(m *ngsi.Measurement) Match {
+	for _, rule := range e.rules {
+		if rule.matches(m) {
+			return Match{Rule: rule.Name, Price: rule.Price}
+		}
+	}
+	return Match{Rule: DefaultRule, Price: e.defaultPrice}
+}
+
+// matches checks the conditions of the rule
+func (r *compiledRule) matches(m *ngsi.Measurement) bool {
+	if r.Type != "" && r.Type != m.Type {
+		return false
+	}
+	if r.id != nil && !r.id.MatchString(m.ID) {
+		return false
+	}
+	for _, name := range r.Attributes {
+		if _, ok := m.Attributes[name]; !ok {
+			return false
+		}
+	}
+	if r.TimeWindow != nil && !r.inTimeWindow(m.ObservedAt) {
+		return false
+	}
+	if r.BoundingBox != nil && !r.inBoundingBox(m.Attributes["location"]) {
+		return false
+	}
+	return true
+}
+
+// inTimeWindow checks the time of the observation
+func (r *compiledRule) inTimeWindow(observedAt string) bool {
+	t, err := time.Parse(time.RFC3339Nano, observedAt)
+	if err != nil {
+		return false
+	}
+	t = t.In(r.location)
+	minute := t.Hour()*60 + t.Minute()
+
+	// The day of windows that cross midnight is the day they start
+	day := t.Weekday()
+	var inWindow bool
+	if r.from <= r.to {
+		inWindow = minute >= r.from && minute < r.to
+	} else {
+		inWindow = minute >= r.from || minute < r.to
+		if minute < r.to {
+			day = t.AddDate(0, 0, -1).Weekday()
+		}
+	}
+
+	return inWindow && (r.days == nil || r.days[day])
+}
+
+// inBoundingBox checks the location of the measurement, a GeoJSON point
+func (r *compiledRule) inBoundingBox(location interface{}) bool {
+	point, ok := location.(map[string]interface{})
+	if !ok || point["type"] != "Point" {
+		return false
+	}
+	coordinates, ok := point["coordinates"].([]interface{})
+	if !ok || len(coordinates) < 2 {
+		return false
+	}
+	lon, okLon := coordinates[0].(float64)
+	lat, okLat := coordinates[1].(float64)
+	if !okLon || !okLat {
+		return false
+	}
+
+	b := r.BoundingBox
+	return lon >= b.MinLon && lon <= b.MaxLon && lat >= b.MinLat && lat <= b.MaxLat
+}
+
+// parseClock parses a time of the day (HH:MM) to minutes since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of the day (HH:MM)", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
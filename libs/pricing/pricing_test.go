@@ -0,0 +1,106 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+
+	ngsi "administrator/ipfs-node/libs/ngsi"
+)
+
+var testConfig = Config{
+	Rules: []Rule{
+		{
+			Name:       "rush-hour-traffic",
+			Type:       "TrafficFlowObserved",
+			Attributes: []string{"intensity"},
+			TimeWindow: &TimeWindow{From: "07:00", To: "09:30", Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Timezone: "Europe/Madrid"},
+			Price:      10,
+		},
+		{
+			Name:        "santander-centre",
+			IDPattern:   `^urn:ngsi-ld:\w+:santander:`,
+			BoundingBox: &BoundingBox{MinLon: -3.85, MinLat: 43.45, MaxLon: -3.78, MaxLat: 43.48},
+			Price:       5,
+		},
+		{
+			Name:       "night",
+			TimeWindow: &TimeWindow{From: "22:00", To: "06:00", Days: []string{"Fri"}},
+			Price:      1,
+		},
+	},
+}
+
+// point is a GeoJSON point as normalized from an entity
+func point(lon, lat float64) map[string]interface{} {
+	return map[string]interface{}{"type": "Point", "coordinates": []interface{}{lon, lat}}
+}
+
+func TestPrice(t *testing.T) {
+	engine, err := NewEngine(testConfig, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		m    ngsi.Measurement
+		rule string
+	}{
+		"rush hour (08:00 in Madrid)": {
+			ngsi.Measurement{ID: "urn:ngsi-ld:TrafficFlowObserved:1", Type: "TrafficFlowObserved", ObservedAt: "2020-09-09T06:00:00Z", Attributes: map[string]interface{}{"intensity": 281.0}},
+			"rush-hour-traffic",
+		},
+		"rush hour on sunday": {
+			ngsi.Measurement{ID: "urn:ngsi-ld:TrafficFlowObserved:1", Type: "TrafficFlowObserved", ObservedAt: "2020-09-13T06:00:00Z", Attributes: map[string]interface{}{"intensity": 281.0}},
+			DefaultRule,
+		},
+		"rush hour without intensity": {
+			ngsi.Measurement{ID: "urn:ngsi-ld:TrafficFlowObserved:1", Type: "TrafficFlowObserved", ObservedAt: "2020-09-09T06:00:00Z", Attributes: map[string]interface{}{}},
+			DefaultRule,
+		},
+		"inside the box": {
+			ngsi.Measurement{ID: "urn:ngsi-ld:AirQualityObserved:santander:1", Type: "AirQualityObserved", ObservedAt: "2020-09-09T12:00:00Z", Attributes: map[string]interface{}{"location": point(-3.82, 43.46)}},
+			"santander-centre",
+		},
+		"outside the box": {
+			ngsi.Measurement{ID: "urn:ngsi-ld:AirQualityObserved:santander:1", Type: "AirQualityObserved", ObservedAt: "2020-09-09T12:00:00Z", Attributes: map[string]interface{}{"location": point(-3.70, 43.46)}},
+			DefaultRule,
+		},
+		"friday night after midnight": {
+			ngsi.Measurement{ID: "urn:ngsi-ld:Humidity:1", Type: "Humidity", ObservedAt: "2020-09-12T03:00:00Z"},
+			"night",
+		},
+		"saturday night": {
+			ngsi.Measurement{ID: "urn:ngsi-ld:Humidity:1", Type: "Humidity", ObservedAt: "2020-09-12T23:00:00Z"},
+			DefaultRule,
+		},
+	}
+
+	for name, c := range cases {
+		match := engine.Price(&c.m)
+		if match.Rule != c.rule {
+			t.Errorf("%s: expected rule %s, got %s", name, c.rule, match.Rule)
+		}
+		if match.Rule == DefaultRule && match.Price != 2 {
+			t.Errorf("%s: expected the default price, got %d", name, match.Price)
+		}
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	cases := map[string]Rule{
+		"idPattern":           {IDPattern: "("},
+		"timeWindow.from":     {TimeWindow: &TimeWindow{From: "7", To: "09:00"}},
+		"timeWindow.days":     {TimeWindow: &TimeWindow{From: "07:00", To: "09:00", Days: []string{"Monday"}}},
+		"timeWindow.timezone": {TimeWindow: &TimeWindow{From: "07:00", To: "09:00", Timezone: "Mars/Olympus"}},
+		"boundingBox":         {BoundingBox: &BoundingBox{MinLon: 1, MaxLon: 0}},
+		"price":               {Price: -1},
+	}
+
+	for field, rule := range cases {
+		_, err := NewEngine(Config{Rules: []Rule{{}, rule}}, 0)
+		var ruleErr *RuleError
+		if !errors.As(err, &ruleErr) || ruleErr.Rule != 1 || ruleErr.Field != field {
+			t.Errorf("%s: unexpected error %v", field, err)
+		}
+	}
+}
@@ -2,24 +2,39 @@ package libs
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"math/big"
-	"time"
+	"strings"
+	"text/template"
 
 	cipher "administrator/ipfs-node/libs/cipher"
+	config "administrator/ipfs-node/libs/config"
 	ipfsLib "administrator/ipfs-node/libs/ipfsLib"
+	ngsi "administrator/ipfs-node/libs/ngsi"
+	pricing "administrator/ipfs-node/libs/pricing"
+	signer "administrator/ipfs-node/libs/signer"
+	transactions "administrator/ipfs-node/libs/transactions"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
+// ErrAlreadyStored is returned when the measurement had already been
+// stored in the Blockchain
+var ErrAlreadyStored = errors.New("The measurement had already been stored in the blockchain")
+
 // Inserts the required information to retrieve a measurement in the Blockchain
-func insertDataInBlockchain(ethClient ComponentConfig, dataStruct DataBlockchain) error {
+// and sets its price. When the contracts support it, both are done in one
+// transaction. Otherwise, or if that transaction is reverted, the
+// measurement is stored and then priced in two transactions. The hashes of
+// the transactions that are sent are stored in the receipt.
+func insertDataInBlockchain(ethClient ComponentConfig, dataStruct DataBlockchain, price *big.Int, receipt *MeasurementReceipt) error {
 
 	// Check that the measurement has not already been stored
 	measurement, err := ethClient.DataCon.Ledger(nil, dataStruct.Hash)
@@ -34,93 +49,153 @@ func insertDataInBlockchain(ethClient ComponentConfig, dataStruct DataBlockchain
 	}
 
 	if measurement.Uri != "" {
-		str := fmt.Sprintf("%x: The measurement had already been stored in the blockchain", dataStruct.Hash[:])
-
-		// Check if the stored measurement has a price. If not, set it.
+		// A measurement stored without a price, by an attempt that was
+		// interrupted between its two transactions, is completed
 		if priceTag.Uint64() == 0 {
-			auth := bind.NewKeyedTransactor(ethClient.PrivateKey)
-			auth.Value = big.NewInt(0)
-			auth.GasLimit = uint64(3000000)
-			auth.GasPrice = big.NewInt(0)
+			log.Printf("Measurement 0x%x stored without a price, setting it\n", dataStruct.Hash)
+			// The stored URL points to the copy uploaded by that attempt
+			receipt.CID = ""
+			return setPrice(ethClient, dataStruct.Hash, price, receipt)
+		}
+		// The stored URL does not point to the copy uploaded by this attempt
+		receipt.CID = ""
+		return fmt.Errorf("%x: %w", dataStruct.Hash[:], ErrAlreadyStored)
+	}
+
+	// Store the measurement and set its price in one transaction
+	if ethClient.AtomicStore {
+		tx, txReceipt, resumed, err := transact(ethClient, fmt.Sprintf("store-with-price:%x", dataStruct.Hash), func(auth *bind.TransactOpts) (*types.Transaction, error) {
+			return ethClient.DataCon.StoreInfoWithPrice(auth, dataStruct.Hash, dataStruct.EncryptedURL, dataStruct.Description, price)
+		})
+		if resumed {
+			// The transaction of an earlier attempt stores the URL of the
+			// copy uploaded by that attempt
+			receipt.CID = ""
+		}
+		if txReceipt != nil {
+			receipt.GasUsed += txReceipt.GasUsed
+		}
 
-			price := (int64)(ethClient.GeneralConfig["priceMeasurements"].(float64))
-			_, err = ethClient.BalanceCon.SetPriceToMeasurement(auth, dataStruct.Hash, big.NewInt(price))
+		// The transaction may revert when it is mined, or when its gas is
+		// estimated before it is sent
+		if !transactions.IsRevert(err) {
+			if tx != nil {
+				receipt.StoreTx = tx.Hash()
+				receipt.PriceTx = tx.Hash()
+			}
 			if err != nil {
-				fmt.Println(err)
-				return err
+				log.Println(err)
 			}
+			return err
 		}
-		return errors.New(str)
+		log.Printf("Could not store and price the measurement in one transaction, using two: %v\n", err)
 	}
 
-	// Prepare authentication parameters
-	auth := bind.NewKeyedTransactor(ethClient.PrivateKey)
-	auth.Value = big.NewInt(0)
-	auth.GasLimit = uint64(3000000)
-	auth.GasPrice = big.NewInt(0)
-
-	// Send the transaction to the data smart contract
-	_, err = ethClient.DataCon.StoreInfo(auth, dataStruct.Hash, dataStruct.EncryptedURL, dataStruct.Description)
+	// Send the transaction to the data smart contract and wait until the
+	// measurement is stored
+	tx, txReceipt, resumed, err := transact(ethClient, fmt.Sprintf("store:%x", dataStruct.Hash), func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return ethClient.DataCon.StoreInfo(auth, dataStruct.Hash, dataStruct.EncryptedURL, dataStruct.Description)
+	})
+	if resumed {
+		// The transaction of an earlier attempt stores the URL of the copy
+		// uploaded by that attempt
+		receipt.CID = ""
+	}
+	if tx != nil {
+		receipt.StoreTx = tx.Hash()
+	}
+	if txReceipt != nil {
+		receipt.GasUsed += txReceipt.GasUsed
+	}
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
-	// Check if the data has been stored in the contract
-	// Wait until the value is received or the loop
-	// works for more than 15 seconds
-	currentTime := time.Now()
-	for {
+	// Set the price of the product and wait until it is set
+	return setPrice(ethClient, dataStruct.Hash, price, receipt)
+}
 
-		dataBC, err := ethClient.DataCon.Ledger(nil, dataStruct.Hash)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
+// setPrice sets the price of a stored measurement and waits until it is set
+func setPrice(ethClient ComponentConfig, hash [32]byte, price *big.Int, receipt *MeasurementReceipt) error {
+	tx, txReceipt, _, err := transact(ethClient, fmt.Sprintf("price:%x", hash), func(auth *bind.TransactOpts) (*types.Transaction, error) {
+		return ethClient.BalanceCon.SetPriceToMeasurement(auth, hash, price)
+	})
+	if tx != nil {
+		receipt.PriceTx = tx.Hash()
+	}
+	if txReceipt != nil {
+		receipt.GasUsed += txReceipt.GasUsed
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
 
-		if dataBC.Uri != "" {
-			break
-		}
+	return nil
+}
 
-		secondsPassed := time.Now().Sub(currentTime)
-		if secondsPassed > 15*time.Second {
-			log.Println("Could not check whether the data was introduced in the Blockchain")
-			return errors.New("Could not check whether the data was introduced in the Blockchain")
-		}
+// adminPublicKey reads the public key of the marketplace from the cache of
+// the access contract
+func adminPublicKey(ethClient ComponentConfig) (*ecdsa.PublicKey, error) {
+	adminPubKeyString, err := ethClient.Access.AdminPublicKey()
+	if err != nil {
+		return nil, err
 	}
 
-	// Set the price of the product
-	price := (int64)(ethClient.GeneralConfig["priceMeasurements"].(float64))
-	_, err = ethClient.BalanceCon.SetPriceToMeasurement(auth, dataStruct.Hash, big.NewInt(price))
+	// Convert the string public key to bytes
+	adminPubKeyBytes, err := hex.DecodeString(adminPubKeyString)
 	if err != nil {
-		log.Println(err)
-		return err
+		return nil, err
 	}
 
-	// Check if the data has been stored in the contract
-	// Wait until the value is received or the loop
-	// works for more than 15 seconds
-	currentTime = time.Now()
-	for {
+	// Convert the public key to ecdsa.PublicKey
+	return crypto.UnmarshalPubkey(adminPubKeyBytes)
+}
 
-		dataBC, err := ethClient.BalanceCon.GetPriceMeasurement(nil, dataStruct.Hash)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
+// MeasurementHash returns the hash that identifies a measurement in the
+// Blockchain: the hash of its canonical JSON encoding
+func MeasurementHash(m *ngsi.Measurement) ([32]byte, error) {
+	jsonData, err := m.Marshal()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return ByteToByte32(cipher.HashData(jsonData)), nil
+}
 
-		if dataBC != big.NewInt(0) {
-			break
-		}
+// descriptionData is the data available to the template of the descriptions
+type descriptionData struct {
+	ID         string
+	Type       string
+	ObservedAt string
+	Attributes map[string]interface{}
+	GatewayID  string
+}
 
-		secondsPassed := time.Now().Sub(currentTime)
-		if secondsPassed > 15*time.Second {
-			log.Println("Could not check whether the data was introduced in the Blockchain")
-			return errors.New("Could not check whether the data was introduced in the Blockchain")
-		}
+// describeMeasurement builds the description of the measurement that is
+// stored in the Blockchain with the configured template
+func describeMeasurement(m *ngsi.Measurement, conf *config.Config) (string, error) {
+	tmpl, err := template.New("description").Parse(conf.DescriptionTemplate)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	var b strings.Builder
+	err = tmpl.Execute(&b, descriptionData{m.ID, m.Type, m.ObservedAt, m.Attributes, conf.GatewayID})
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// PriceMeasurement returns the price of a measurement according to the
+// pricing rules, and the rule that sets it
+func PriceMeasurement(conf *config.Config, m *ngsi.Measurement) (pricing.Match, error) {
+	engine, err := pricing.NewEngine(conf.Pricing, conf.PriceMeasurements)
+	if err != nil {
+		return pricing.Match{}, err
+	}
+	return engine.Price(m), nil
 }
 
 // ProcessMeasurement processes the measurement:
@@ -128,22 +203,40 @@ func insertDataInBlockchain(ethClient ComponentConfig, dataStruct DataBlockchain
 //	- Encrypts the measurement with a random symmetric key
 //	- Stores the measurement in the IPFS node
 //  - Stores the IPFS URL in the Blockchain encrypted with
-//	  the public key of the administrator
-func ProcessMeasurement(ethClient ComponentConfig, body map[string]interface{}) error {
-	// Convert the body to JSON data []byte
-	jsonData, err := json.Marshal(body)
+//	  the public key of the administrator, or adds it to the next
+//	  anchored batch when the anchoring in batches is enabled
+// The returned receipt identifies where the measurement has been stored.
+// It is also returned, partially filled, along with ErrAlreadyStored.
+func ProcessMeasurement(ethClient ComponentConfig, m *ngsi.Measurement) (*MeasurementReceipt, error) {
+	// Convert the measurement to its canonical JSON encoding
+	jsonData, err := m.Marshal()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	measurementHashBytes := cipher.HashData(jsonData)
+	receipt := &MeasurementReceipt{Hash: ByteToByte32(measurementHashBytes)}
+
+	// The stored document also carries the signature of the sensor, so
+	// buyers can verify the provenance of the measurement. The scheme of the
+	// signature of the producer is recorded when the signer does not sign
+	// the hash of the document itself.
+	stored := *m
+	if scheme := ethClient.Signer.Scheme(); scheme != signer.SchemeHash {
+		stored.SignatureScheme = scheme
+	}
+	document, err := stored.MarshalDocument()
+	if err != nil {
+		return nil, err
 	}
 
 	// Sign the measurement
-	signedBody, err := cipher.SignData(ethClient.PrivateKey, jsonData)
+	signedBody, err := cipher.SignData(ethClient.Signer, document)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Append the signature to the measurement
-	msg := append(jsonData, signedBody...)
+	msg := append(document, signedBody...)
 
 	// Create random symmetric k ey
 	randomKey := make([]byte, 32)
@@ -154,45 +247,47 @@ func ProcessMeasurement(ethClient ComponentConfig, body map[string]interface{})
 	// Encrypt the measurement (msg) with the symmetric key
 	encryptedMsg, err := cipher.SymmetricEncryption(randomKey, msg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	/* Store the encrypted measurement in the IPFS network */
 	// Convert bytes to files.node
 	cid, err := ipfsLib.AddToIPFS(ethClient.IPFSConfig.IpfsCore, bytes.NewReader(encryptedMsg))
+	if err != nil {
+		return nil, err
+	}
+
+	receipt.CID = cid
 
 	// Append the cid to the symmetric key to store them in the Blockchain (BC)
 	secretBC := append(randomKey, []byte(cid)...)
 
 	/* Prepare the data that is going to be stored in the Blockchain */
-	sensorID := body["id"].(string)
-	observationDate := body["dateObserved"].(map[string]interface{})["value"].(string)
-	gatewayID := ethClient.GeneralConfig["gatewayID"].(string)
-	description := sensorID + " by " + gatewayID + " at " + observationDate
-	measurementHashBytes := cipher.HashData(jsonData)
-
-	// Get the public key of the marketplace from the Blockchain
-	adminPubKeyString, err := ethClient.AccessCon.AdminPublicKey(nil)
+	conf := ethClient.Config.Get()
+	description, err := describeMeasurement(m, conf)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Convert the string public key to bytes
-	adminPubKeyBytes, err := hex.DecodeString(adminPubKeyString)
+	// Price the measurement with the pricing rules
+	price, err := PriceMeasurement(conf, m)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	receipt.Price = price.Price
+	receipt.PriceRule = price.Rule
+	log.Printf("Measurement %s priced at %d by rule %s\n", m.ID, price.Price, price.Rule)
 
-	// Convert the public key to ecdsa.PublicKey
-	adminPubKey, err := crypto.UnmarshalPubkey(adminPubKeyBytes)
+	// Get the public key of the marketplace from the Blockchain
+	adminPubKey, err := adminPublicKey(ethClient)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Encrypt the url with the public key of the marketplace
 	encryptedURL, err := cipher.EncryptWithPublicKey(*adminPubKey, secretBC)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	dataStruct := DataBlockchain{
@@ -201,13 +296,31 @@ func ProcessMeasurement(ethClient ComponentConfig, body map[string]interface{})
 		fmt.Sprintf("%x", encryptedURL),
 	}
 
-	/* Introduce data in the Blockchain */
-	err = insertDataInBlockchain(ethClient, dataStruct)
+	/* Introduce data in the Blockchain, on its own or in the next batch */
+	if ethClient.Anchorer != nil {
+		err = anchorMeasurement(ethClient, m, dataStruct, price.Price, receipt)
+	} else {
+		err = insertDataInBlockchain(ethClient, dataStruct, big.NewInt(price.Price), receipt)
+	}
 	if err != nil {
-		return err
+		if errors.Is(err, ErrAlreadyStored) {
+			return receipt, err
+		}
+		return nil, err
 	}
 
-	log.Printf("Information stored in the Blockchain at the following hash: 0x%x\n\n", measurementHashBytes)
+	if receipt.Batched {
+		log.Printf("Measurement 0x%x waiting to be anchored in the next batch\n\n", measurementHashBytes)
+		return receipt, nil
+	}
 
-	return nil
+	log.Printf("Information stored in the Blockchain at the following hash: 0x%x\n", measurementHashBytes)
+	if ethClient.Revenue != nil {
+		if err := ethClient.Revenue.RecordMeasurement(receipt.Hash, m.ID, m.Type); err != nil {
+			log.Printf("Could not record the measurement 0x%x in the revenue index: %v\n", measurementHashBytes, err)
+		}
+	}
+	log.Printf("Gas used by the transactions of the measurement: %d\n\n", receipt.GasUsed)
+
+	return receipt, nil
 }
@@ -0,0 +1,38 @@
+package libs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+
+	cipher "administrator/ipfs-node/libs/cipher"
+	ipfsLib "administrator/ipfs-node/libs/ipfsLib"
+	ngsi "administrator/ipfs-node/libs/ngsi"
+)
+
+// StoreSignedBody stores the body signed by a sensor in IPFS, encrypted with
+// a random symmetric key, and references it from the provenance. The
+// measurements of a body share its provenance, so the body is only stored
+// for the first of them.
+func StoreSignedBody(ethClient ComponentConfig, provenance *ngsi.Provenance) error {
+	if provenance == nil || provenance.BodyCID != "" {
+		return nil
+	}
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	encryptedBody, err := cipher.SymmetricEncryption(key, provenance.Body)
+	if err != nil {
+		return err
+	}
+
+	cid, err := ipfsLib.AddToIPFS(ethClient.IPFSConfig.IpfsCore, bytes.NewReader(encryptedBody))
+	if err != nil {
+		return err
+	}
+
+	provenance.BodyCID = cid
+	provenance.BodyKey = hex.EncodeToString(key)
+	provenance.Body = nil
+	return nil
+}
@@ -0,0 +1,570 @@
+// Package queue implements a durable on-disk job queue. Every job is stored
+// in its own file before it is acknowledged, so queued work survives a crash
+// or a restart of the process.
+package queue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// States of a job
+const (
+	StatePending = "pending"
+	StateDone    = "done"
+	StateFailed  = "failed"
+)
+
+// maxBackoff is the longest wait between two attempts of a job
+const maxBackoff = time.Hour
+
+// pruneInterval is the time between the removals of the expired jobs
+const pruneInterval = time.Hour
+
+// ErrClosed is returned when a job is enqueued in a stopped queue
+var ErrClosed = errors.New("The queue has been stopped")
+
+// Config is the configuration of the retries and the retention of the
+// jobs. A job is attempted up to MaxAttempts times, waiting Backoff seconds
+// before the second attempt and twice as long before every next one. The
+// jobs that are done or failed are removed Retention hours after they
+// ended; a Retention of 0 keeps them.
+type Config struct {
+	MaxAttempts int `json:"maxAttempts"`
+	Backoff     int `json:"backoff"`
+	Retention   int `json:"retention"`
+}
+
+// Job is a unit of work stored in the queue. A pending job that failed
+// before is not attempted again until NextAttempt.
+type Job struct {
+	ID          string          `json:"id"`
+	Key         string          `json:"key,omitempty"`
+	State       string          `json:"state"`
+	Payload     json.RawMessage `json:"payload"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int             `json:"attempts,omitempty"`
+	NextAttempt time.Time       `json:"nextAttempt,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// Handler processes the payload of a job. The returned result is stored
+// along with the job. If an error is returned, the job is attempted again
+// later, unless the error is permanent or the job ran out of attempts, in
+// which case it is marked as failed.
+type Handler func(payload json.RawMessage) (interface{}, error)
+
+// permanentError marks the errors that are not solved by trying again
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error returned by a handler as permanent, so that the
+// job fails without being attempted again
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// Queue is a durable job queue served by a pool of workers
+type Queue struct {
+	dir    string
+	config Config
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	jobs    map[string]*Job
+	keys    map[string]string
+	pending []string
+	closed  bool
+	paused  bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Open opens the queue stored in dir, creating the folder if required.
+// Jobs that were pending when the process stopped are queued again.
+func Open(dir string, config Config) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	q := &Queue{
+		dir:    dir,
+		config: config,
+		jobs:   make(map[string]*Job),
+		keys:   make(map[string]string),
+		stop:   make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	recovered := 0
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		jsonBytes, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		job := &Job{}
+		if err := json.Unmarshal(jsonBytes, job); err != nil {
+			log.Printf("Skipping corrupted job %s: %v\n", f.Name(), err)
+			continue
+		}
+
+		q.index(job)
+		if job.State == StatePending {
+			q.schedule(job)
+			recovered++
+		}
+	}
+
+	if recovered > 0 {
+		log.Printf("Recovered %d pending jobs from %s\n", recovered, dir)
+	}
+
+	return q, nil
+}
+
+// Enqueue stores a new job in the queue. The key, if not empty, can be used
+// later on to look the job up. The job has been persisted when this function
+// returns without error.
+func (q *Queue) Enqueue(key string, payload interface{}) (*Job, error) {
+	job, _, err := q.enqueue(key, payload, false)
+	return job, err
+}
+
+// EnqueueUnique stores a new job in the queue unless the latest job with the
+// same key has not failed. In that case, that job is returned and the bool
+// is false. The lookup and the enqueue are done under the lock of the
+// queue, so concurrent calls with the same key enqueue one job.
+func (q *Queue) EnqueueUnique(key string, payload interface{}) (*Job, bool, error) {
+	return q.enqueue(key, payload, key != "")
+}
+
+// enqueue stores a new job in the queue. If unique is set, the latest job
+// with the same key is returned instead, unless it failed.
+func (q *Queue) enqueue(key string, payload interface{}, unique bool) (*Job, bool, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, false, err
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:        id,
+		Key:       key,
+		State:     StatePending,
+		Payload:   payloadBytes,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, false, ErrClosed
+	}
+
+	if latestID, ok := q.keys[key]; unique && ok && q.jobs[latestID].State != StateFailed {
+		copyJob := *q.jobs[latestID]
+		return &copyJob, false, nil
+	}
+
+	if err := q.save(job); err != nil {
+		return nil, false, err
+	}
+
+	q.index(job)
+	q.pending = append(q.pending, job.ID)
+	q.cond.Signal()
+
+	copyJob := *job
+	return &copyJob, true, nil
+}
+
+// Get returns a copy of the job with the given ID
+func (q *Queue) Get(id string) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, false
+	}
+
+	copyJob := *job
+	return &copyJob, true
+}
+
+// GetByKey returns a copy of the latest job enqueued with the given key
+func (q *Queue) GetByKey(key string) (*Job, bool) {
+	q.mu.Lock()
+	id, ok := q.keys[key]
+	q.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+	return q.Get(id)
+}
+
+// index adds a job to the in-memory indexes. The caller must hold the lock.
+func (q *Queue) index(job *Job) {
+	q.jobs[job.ID] = job
+	if job.Key == "" {
+		return
+	}
+
+	// Keep the latest job of every key
+	if latestID, ok := q.keys[job.Key]; ok && q.jobs[latestID].CreatedAt.After(job.CreatedAt) {
+		return
+	}
+	q.keys[job.Key] = job.ID
+}
+
+// schedule queues a pending job, right away or when its next attempt is
+// due. The caller must hold the lock or own the queue.
+func (q *Queue) schedule(job *Job) {
+	delay := time.Until(job.NextAttempt)
+	if delay <= 0 {
+		q.pending = append(q.pending, job.ID)
+		q.cond.Signal()
+		return
+	}
+
+	id := job.ID
+	time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if !q.closed {
+			q.pending = append(q.pending, id)
+			q.cond.Signal()
+		}
+	})
+}
+
+// backoff returns the wait before the next attempt of a job that was
+// attempted attempts times
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := time.Duration(q.config.Backoff) * time.Second
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// Start launches the workers that process the queued jobs, and removes the
+// expired jobs if a retention is configured
+func (q *Queue) Start(workers int, handler Handler) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.worker(handler)
+	}
+
+	if q.config.Retention > 0 {
+		q.wg.Add(1)
+		go q.pruner()
+	}
+}
+
+// Stop waits until the workers finish the jobs they are processing. The
+// jobs that are still pending remain on disk.
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+// Pause stops handing jobs to the workers until Resume is called. The jobs
+// being processed are finished; the rest stay pending.
+func (q *Queue) Pause() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = true
+}
+
+// Resume lets the workers process the pending jobs again
+func (q *Queue) Resume() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = false
+	q.cond.Broadcast()
+}
+
+// pruner removes the expired jobs until the queue is stopped
+func (q *Queue) pruner() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		q.Prune(time.Now().Add(-time.Duration(q.config.Retention) * time.Hour))
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune removes the jobs that are done or failed and were last updated
+// before until. It returns the number of removed jobs.
+func (q *Queue) Prune(until time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	removed := 0
+	for id, job := range q.jobs {
+		if job.State == StatePending || !job.UpdatedAt.Before(until) {
+			continue
+		}
+
+		err := os.Remove(filepath.Join(q.dir, id+".json"))
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Could not remove the expired job %s: %v\n", id, err)
+			continue
+		}
+		delete(q.jobs, id)
+		if q.keys[job.Key] == id {
+			delete(q.keys, job.Key)
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		log.Printf("Removed %d expired jobs from %s\n", removed, q.dir)
+	}
+	return removed
+}
+
+// worker processes jobs until the queue is stopped
+func (q *Queue) worker(handler Handler) {
+	defer q.wg.Done()
+
+	for {
+		q.mu.Lock()
+		for (len(q.pending) == 0 || q.paused) && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+
+		id := q.pending[0]
+		q.pending = q.pending[1:]
+		payload := q.jobs[id].Payload
+		q.mu.Unlock()
+
+		result, err := handler(payload)
+		q.finish(id, result, err)
+	}
+}
+
+// finish records the outcome of a job
+func (q *Queue) finish(id string, result interface{}, handlerErr error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := *q.jobs[id]
+	job.State = StateDone
+	job.Error = ""
+	job.Attempts++
+	job.UpdatedAt = time.Now().UTC()
+
+	if result != nil {
+		resultBytes, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("Could not encode the result of job %s: %v\n", id, err)
+		} else {
+			job.Result = resultBytes
+		}
+	}
+
+	// Errors that are not permanent are retried while attempts remain
+	var permanent *permanentError
+	retry := handlerErr != nil && !errors.As(handlerErr, &permanent) && job.Attempts < q.config.MaxAttempts
+	if handlerErr != nil {
+		job.State = StateFailed
+		job.Error = handlerErr.Error()
+	}
+	if retry {
+		job.State = StatePending
+		job.NextAttempt = job.UpdatedAt.Add(q.backoff(job.Attempts))
+		log.Printf("Job %s failed, attempt %d of %d at %s: %v\n", id, job.Attempts+1, q.config.MaxAttempts, job.NextAttempt.Format(time.RFC3339), handlerErr)
+	}
+
+	// If the outcome cannot be persisted, the job stays pending on disk and
+	// it is processed again after a restart
+	if err := q.save(&job); err != nil {
+		log.Printf("Could not store the outcome of job %s: %v\n", id, err)
+	}
+	q.jobs[id] = &job
+
+	if retry && !q.closed {
+		q.schedule(&job)
+	}
+}
+
+// ErrNotFailed is returned when a job that did not fail is updated
+var ErrNotFailed = errors.New("The job has not failed")
+
+// Complete marks a failed job as done with result, when the work it failed
+// to confirm was completed later
+func (q *Queue) Complete(id string, result interface{}) error {
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	current, ok := q.jobs[id]
+	if !ok || current.State != StateFailed {
+		return ErrNotFailed
+	}
+
+	job := *current
+	job.State = StateDone
+	job.Result = resultBytes
+	job.Error = ""
+	job.UpdatedAt = time.Now().UTC()
+	if err := q.save(&job); err != nil {
+		return err
+	}
+	q.jobs[id] = &job
+	return nil
+}
+
+// Retry queues a failed job again
+func (q *Queue) Retry(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	current, ok := q.jobs[id]
+	if !ok || current.State != StateFailed {
+		return ErrNotFailed
+	}
+
+	job := *current
+	job.State = StatePending
+	job.Error = ""
+	job.Attempts = 0
+	job.NextAttempt = time.Time{}
+	job.UpdatedAt = time.Now().UTC()
+	if err := q.save(&job); err != nil {
+		return err
+	}
+	q.jobs[id] = &job
+	q.schedule(&job)
+	return nil
+}
+
+// save atomically writes a job to disk
+func (q *Queue) save(job *Job) error {
+	jobBytes, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(q.dir, job.ID+".json")
+	tmpPath := path + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(jobBytes); err != nil {
+		f.Close()
+		return err
+	}
+
+	// Make sure the job reaches the disk before it is acknowledged
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(q.dir)
+}
+
+// syncDir flushes the entries of a folder so that renames are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// newJobID generates a random job identifier
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("could not generate job id: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
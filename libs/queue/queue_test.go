@@ -0,0 +1,341 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitForState(t *testing.T, q *Queue, id, state string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := q.Get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.State == state {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach state %s", id, state)
+	return nil
+}
+
+func TestPendingJobsSurviveRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	good, err := q.Enqueue("one", map[string]int{"value": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := q.Enqueue("", map[string]int{"value": -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash before the jobs are processed
+	q.Stop()
+
+	q, err = Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := q.Get(good.ID); job.State != StatePending {
+		t.Fatalf("expected a pending job, got %s", job.State)
+	}
+
+	q.Start(2, func(payload json.RawMessage) (interface{}, error) {
+		var body map[string]int
+		if err := json.Unmarshal(payload, &body); err != nil {
+			return nil, err
+		}
+		if body["value"] < 0 {
+			return nil, errors.New("negative value")
+		}
+		return body["value"] * 2, nil
+	})
+
+	waitForState(t, q, good.ID, StateDone)
+	failed := waitForState(t, q, bad.ID, StateFailed)
+	if failed.Error != "negative value" {
+		t.Errorf("unexpected error %q", failed.Error)
+	}
+	q.Stop()
+
+	// The outcome of the jobs is persisted as well
+	q, err = Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	job, ok := q.Get(good.ID)
+	if !ok || job.State != StateDone || string(job.Result) != "2" {
+		t.Errorf("unexpected job after restart: %+v", job)
+	}
+	if job, ok := q.GetByKey("one"); !ok || job.ID != good.ID {
+		t.Errorf("job not found by key: %+v", job)
+	}
+	if len(q.pending) != 0 {
+		t.Errorf("expected no pending jobs, got %d", len(q.pending))
+	}
+}
+
+func TestEnqueueAfterStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Stop()
+
+	if _, err := q.Enqueue("", "payload"); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestEnqueueUnique(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	// Concurrent deliveries of the same measurement enqueue one job
+	var wg sync.WaitGroup
+	var created int32
+	ids := make([]string, 20)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			job, ok, err := q.EnqueueUnique("measurement", "payload")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				atomic.AddInt32(&created, 1)
+			}
+			ids[i] = job.ID
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 || len(q.pending) != 1 {
+		t.Fatalf("expected one job, %d were created and %d are pending", created, len(q.pending))
+	}
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("expected the job %s, got %s", ids[0], id)
+		}
+	}
+
+	// A failed job is enqueued again
+	q.Start(1, func(payload json.RawMessage) (interface{}, error) {
+		return nil, Permanent(errors.New("reverted"))
+	})
+	waitForState(t, q, ids[0], StateFailed)
+	job, ok, err := q.EnqueueUnique("measurement", "payload")
+	if err != nil || !ok || job.ID == ids[0] {
+		t.Errorf("the failed job was not enqueued again: %v", err)
+	}
+}
+
+func TestCompleteAndRetryFailedJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	// The jobs fail until the transactions are confirmed
+	var confirmed int32
+	q.Start(1, func(payload json.RawMessage) (interface{}, error) {
+		if atomic.LoadInt32(&confirmed) == 0 {
+			return nil, errors.New("not confirmed in time")
+		}
+		return "stored", nil
+	})
+
+	completed, _ := q.Enqueue("", "completed")
+	retried, _ := q.Enqueue("", "retried")
+	waitForState(t, q, completed.ID, StateFailed)
+	waitForState(t, q, retried.ID, StateFailed)
+
+	if err := q.Complete(completed.ID, "confirmed later"); err != nil {
+		t.Fatal(err)
+	}
+	job, _ := q.Get(completed.ID)
+	if job.State != StateDone || string(job.Result) != `"confirmed later"` || job.Error != "" {
+		t.Errorf("unexpected completed job: %+v", job)
+	}
+	if err := q.Complete(completed.ID, "again"); err != ErrNotFailed {
+		t.Errorf("expected ErrNotFailed, got %v", err)
+	}
+
+	atomic.StoreInt32(&confirmed, 1)
+	if err := q.Retry(retried.ID); err != nil {
+		t.Fatal(err)
+	}
+	job = waitForState(t, q, retried.ID, StateDone)
+	if string(job.Result) != `"stored"` {
+		t.Errorf("unexpected retried job: %+v", job)
+	}
+}
+
+func TestTransientErrorsAreRetried(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, Config{MaxAttempts: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	// The transient jobs succeed at the third attempt
+	var attempts int32
+	q.Start(1, func(payload json.RawMessage) (interface{}, error) {
+		if string(payload) == `"permanent"` {
+			return nil, Permanent(errors.New("reverted"))
+		}
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return nil, errors.New("node unreachable")
+		}
+		return "stored", nil
+	})
+
+	transient, _ := q.Enqueue("", "transient")
+	job := waitForState(t, q, transient.ID, StateDone)
+	if job.Attempts != 3 || job.Error != "" {
+		t.Errorf("unexpected retried job: %+v", job)
+	}
+
+	permanent, _ := q.Enqueue("", "permanent")
+	job = waitForState(t, q, permanent.ID, StateFailed)
+	if job.Attempts != 1 || job.Error != "reverted" {
+		t.Errorf("the permanent error was retried: %+v", job)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := &Queue{config: Config{Backoff: 10}}
+	cases := map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		4:  80 * time.Second,
+		20: maxBackoff,
+	}
+	for attempts, expected := range cases {
+		if delay := q.backoff(attempts); delay != expected {
+			t.Errorf("after %d attempts: expected %s, got %s", attempts, expected, delay)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, _ := q.Enqueue("done", "done")
+	pending, _ := q.Enqueue("pending", "pending")
+	q.finish(done.ID, nil, nil)
+	q.Stop()
+
+	if removed := q.Prune(time.Now().Add(time.Minute)); removed != 1 {
+		t.Errorf("expected 1 removed job, got %d", removed)
+	}
+	if _, ok := q.GetByKey("done"); ok {
+		t.Error("the expired job is still indexed")
+	}
+
+	// The expired job is not recovered either
+	q, err = Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+	if _, ok := q.Get(done.ID); ok {
+		t.Error("the expired job is still on disk")
+	}
+	if _, ok := q.Get(pending.ID); !ok {
+		t.Error("the pending job was removed")
+	}
+}
+
+func TestPausedQueueKeepsJobsPending(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Stop()
+
+	var handled int32
+	q.Pause()
+	q.Start(2, func(payload json.RawMessage) (interface{}, error) {
+		atomic.AddInt32(&handled, 1)
+		return nil, nil
+	})
+
+	job, err := q.Enqueue("", "paused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&handled) != 0 {
+		t.Fatal("a job was processed while the queue was paused")
+	}
+
+	q.Resume()
+	waitForState(t, q, job.ID, StateDone)
+}
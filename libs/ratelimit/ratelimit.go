@@ -0,0 +1,190 @@
+// Package ratelimit limits the number of measurements accepted from each
+// sensor and from each caller with token buckets and daily quotas
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limit is the limit applied to each key. Rate is the number of
+// measurements per second that are refilled in the bucket, which holds up
+// to Burst measurements. Daily is the number of measurements accepted per
+// UTC day. Zero values disable the corresponding limit.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+	Daily int     `json:"daily"`
+}
+
+// Config is the configuration of the limits of the ingestion
+type Config struct {
+	Sensor Limit `json:"sensor"`
+	Caller Limit `json:"caller"`
+}
+
+// LimitError is returned when a key exceeds its limit
+type LimitError struct {
+	Key        string
+	Quota      bool
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	if e.Quota {
+		return fmt.Sprintf("The daily quota of %s has been exhausted", e.Key)
+	}
+	return fmt.Sprintf("The rate limit of %s has been exceeded", e.Key)
+}
+
+// RetryAfterSeconds returns the delay after which the key may retry,
+// rounded up to whole seconds as required by the Retry-After header
+func (e *LimitError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// evictInterval is the time between the removals of the idle buckets
+const evictInterval = time.Minute
+
+// Usage is the state of the limits of a key
+type Usage struct {
+	Key       string  `json:"key"`
+	Tokens    float64 `json:"tokens"`
+	Used      int     `json:"used"`
+	Daily     int     `json:"daily,omitempty"`
+	Remaining int     `json:"remaining,omitempty"`
+}
+
+// bucket is the state of a key
+type bucket struct {
+	tokens float64
+	last   time.Time
+	day    string
+	used   int
+}
+
+// Limiter applies the same limit to every key
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	evicted time.Time
+}
+
+// NewLimiter creates a limiter
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// SetLimit changes the limit applied to every key. The state of the keys is
+// kept: the buckets are only capped to the new burst.
+func (l *Limiter) SetLimit(limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+}
+
+// Allow consumes a token and a unit of the daily quota of the key. If the
+// key has exhausted any of them, nothing is consumed and a *LimitError is
+// returned.
+func (l *Limiter) Allow(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit.Rate <= 0 && l.limit.Daily <= 0 {
+		return nil
+	}
+
+	now := l.now().UTC()
+	if now.Sub(l.evicted) >= evictInterval {
+		l.evict(now)
+	}
+	b := l.bucket(key, now)
+
+	if l.limit.Daily > 0 && b.used >= l.limit.Daily {
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		return &LimitError{Key: key, Quota: true, RetryAfter: midnight.Sub(now)}
+	}
+
+	if l.limit.Rate > 0 {
+		if b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+			return &LimitError{Key: key, RetryAfter: wait}
+		}
+		b.tokens--
+	}
+	b.used++
+
+	return nil
+}
+
+// Usage returns the state of the limits of every key, sorted by key
+func (l *Limiter) Usage() []Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now().UTC()
+	usage := make([]Usage, 0, len(l.buckets))
+	for key := range l.buckets {
+		b := l.bucket(key, now)
+		u := Usage{Key: key, Tokens: b.tokens, Used: b.used, Daily: l.limit.Daily}
+		if l.limit.Daily > 0 {
+			u.Remaining = l.limit.Daily - b.used
+		}
+		usage = append(usage, u)
+	}
+
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Key < usage[j].Key })
+	return usage
+}
+
+// evict removes the buckets that are full and have not been used today.
+// They are in the same state as new ones, so removing them does not change
+// the limits. The caller must hold the lock.
+func (l *Limiter) evict(now time.Time) {
+	l.evicted = now
+	burst := math.Max(1, float64(l.limit.Burst))
+	for key := range l.buckets {
+		if b := l.bucket(key, now); b.tokens >= burst && b.used == 0 {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// bucket returns the bucket of the key, refilled up to now. The caller must
+// hold the lock.
+func (l *Limiter) bucket(key string, now time.Time) *bucket {
+	burst := float64(l.limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * l.limit.Rate
+		b.last = now
+	}
+	b.tokens = math.Min(burst, b.tokens)
+
+	// The daily quota is reset at midnight UTC
+	if day := now.Format("2006-01-02"); day != b.day {
+		b.day = day
+		b.used = 0
+	}
+
+	return b
+}
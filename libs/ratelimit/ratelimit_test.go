@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestLimiter creates a limiter whose clock is controlled by the test
+func newTestLimiter(limit Limit, now *time.Time) *Limiter {
+	l := NewLimiter(limit)
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2020, 9, 9, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(Limit{Rate: 0.5, Burst: 2}, &now)
+
+	for i := 0; i < 2; i++ {
+		if err := l.Allow("sensor"); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+
+	var limitErr *LimitError
+	if err := l.Allow("sensor"); !errors.As(err, &limitErr) || limitErr.Quota {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+	if limitErr.RetryAfterSeconds() != 2 {
+		t.Errorf("expected to retry after 2s, got %v", limitErr.RetryAfter)
+	}
+
+	// Other keys have their own bucket
+	if err := l.Allow("other"); err != nil {
+		t.Error(err)
+	}
+
+	now = now.Add(2 * time.Second)
+	if err := l.Allow("sensor"); err != nil {
+		t.Errorf("expected a refilled token: %v", err)
+	}
+}
+
+func TestDailyQuota(t *testing.T) {
+	now := time.Date(2020, 9, 9, 23, 0, 0, 0, time.UTC)
+	l := newTestLimiter(Limit{Daily: 2}, &now)
+
+	l.Allow("sensor")
+	l.Allow("sensor")
+
+	var limitErr *LimitError
+	if err := l.Allow("sensor"); !errors.As(err, &limitErr) || !limitErr.Quota {
+		t.Fatalf("expected a quota error, got %v", err)
+	}
+	if limitErr.RetryAfter != time.Hour {
+		t.Errorf("expected to retry at midnight, got %v", limitErr.RetryAfter)
+	}
+
+	usage := l.Usage()
+	if len(usage) != 1 || usage[0].Used != 2 || usage[0].Remaining != 0 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	now = now.Add(time.Hour)
+	if err := l.Allow("sensor"); err != nil {
+		t.Errorf("expected the quota to be reset: %v", err)
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := NewLimiter(Limit{})
+	for i := 0; i < 1000; i++ {
+		if err := l.Allow("sensor"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	now := time.Date(2020, 9, 9, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(Limit{Rate: 1, Burst: 10}, &now)
+	l.Allow("sensor")
+
+	l.SetLimit(Limit{Rate: 1, Burst: 2, Daily: 2})
+	if err := l.Allow("sensor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Allow("sensor"); err == nil {
+		t.Error("expected the new daily quota to be applied")
+	}
+	if usage := l.Usage(); usage[0].Tokens > 2 {
+		t.Errorf("the bucket was not capped to the new burst: %+v", usage)
+	}
+}
+
+func TestIdleBucketsAreEvicted(t *testing.T) {
+	now := time.Date(2020, 9, 9, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(Limit{Rate: 1, Burst: 1, Daily: 10}, &now)
+	l.Allow("old")
+
+	// The bucket is full again, but it was used today
+	now = now.Add(time.Hour)
+	l.Allow("new")
+	if len(l.Usage()) != 2 {
+		t.Fatalf("a bucket used today was evicted: %+v", l.Usage())
+	}
+
+	now = now.Add(24 * time.Hour)
+	if err := l.Allow("new"); err != nil {
+		t.Fatal(err)
+	}
+	if usage := l.Usage(); len(usage) != 1 || usage[0].Key != "new" {
+		t.Errorf("the idle bucket was not evicted: %+v", usage)
+	}
+}
@@ -0,0 +1,285 @@
+// Package revenue indexes the purchases of the measurements of the producer
+// in the marketplace and reports the revenue they bring. The events of the
+// balance contract are read by a Watcher and stored in a local LevelDB
+// index.
+package revenue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// States of a purchase
+const (
+	StatePending   = "pending"
+	StateCompleted = "completed"
+	StateRevoked   = "revoked"
+)
+
+// Unknown is the sensor and entity type of the measurements that were not
+// recorded in the index
+const Unknown = "unknown"
+
+// dayLayout is the layout of the days of the report
+const dayLayout = "2006-01-02"
+
+// Prefixes of the keys of the index
+var (
+	cursorKey      = []byte("cursor")
+	ownerPrefix    = []byte("owner/")
+	pricePrefix    = []byte("price/")
+	itemPrefix     = []byte("item/")
+	purchasePrefix = []byte("purchase/")
+	openPrefix     = []byte("open/")
+)
+
+// Part is the share of a sensor in a measurement that is sold. A single
+// measurement has one part. The revenue of the root of an anchored batch is
+// split among its measurements by their Weight.
+type Part struct {
+	Sensor string `json:"sensor"`
+	Type   string `json:"type"`
+	Weight int64  `json:"weight"`
+}
+
+// item is a measurement that can be purchased
+type item struct {
+	Parts []Part `json:"parts"`
+}
+
+// priceChange is a price set to a measurement
+type priceChange struct {
+	Block uint64   `json:"block"`
+	Price *big.Int `json:"price"`
+}
+
+// Purchase is a purchase of a measurement of the producer. DeliveryTx is
+// the transaction given by the administrator when the purchase was
+// completed.
+type Purchase struct {
+	Hash        common.Hash    `json:"hash"`
+	Buyer       common.Address `json:"buyer"`
+	Price       *big.Int       `json:"price"`
+	State       string         `json:"state"`
+	RequestTx   common.Hash    `json:"requestTx"`
+	RequestedAt time.Time      `json:"requestedAt"`
+	ClosedAt    time.Time      `json:"closedAt"`
+	DeliveryTx  common.Hash    `json:"deliveryTx"`
+}
+
+// Report is the revenue of the purchases completed in a period, by sensor,
+// entity type and day (UTC). Pending are the purchases whose tokens are
+// still retained and Revoked the purchases revoked in the period.
+type Report struct {
+	Revenue  *big.Int            `json:"revenue"`
+	Sales    int                 `json:"sales"`
+	BySensor map[string]*big.Int `json:"bySensor"`
+	ByType   map[string]*big.Int `json:"byType"`
+	ByDay    map[string]*big.Int `json:"byDay"`
+	Pending  []Purchase          `json:"pending"`
+	Revoked  []Purchase          `json:"revoked"`
+}
+
+// Index is the local index of the purchases
+type Index struct {
+	db *leveldb.DB
+}
+
+// OpenIndex opens the index stored in the folder path, creating it if
+// required
+func OpenIndex(path string) (*Index, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Index{db: db}, nil
+}
+
+// Close closes the index
+func (ix *Index) Close() error {
+	return ix.db.Close()
+}
+
+// RecordMeasurement records the sensor and the entity type of a stored
+// measurement
+func (ix *Index) RecordMeasurement(hash common.Hash, sensor, entityType string) error {
+	return ix.RecordBatch(hash, []Part{{Sensor: sensor, Type: entityType, Weight: 1}})
+}
+
+// RecordBatch records the measurements anchored under root, weighted by
+// their share of the price of the batch
+func (ix *Index) RecordBatch(root common.Hash, parts []Part) error {
+	return ix.put(nil, key(itemPrefix, root[:]), item{Parts: parts})
+}
+
+// Report reports the revenue of the purchases closed between from and to
+func (ix *Index) Report(from, to time.Time) (*Report, error) {
+	report := &Report{
+		Revenue:  new(big.Int),
+		BySensor: make(map[string]*big.Int),
+		ByType:   make(map[string]*big.Int),
+		ByDay:    make(map[string]*big.Int),
+		Pending:  []Purchase{},
+		Revoked:  []Purchase{},
+	}
+
+	iter := ix.db.NewIterator(util.BytesPrefix(purchasePrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		var p Purchase
+		if err := json.Unmarshal(iter.Value(), &p); err != nil {
+			return nil, err
+		}
+
+		inPeriod := !p.ClosedAt.Before(from) && p.ClosedAt.Before(to)
+		switch {
+		case p.State == StatePending:
+			report.Pending = append(report.Pending, p)
+		case p.State == StateRevoked && inPeriod:
+			report.Revoked = append(report.Revoked, p)
+		case p.State == StateCompleted && inPeriod:
+			if err := ix.addSale(report, p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return report, iter.Error()
+}
+
+// addSale adds a completed purchase to the report
+func (ix *Index) addSale(report *Report, p Purchase) error {
+	var it item
+	ok, err := ix.get(key(itemPrefix, p.Hash[:]), &it)
+	if err != nil {
+		return err
+	}
+	if !ok || len(it.Parts) == 0 {
+		it.Parts = []Part{{Sensor: Unknown, Type: Unknown, Weight: 1}}
+	}
+
+	report.Sales++
+	report.Revenue.Add(report.Revenue, p.Price)
+	add(report.ByDay, p.ClosedAt.UTC().Format(dayLayout), p.Price)
+
+	for i, share := range split(p.Price, it.Parts) {
+		add(report.BySensor, it.Parts[i].Sensor, share)
+		add(report.ByType, it.Parts[i].Type, share)
+	}
+	return nil
+}
+
+// split splits amount among the parts by their weights. The remainder of
+// the division goes to the first part.
+func split(amount *big.Int, parts []Part) []*big.Int {
+	total := int64(0)
+	for _, part := range parts {
+		total += part.Weight
+	}
+
+	// Without weights the amount is split evenly
+	even := total == 0
+	if even {
+		total = int64(len(parts))
+	}
+
+	shares := make([]*big.Int, len(parts))
+	rest := new(big.Int).Set(amount)
+	for i, part := range parts {
+		weight := part.Weight
+		if even {
+			weight = 1
+		}
+		shares[i] = new(big.Int).Mul(amount, big.NewInt(weight))
+		shares[i].Div(shares[i], big.NewInt(total))
+		rest.Sub(rest, shares[i])
+	}
+	shares[0].Add(shares[0], rest)
+	return shares
+}
+
+// add adds amount to the entry name of totals
+func add(totals map[string]*big.Int, name string, amount *big.Int) {
+	if totals[name] == nil {
+		totals[name] = new(big.Int)
+	}
+	totals[name].Add(totals[name], amount)
+}
+
+// cursor returns the position of the last event that was indexed
+func (ix *Index) cursor() (block uint64, index uint, ok bool, err error) {
+	value, err := ix.db.Get(cursorKey, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if len(value) != 16 {
+		return 0, 0, false, errors.New("The cursor of the revenue index is corrupted")
+	}
+	return binary.BigEndian.Uint64(value), uint(binary.BigEndian.Uint64(value[8:])), true, nil
+}
+
+// setCursor records the position of the last event that was indexed
+func setCursor(batch *leveldb.Batch, block uint64, index uint) {
+	value := make([]byte, 16)
+	binary.BigEndian.PutUint64(value, block)
+	binary.BigEndian.PutUint64(value[8:], uint64(index))
+	batch.Put(cursorKey, value)
+}
+
+// priceAt returns the price of a measurement at a block, if it was set
+func (ix *Index) priceAt(hash common.Hash, block uint64) (*big.Int, bool, error) {
+	var changes []priceChange
+	if _, err := ix.get(key(pricePrefix, hash[:]), &changes); err != nil {
+		return nil, false, err
+	}
+
+	i := sort.Search(len(changes), func(i int) bool { return changes[i].Block > block })
+	if i == 0 {
+		return nil, false, nil
+	}
+	return changes[i-1].Price, true, nil
+}
+
+// get decodes the value of a key. ok is false if the key is not set.
+func (ix *Index) get(k []byte, v interface{}) (ok bool, err error) {
+	value, err := ix.db.Get(k, nil)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(value, v)
+}
+
+// put encodes a value in batch, or directly in the index if batch is nil
+func (ix *Index) put(batch *leveldb.Batch, k []byte, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if batch == nil {
+		return ix.db.Put(k, value, nil)
+	}
+	batch.Put(k, value)
+	return nil
+}
+
+// key joins a prefix and the parts of a key
+func key(prefix []byte, parts ...[]byte) []byte {
+	k := append([]byte(nil), prefix...)
+	for _, part := range parts {
+		k = append(k, part...)
+	}
+	return k
+}
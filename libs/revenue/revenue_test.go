@@ -0,0 +1,254 @@
+package revenue
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	balanceContract "administrator/ipfs-node/contracts/balanceContract"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	contractAddr = common.HexToAddress("0xc0")
+	producer     = common.HexToAddress("0x01")
+	otherIoT     = common.HexToAddress("0x02")
+
+	// Block n was mined n hours after day0
+	day0 = time.Date(2020, 11, 20, 0, 0, 0, 0, time.UTC)
+)
+
+// chain is a Blockchain whose blocks only hold the events of the balance
+// contract
+type chain struct {
+	abi    abi.ABI
+	head   uint64
+	logs   []types.Log
+	owners map[common.Hash]common.Address
+	calls  int
+}
+
+func newChain(t *testing.T) *chain {
+	parsed, err := abi.JSON(strings.NewReader(balanceContract.BalanceContractABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &chain{abi: parsed, owners: make(map[common.Hash]common.Address)}
+}
+
+func (c *chain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, l := range c.logs {
+		if l.BlockNumber >= q.FromBlock.Uint64() && l.BlockNumber <= q.ToBlock.Uint64() {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+func (c *chain) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, ethereum.NotFound
+}
+
+func (c *chain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	n := c.head
+	if number != nil {
+		n = number.Uint64()
+	}
+	return &types.Header{Number: new(big.Int).SetUint64(n), Time: uint64(day0.Add(time.Duration(n) * time.Hour).Unix())}, nil
+}
+
+func (c *chain) GetIoTAddress(opts *bind.CallOpts, hash [32]byte) (common.Address, error) {
+	c.calls++
+	return c.owners[hash], nil
+}
+
+// emit adds an event of the balance contract to a block
+func (c *chain) emit(block uint64, name string, data []byte, topics ...common.Hash) {
+	if block > c.head {
+		c.head = block
+	}
+	c.logs = append(c.logs, types.Log{
+		Address:     contractAddr,
+		Topics:      append([]common.Hash{c.abi.Events[name].ID}, topics...),
+		Data:        data,
+		BlockNumber: block,
+		Index:       uint(len(c.logs)),
+	})
+}
+
+func (c *chain) priceSet(block uint64, hash common.Hash, price int64) {
+	c.emit(block, "PriceSet", common.LeftPadBytes(big.NewInt(price).Bytes(), 32), hash)
+}
+
+func (c *chain) request(block uint64, hash common.Hash, buyer, owner common.Address) {
+	c.emit(block, "RequestPurchase", nil, hash, buyer.Hash(), owner.Hash())
+}
+
+func (c *chain) complete(block uint64, hash common.Hash, buyer, owner common.Address) {
+	c.emit(block, "CompletePurchase", common.HexToHash("0xde").Bytes(), hash, buyer.Hash(), owner.Hash())
+}
+
+func (c *chain) revoke(block uint64, hash common.Hash, buyer, owner common.Address) {
+	c.emit(block, "PurchaseRevoked", nil, hash, buyer.Hash(), owner.Hash())
+}
+
+func newWatcher(t *testing.T, c *chain) (*Index, *Watcher) {
+	index, err := OpenIndex(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { index.Close() })
+
+	w, err := NewWatcher(index, c, c, contractAddr, producer, Config{Poll: 1, Confirmations: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index, w
+}
+
+func buyer(n int64) common.Address {
+	return common.BigToAddress(big.NewInt(0x100 + n))
+}
+
+func TestReport(t *testing.T) {
+	single := common.HexToHash("0xa1")
+	root := common.HexToHash("0xb1")
+	foreign := common.HexToHash("0xf1")
+
+	c := newChain(t)
+	c.owners[single] = producer
+	c.owners[root] = producer
+	c.owners[foreign] = otherIoT
+
+	index, w := newWatcher(t, c)
+	if err := index.RecordMeasurement(single, "sensor1", "Room"); err != nil {
+		t.Fatal(err)
+	}
+	err := index.RecordBatch(root, []Part{{"sensor1", "Room", 1}, {"sensor2", "Street", 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.priceSet(1, single, 10)
+	c.priceSet(1, foreign, 7)
+	c.priceSet(2, root, 100)
+	c.request(3, single, buyer(1), producer)
+	c.request(3, foreign, buyer(1), otherIoT)
+	c.complete(4, single, buyer(1), producer)
+	c.complete(4, foreign, buyer(1), otherIoT)
+	c.request(5, root, buyer(2), producer)
+	c.request(6, single, buyer(3), producer)
+	c.revoke(7, single, buyer(3), producer)
+	c.request(8, single, buyer(4), producer)
+	if err := w.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The events already indexed are read again with the new ones
+	c.priceSet(9, single, 20)
+	c.request(10, single, buyer(5), producer)
+	c.complete(30, root, buyer(2), producer)
+	for i := 0; i < 2; i++ {
+		if err := w.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := index.Report(day0, day0.Add(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(what string, got *big.Int, want int64) {
+		t.Helper()
+		if got == nil || got.Int64() != want {
+			t.Errorf("%s: got %v, want %d", what, got, want)
+		}
+	}
+	expect("revenue", report.Revenue, 110)
+	expect("sensor1", report.BySensor["sensor1"], 35)
+	expect("sensor2", report.BySensor["sensor2"], 75)
+	expect("Room", report.ByType["Room"], 35)
+	expect("Street", report.ByType["Street"], 75)
+	expect("first day", report.ByDay["2020-11-20"], 10)
+	expect("second day", report.ByDay["2020-11-21"], 100)
+	if report.Sales != 2 {
+		t.Errorf("got %d sales, want 2", report.Sales)
+	}
+
+	if len(report.Pending) != 2 {
+		t.Fatalf("got %d pending purchases, want 2", len(report.Pending))
+	}
+	expect("pending price", report.Pending[0].Price, 10)
+	expect("pending price after the change", report.Pending[1].Price, 20)
+	if len(report.Revoked) != 1 || report.Revoked[0].Buyer != buyer(3) {
+		t.Errorf("unexpected revoked purchases %+v", report.Revoked)
+	}
+
+	// The owner of a measurement is asked once
+	if c.calls != 3 {
+		t.Errorf("the ledger was called %d times, want 3", c.calls)
+	}
+
+	report, err = index.Report(day0.Add(24*time.Hour), day0.Add(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect("revenue of the second day", report.Revenue, 100)
+}
+
+func TestConfirmations(t *testing.T) {
+	single := common.HexToHash("0xa1")
+	c := newChain(t)
+	c.owners[single] = producer
+
+	index, w := newWatcher(t, c)
+	w.config.Confirmations = 3
+
+	c.priceSet(1, single, 10)
+	c.request(2, single, buyer(1), producer)
+	c.complete(3, single, buyer(1), producer)
+	if err := w.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := index.Report(day0, day0.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sales != 0 || len(report.Pending) != 0 {
+		t.Fatalf("unconfirmed events were indexed: %+v", report)
+	}
+
+	c.head = 5
+	if err := w.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	report, err = index.Report(day0, day0.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sales != 1 || report.BySensor[Unknown].Int64() != 10 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	shares := split(big.NewInt(10), []Part{{Weight: 1}, {Weight: 1}, {Weight: 1}})
+	if shares[0].Int64() != 4 || shares[1].Int64() != 3 || shares[2].Int64() != 3 {
+		t.Errorf("unexpected shares %v", shares)
+	}
+
+	shares = split(big.NewInt(9), []Part{{Weight: 0}, {Weight: 0}})
+	if shares[0].Int64() != 5 || shares[1].Int64() != 4 {
+		t.Errorf("unexpected shares %v", shares)
+	}
+}
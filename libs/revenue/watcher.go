@@ -0,0 +1,384 @@
+package revenue
+
+import (
+	"context"
+	"encoding/binary"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	balanceContract "administrator/ipfs-node/contracts/balanceContract"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// maxRange is the maximum number of blocks whose events are read at once
+const maxRange = 5000
+
+// endOfBlock is the position of the cursor once all the events of its block
+// are indexed
+const endOfBlock = ^uint(0) >> 1
+
+// Config is the configuration of the revenue watcher. The events of the
+// balance contract are read from the block FromBlock every Poll seconds,
+// once they have Confirmations confirmations, and indexed in the folder
+// Path.
+type Config struct {
+	Enabled       bool   `json:"enabled"`
+	Path          string `json:"path"`
+	FromBlock     uint64 `json:"fromBlock"`
+	Poll          int    `json:"poll"`
+	Confirmations uint64 `json:"confirmations"`
+}
+
+// Backend reads the events of the balance contract
+type Backend interface {
+	ethereum.LogFilterer
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// Ledger tells who stored a measurement in the data contract
+type Ledger interface {
+	GetIoTAddress(opts *bind.CallOpts, hash [32]byte) (common.Address, error)
+}
+
+// Watcher indexes the events of the balance contract about the
+// measurements of an account
+type Watcher struct {
+	index    *Index
+	backend  Backend
+	ledger   Ledger
+	filterer *balanceContract.BalanceContractFilterer
+	contract common.Address
+	account  common.Address
+	config   Config
+	topics   []common.Hash
+
+	// mu makes sure the events are indexed by one Sync at a time
+	mu sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWatcher creates a watcher of the purchases of the measurements of
+// account in the balance contract deployed at contract
+func NewWatcher(index *Index, backend Backend, ledger Ledger, contract, account common.Address, config Config) (*Watcher, error) {
+	filterer, err := balanceContract.NewBalanceContractFilterer(contract, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(balanceContract.BalanceContractABI))
+	if err != nil {
+		return nil, err
+	}
+	var topics []common.Hash
+	for _, name := range []string{"PriceSet", "RequestPurchase", "CompletePurchase", "PurchaseRevoked"} {
+		topics = append(topics, parsed.Events[name].ID)
+	}
+
+	return &Watcher{
+		index:    index,
+		backend:  backend,
+		ledger:   ledger,
+		filterer: filterer,
+		contract: contract,
+		account:  account,
+		config:   config,
+		topics:   topics,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start indexes the new events every Poll seconds until Stop is called
+func (w *Watcher) Start() {
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(time.Duration(w.config.Poll) * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := w.Sync(context.Background()); err != nil {
+				log.Printf("Could not index the purchases of the measurements: %v\n", err)
+			}
+
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop waits until the events that are being indexed are stored
+func (w *Watcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// Sync indexes the events of the confirmed blocks that were not indexed
+// yet
+func (w *Watcher) Sync(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	head, err := w.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	last := head.Number.Uint64()
+	if w.config.Confirmations > 1 {
+		if last+1 < w.config.Confirmations {
+			return nil
+		}
+		last = last + 1 - w.config.Confirmations
+	}
+
+	from := w.config.FromBlock
+	cursorBlock, cursorIndex, ok, err := w.index.cursor()
+	if err != nil {
+		return err
+	}
+	if ok {
+		from = cursorBlock + 1
+		if cursorIndex != endOfBlock {
+			from = cursorBlock
+		}
+	}
+
+	times := make(map[uint64]time.Time)
+	for from <= last {
+		to := from + maxRange - 1
+		if to > last {
+			to = last
+		}
+
+		logs, err := w.backend.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(from),
+			ToBlock:   new(big.Int).SetUint64(to),
+			Addresses: []common.Address{w.contract},
+			Topics:    [][]common.Hash{w.topics},
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, l := range logs {
+			// The events up to the cursor are already indexed
+			if ok && (l.BlockNumber < cursorBlock || l.BlockNumber == cursorBlock && l.Index <= cursorIndex) {
+				continue
+			}
+			if err := w.apply(ctx, l, times); err != nil {
+				return err
+			}
+		}
+
+		// Move the cursor to the end of the range, so the blocks without
+		// events are not read again
+		batch := new(leveldb.Batch)
+		setCursor(batch, to, endOfBlock)
+		if err := w.index.db.Write(batch, nil); err != nil {
+			return err
+		}
+		cursorBlock, cursorIndex, ok = to, endOfBlock, true
+		from = to + 1
+	}
+	return nil
+}
+
+// apply indexes an event. The changes and the cursor are written at once,
+// so an event is never indexed twice.
+func (w *Watcher) apply(ctx context.Context, l types.Log, times map[uint64]time.Time) error {
+	batch := new(leveldb.Batch)
+	var err error
+
+	switch l.Topics[0] {
+	case w.topics[0]:
+		err = w.applyPriceSet(ctx, batch, l)
+	case w.topics[1]:
+		err = w.applyRequest(ctx, batch, l, times)
+	case w.topics[2], w.topics[3]:
+		err = w.applyClose(ctx, batch, l, times)
+	}
+	if err != nil {
+		return err
+	}
+
+	setCursor(batch, l.BlockNumber, l.Index)
+	return w.index.db.Write(batch, nil)
+}
+
+// applyPriceSet records the price set to a measurement of the account
+func (w *Watcher) applyPriceSet(ctx context.Context, batch *leveldb.Batch, l types.Log) error {
+	e, err := w.filterer.ParsePriceSet(l)
+	if err != nil {
+		return err
+	}
+
+	owned, err := w.owned(ctx, batch, e.Hash)
+	if err != nil || !owned {
+		return err
+	}
+
+	var changes []priceChange
+	if _, err := w.index.get(key(pricePrefix, e.Hash[:]), &changes); err != nil {
+		return err
+	}
+	changes = append(changes, priceChange{Block: l.BlockNumber, Price: e.Price})
+	return w.index.put(batch, key(pricePrefix, e.Hash[:]), changes)
+}
+
+// applyRequest records a purchase of a measurement of the account. Its
+// price is the price of the measurement when it was requested.
+func (w *Watcher) applyRequest(ctx context.Context, batch *leveldb.Batch, l types.Log, times map[uint64]time.Time) error {
+	e, err := w.filterer.ParseRequestPurchase(l)
+	if err != nil {
+		return err
+	}
+	if e.To != w.account {
+		return nil
+	}
+
+	p, err := w.newPurchase(ctx, e.Hash, e.From, l, times)
+	if err != nil {
+		return err
+	}
+
+	purchaseKey := key(purchasePrefix, position(l))
+	batch.Put(key(openPrefix, e.Hash[:], e.From[:]), purchaseKey)
+	return w.index.put(batch, purchaseKey, p)
+}
+
+// applyClose records a purchase of a measurement of the account that was
+// completed or revoked by the administrator
+func (w *Watcher) applyClose(ctx context.Context, batch *leveldb.Batch, l types.Log, times map[uint64]time.Time) error {
+	var hash [32]byte
+	var buyer, owner common.Address
+	var deliveryTx common.Hash
+	state := StateCompleted
+
+	if l.Topics[0] == w.topics[2] {
+		e, err := w.filterer.ParseCompletePurchase(l)
+		if err != nil {
+			return err
+		}
+		hash, buyer, owner, deliveryTx = e.Hash, e.From, e.To, e.TxHash
+	} else {
+		e, err := w.filterer.ParsePurchaseRevoked(l)
+		if err != nil {
+			return err
+		}
+		hash, buyer, owner = e.Hash, e.From, e.To
+		state = StateRevoked
+	}
+	if owner != w.account {
+		return nil
+	}
+
+	closedAt, err := w.blockTime(ctx, l.BlockNumber, times)
+	if err != nil {
+		return err
+	}
+
+	// The purchase may have been requested before the first indexed block
+	openKey := key(openPrefix, hash[:], buyer[:])
+	purchaseKey, err := w.index.db.Get(openKey, nil)
+	var p Purchase
+	switch err {
+	case nil:
+		if _, err := w.index.get(purchaseKey, &p); err != nil {
+			return err
+		}
+	case leveldb.ErrNotFound:
+		purchaseKey = key(purchasePrefix, position(l))
+		np, err := w.newPurchase(ctx, hash, buyer, l, times)
+		if err != nil {
+			return err
+		}
+		p = *np
+	default:
+		return err
+	}
+
+	p.State = state
+	p.ClosedAt = closedAt
+	p.DeliveryTx = deliveryTx
+	batch.Delete(openKey)
+	return w.index.put(batch, purchaseKey, p)
+}
+
+// newPurchase creates a pending purchase requested by the event l
+func (w *Watcher) newPurchase(ctx context.Context, hash common.Hash, buyer common.Address, l types.Log, times map[uint64]time.Time) (*Purchase, error) {
+	requestedAt, err := w.blockTime(ctx, l.BlockNumber, times)
+	if err != nil {
+		return nil, err
+	}
+
+	price, ok, err := w.index.priceAt(hash, l.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		price = new(big.Int)
+		log.Printf("The price of the measurement %s purchased at block %d is unknown\n", hash.Hex(), l.BlockNumber)
+	}
+
+	return &Purchase{
+		Hash:        hash,
+		Buyer:       buyer,
+		Price:       price,
+		State:       StatePending,
+		RequestTx:   l.TxHash,
+		RequestedAt: requestedAt,
+	}, nil
+}
+
+// owned tells whether a measurement was stored by the account. The answer
+// is kept in the index.
+func (w *Watcher) owned(ctx context.Context, batch *leveldb.Batch, hash common.Hash) (bool, error) {
+	var owned bool
+	ok, err := w.index.get(key(ownerPrefix, hash[:]), &owned)
+	if err != nil || ok {
+		return owned, err
+	}
+
+	owner, err := w.ledger.GetIoTAddress(&bind.CallOpts{Context: ctx}, hash)
+	if err != nil {
+		return false, err
+	}
+	owned = owner == w.account
+	return owned, w.index.put(batch, key(ownerPrefix, hash[:]), owned)
+}
+
+// blockTime returns the time of a block
+func (w *Watcher) blockTime(ctx context.Context, number uint64, times map[uint64]time.Time) (time.Time, error) {
+	if t, ok := times[number]; ok {
+		return t, nil
+	}
+
+	header, err := w.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return time.Time{}, err
+	}
+	t := time.Unix(int64(header.Time), 0).UTC()
+	times[number] = t
+	return t, nil
+}
+
+// position is the key of an event in the order of the chain
+func position(l types.Log) []byte {
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, l.BlockNumber)
+	binary.BigEndian.PutUint64(k[8:], uint64(l.Index))
+	return k
+}
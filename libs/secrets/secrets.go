@@ -0,0 +1,114 @@
+// Package secrets reads the secrets of the proxy, such as the password of
+// the keystore, from sources other than the configuration file: systemd
+// credentials, files with restricted permissions, environment variables and
+// an interactive prompt
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// redacted is printed instead of the value of a secret
+const redacted = "[REDACTED]"
+
+// ErrNotFound is returned when none of the sources provides the secret
+var ErrNotFound = errors.New("The secret was not found in any of the configured sources")
+
+// Secret is a value that must not be logged. It is printed and encoded as
+// [REDACTED]; Reveal returns the actual value.
+type Secret string
+
+// Reveal returns the value of the secret
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// String redacts the secret when it is printed
+func (s Secret) String() string {
+	return redacted
+}
+
+// GoString redacts the secret when it is printed with %#v
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// MarshalJSON redacts the secret when it is encoded
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// Source lists where a secret may be found. They are tried in this order:
+// the systemd credential named Credential (in $CREDENTIALS_DIRECTORY), the
+// file File, the environment variable Env and, if Prompt is set and the
+// standard input is a terminal, an interactive prompt.
+type Source struct {
+	Credential string `json:"credential"`
+	File       string `json:"file"`
+	Env        string `json:"env"`
+	Prompt     bool   `json:"prompt"`
+}
+
+// Resolve reads the secret from the first source that provides it. name
+// describes the secret in the prompt and in the errors.
+func (s Source) Resolve(name string) (Secret, error) {
+	if s.Credential != "" {
+		if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+			path := filepath.Join(dir, s.Credential)
+			if _, err := os.Stat(path); err == nil {
+				return ReadFile(path)
+			}
+		}
+	}
+
+	if s.File != "" {
+		return ReadFile(s.File)
+	}
+
+	if s.Env != "" {
+		if value, ok := os.LookupEnv(s.Env); ok {
+			// Child processes must not inherit the secret
+			os.Unsetenv(s.Env)
+			return Secret(value), nil
+		}
+	}
+
+	if s.Prompt && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "Enter the %s: ", name)
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		return Secret(value), nil
+	}
+
+	return "", fmt.Errorf("%s: %w", name, ErrNotFound)
+}
+
+// ReadFile reads a secret from a file. Files that can be accessed by other
+// users are refused. A trailing new line is not part of the secret.
+func ReadFile(path string) (Secret, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0007 != 0 {
+		return "", fmt.Errorf("The secret file %s can be accessed by other users (mode %04o), restrict it with chmod o-rwx", path, info.Mode().Perm())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	// The new line added by editors and echo is removed
+	return Secret(strings.TrimRight(string(data), "\r\n")), nil
+}
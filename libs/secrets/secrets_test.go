@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tempDir creates a temporary folder removed at the end of the test
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestSecretIsRedacted(t *testing.T) {
+	s := Secret("hunter2")
+	config := struct{ Password Secret }{s}
+
+	printed := fmt.Sprintf("%v %s %+v %#v", s, s, config, config)
+	encoded, _ := json.Marshal(config)
+	for _, out := range []string{printed, string(encoded)} {
+		if strings.Contains(out, "hunter2") {
+			t.Errorf("the secret was printed: %s", out)
+		}
+	}
+	if s.Reveal() != "hunter2" {
+		t.Error("unexpected value")
+	}
+}
+
+func TestReadFileRefusesOpenPermissions(t *testing.T) {
+	path := filepath.Join(tempDir(t), "password")
+	ioutil.WriteFile(path, []byte("hunter2\n"), 0644)
+	os.Chmod(path, 0644)
+
+	if _, err := ReadFile(path); err == nil {
+		t.Fatal("expected an error for a world readable file")
+	}
+
+	os.Chmod(path, 0640)
+	s, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Reveal() != "hunter2" {
+		t.Errorf("unexpected secret %q", s.Reveal())
+	}
+}
+
+func TestResolveOrder(t *testing.T) {
+	dir := tempDir(t)
+	ioutil.WriteFile(filepath.Join(dir, "keystore"), []byte("from-credential"), 0400)
+	file := filepath.Join(dir, "password")
+	ioutil.WriteFile(file, []byte("from-file"), 0600)
+
+	source := Source{Credential: "keystore", File: file, Env: "SECRETS_TEST_PASSWORD"}
+
+	os.Setenv("CREDENTIALS_DIRECTORY", dir)
+	s, err := source.Resolve("password")
+	os.Unsetenv("CREDENTIALS_DIRECTORY")
+	if err != nil || s.Reveal() != "from-credential" {
+		t.Errorf("expected the systemd credential, got %q %v", s.Reveal(), err)
+	}
+
+	if s, err := source.Resolve("password"); err != nil || s.Reveal() != "from-file" {
+		t.Errorf("expected the file, got %q %v", s.Reveal(), err)
+	}
+
+	source.File = ""
+	os.Setenv("SECRETS_TEST_PASSWORD", "from-env")
+	if s, err := source.Resolve("password"); err != nil || s.Reveal() != "from-env" {
+		t.Errorf("expected the environment variable, got %q %v", s.Reveal(), err)
+	}
+	if _, ok := os.LookupEnv("SECRETS_TEST_PASSWORD"); ok {
+		t.Error("the environment variable was not removed")
+	}
+
+	if _, err := source.Resolve("password"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
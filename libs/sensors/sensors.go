@@ -0,0 +1,271 @@
+// Package sensors verifies the payloads signed by the sensors. The public
+// keys of the sensors are registered in a local registry, and every signed
+// payload carries a timestamp and a nonce so that it cannot be replayed.
+package sensors
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ngsi "administrator/ipfs-node/libs/ngsi"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signature algorithms supported by the registry
+const (
+	AlgorithmSecp256k1 = "secp256k1"
+	AlgorithmEd25519   = "ed25519"
+)
+
+// Errors returned when a signed payload is not accepted
+var (
+	ErrUnknownSensor    = errors.New("The sensor is not registered")
+	ErrInvalidSignature = errors.New("The signature of the sensor is not valid")
+	ErrExpired          = errors.New("The timestamp of the signature is out of the accepted window")
+	ErrReplayed         = errors.New("The nonce of the signature has already been used")
+	ErrUnboundEntity    = errors.New("The entity is not bound to the sensor that signed it")
+)
+
+// Key is the public key of a sensor. It is encoded as hex: uncompressed or
+// compressed points for secp256k1, and 32 bytes for Ed25519. Entities are
+// the ids of the entities the sensor may report; an id ending in * matches
+// every id with that prefix. A sensor without entities may only report the
+// entity whose id is the id of the sensor.
+type Key struct {
+	Algorithm string   `json:"algorithm"`
+	PublicKey string   `json:"publicKey"`
+	Entities  []string `json:"entities,omitempty"`
+}
+
+// Envelope is a body signed by a sensor, for the transports that cannot
+// carry the signature in headers, such as MQTT and CoAP. The signature
+// covers the exact bytes of Body.
+type Envelope struct {
+	SensorID  string          `json:"sensorId"`
+	Timestamp int64           `json:"timestamp"`
+	Nonce     string          `json:"nonce"`
+	Signature string          `json:"signature"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// Registry holds the keys of the sensors indexed by sensor ID
+type Registry map[string]Key
+
+// Config is the configuration of the verification of the sensors'
+// signatures. If Required is set, unsigned payloads are rejected. Window is
+// the maximum difference, in seconds, between the timestamp of a signature
+// and the time it is received.
+type Config struct {
+	RegistryFile string `json:"registryFile"`
+	Required     bool   `json:"required"`
+	Window       int    `json:"window"`
+}
+
+// LoadRegistry reads the registry of the sensors from a JSON file
+func LoadRegistry(path string) (Registry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := make(Registry)
+	err = json.Unmarshal(data, &registry)
+	if err != nil {
+		return nil, err
+	}
+
+	for id, key := range registry {
+		if _, err := key.decode(); err != nil {
+			return nil, fmt.Errorf("Invalid key of sensor %s: %v", id, err)
+		}
+	}
+	return registry, nil
+}
+
+// ParseEnvelope decodes a signed envelope. ok is false if the payload is
+// not an envelope.
+func ParseEnvelope(payload []byte) (envelope *Envelope, ok bool) {
+	envelope = &Envelope{}
+	if err := json.Unmarshal(payload, envelope); err != nil {
+		return nil, false
+	}
+	if envelope.SensorID == "" || envelope.Signature == "" || len(envelope.Body) == 0 {
+		return nil, false
+	}
+	return envelope, true
+}
+
+// SigningMessage returns the message signed by the sensors: the timestamp
+// (unix seconds) and the nonce, each followed by a new line, and the body
+func SigningMessage(timestamp int64, nonce string, body []byte) []byte {
+	msg := []byte(strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n")
+	return append(msg, body...)
+}
+
+// Verify checks a signature made with the key over a message. secp256k1
+// signatures are made over the Keccak-256 hash of the message, in the
+// [R || S || V] format of go-ethereum (V is optional).
+func (k Key) Verify(message []byte, signature []byte) error {
+	pubKey, err := k.decode()
+	if err != nil {
+		return err
+	}
+
+	switch k.Algorithm {
+	case AlgorithmSecp256k1:
+		if len(signature) == 65 {
+			signature = signature[:64]
+		}
+		if len(signature) != 64 || !crypto.VerifySignature(pubKey, crypto.Keccak256(message), signature) {
+			return ErrInvalidSignature
+		}
+	case AlgorithmEd25519:
+		if !ed25519.Verify(ed25519.PublicKey(pubKey), message, signature) {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+// Reports tells whether the sensor sensorID, whose key is k, may report
+// the entity entityID
+func (k Key) Reports(sensorID, entityID string) bool {
+	if len(k.Entities) == 0 {
+		return entityID == sensorID
+	}
+	for _, id := range k.Entities {
+		if id == entityID || strings.HasSuffix(id, "*") && strings.HasPrefix(entityID, strings.TrimSuffix(id, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// decode checks and decodes the public key
+func (k Key) decode() ([]byte, error) {
+	pubKey, err := decodeHex(k.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch k.Algorithm {
+	case AlgorithmSecp256k1:
+		if len(pubKey) == 33 {
+			_, err = crypto.DecompressPubkey(pubKey)
+		} else {
+			_, err = crypto.UnmarshalPubkey(pubKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case AlgorithmEd25519:
+		if len(pubKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Ed25519 public keys are %d bytes long", ed25519.PublicKeySize)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown algorithm %q", k.Algorithm)
+	}
+	return pubKey, nil
+}
+
+// Verifier verifies the signed payloads and remembers the nonces that have
+// been used within the window
+type Verifier struct {
+	registry Registry
+	window   time.Duration
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewVerifier creates a verifier of the sensors of the registry
+func NewVerifier(registry Registry, window time.Duration) *Verifier {
+	return &Verifier{
+		registry: registry,
+		window:   window,
+		nonces:   make(map[string]time.Time),
+	}
+}
+
+// Verify checks the signature of a body sent by a sensor. The timestamp
+// must be within the window, and the nonce must not have been used by the
+// sensor before. The returned provenance is kept with the measurements of
+// the body, which must store the body once.
+func (v *Verifier) Verify(sensorID string, timestamp int64, nonce string, signature string, body []byte) (*ngsi.Provenance, error) {
+	key, ok := v.registry[sensorID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSensor, sensorID)
+	}
+	if nonce == "" {
+		return nil, fmt.Errorf("%w: the nonce is empty", ErrInvalidSignature)
+	}
+
+	now := time.Now()
+	signedAt := time.Unix(timestamp, 0)
+	if signedAt.Before(now.Add(-v.window)) || signedAt.After(now.Add(v.window)) {
+		return nil, ErrExpired
+	}
+
+	sig, err := decodeHex(signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	err = key.Verify(SigningMessage(timestamp, nonce, body), sig)
+	if err != nil {
+		return nil, err
+	}
+
+	// The nonce is only recorded once the signature is valid, so nobody
+	// else can burn the nonces of a sensor
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for n, expires := range v.nonces {
+		if now.After(expires) {
+			delete(v.nonces, n)
+		}
+	}
+	nonceKey := sensorID + "/" + nonce
+	if _, ok := v.nonces[nonceKey]; ok {
+		return nil, ErrReplayed
+	}
+	// Once the timestamp is out of the window, the nonce is rejected anyway
+	v.nonces[nonceKey] = signedAt.Add(v.window)
+
+	return &ngsi.Provenance{
+		SensorID:  sensorID,
+		Algorithm: key.Algorithm,
+		Timestamp: timestamp,
+		Nonce:     nonce,
+		BodyHash:  hex.EncodeToString(crypto.Keccak256(body)),
+		Signature: hex.EncodeToString(sig),
+		Body:      body,
+	}, nil
+}
+
+// Authorize checks that the entity entityID is bound to the sensor that
+// signed it
+func (v *Verifier) Authorize(sensorID, entityID string) error {
+	key, ok := v.registry[sensorID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSensor, sensorID)
+	}
+	if !key.Reports(sensorID, entityID) {
+		return fmt.Errorf("%w: %s is not reported by %s", ErrUnboundEntity, entityID, sensorID)
+	}
+	return nil
+}
+
+// decodeHex decodes a hex string with an optional 0x prefix
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
@@ -0,0 +1,171 @@
+package sensors
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var body = []byte(`{"id":"urn:ngsi-ld:TrafficFlowObserved:1001","intensity":281}`)
+
+// testRegistry creates a sensor of each algorithm. It returns the registry
+// and the functions that sign with the keys of the sensors.
+func testRegistry(t *testing.T) (Registry, map[string]func([]byte) []byte) {
+	ecKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := Registry{
+		"secp256k1-sensor":  {Algorithm: AlgorithmSecp256k1, PublicKey: hex.EncodeToString(crypto.FromECDSAPub(&ecKey.PublicKey))},
+		"compressed-sensor": {Algorithm: AlgorithmSecp256k1, PublicKey: hex.EncodeToString(crypto.CompressPubkey(&ecKey.PublicKey))},
+		"ed25519-sensor":    {Algorithm: AlgorithmEd25519, PublicKey: hex.EncodeToString(edPub)},
+	}
+
+	signSecp256k1 := func(msg []byte) []byte {
+		sig, err := crypto.Sign(crypto.Keccak256(msg), ecKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	signers := map[string]func([]byte) []byte{
+		"secp256k1-sensor":  signSecp256k1,
+		"compressed-sensor": signSecp256k1,
+		"ed25519-sensor":    func(msg []byte) []byte { return ed25519.Sign(edKey, msg) },
+	}
+	return registry, signers
+}
+
+func TestVerify(t *testing.T) {
+	registry, signers := testRegistry(t)
+	verifier := NewVerifier(registry, time.Minute)
+	now := time.Now().Unix()
+
+	for id, sign := range signers {
+		sig := hex.EncodeToString(sign(SigningMessage(now, "n1", body)))
+
+		provenance, err := verifier.Verify(id, now, "n1", sig, body)
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		if provenance.SensorID != id || string(provenance.Body) != string(body) || provenance.BodyHash != hex.EncodeToString(crypto.Keccak256(body)) {
+			t.Errorf("%s: unexpected provenance %+v", id, provenance)
+		}
+
+		// The signature can be verified again from the provenance alone
+		provSig, _ := hex.DecodeString(provenance.Signature)
+		msg := SigningMessage(provenance.Timestamp, provenance.Nonce, provenance.Body)
+		if err := registry[id].Verify(msg, provSig); err != nil {
+			t.Errorf("%s: provenance does not verify: %v", id, err)
+		}
+
+		if _, err := verifier.Verify(id, now, "n1", sig, body); !errors.Is(err, ErrReplayed) {
+			t.Errorf("%s: expected ErrReplayed, got %v", id, err)
+		}
+
+		tampered := append([]byte{}, body...)
+		tampered[len(tampered)-2] = '2'
+		if _, err := verifier.Verify(id, now, "n2", sig, tampered); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", id, err)
+		}
+	}
+}
+
+func TestVerifyWindow(t *testing.T) {
+	registry, signers := testRegistry(t)
+	verifier := NewVerifier(registry, time.Minute)
+	sign := signers["ed25519-sensor"]
+
+	for _, ts := range []int64{time.Now().Add(-2 * time.Minute).Unix(), time.Now().Add(2 * time.Minute).Unix()} {
+		sig := hex.EncodeToString(sign(SigningMessage(ts, "n", body)))
+		if _, err := verifier.Verify("ed25519-sensor", ts, "n", sig, body); !errors.Is(err, ErrExpired) {
+			t.Errorf("expected ErrExpired for timestamp %d, got %v", ts, err)
+		}
+	}
+}
+
+func TestUnknownSensor(t *testing.T) {
+	verifier := NewVerifier(Registry{}, time.Minute)
+	if _, err := verifier.Verify("unknown", time.Now().Unix(), "n", "00", body); !errors.Is(err, ErrUnknownSensor) {
+		t.Errorf("expected ErrUnknownSensor, got %v", err)
+	}
+}
+
+func TestLoadRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sensors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sensors.json")
+	ioutil.WriteFile(path, []byte(`{"s1": {"algorithm": "ed25519", "publicKey": "`+hex.EncodeToString(make([]byte, 32))+`"}}`), 0600)
+	registry, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry["s1"].Algorithm != AlgorithmEd25519 {
+		t.Errorf("unexpected registry %+v", registry)
+	}
+
+	ioutil.WriteFile(path, []byte(`{"s1": {"algorithm": "rsa", "publicKey": "00"}}`), 0600)
+	if _, err := LoadRegistry(path); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	registry := Registry{
+		"urn:sensor:1": {Algorithm: AlgorithmEd25519},
+		"gateway":      {Algorithm: AlgorithmEd25519, Entities: []string{"urn:ngsi-ld:Room:1", "urn:ngsi-ld:Street:*"}},
+	}
+	verifier := NewVerifier(registry, time.Minute)
+
+	allowed := map[[2]string]bool{
+		{"urn:sensor:1", "urn:sensor:1"}:              true,
+		{"urn:sensor:1", "urn:ngsi-ld:Room:1"}:        false,
+		{"gateway", "urn:ngsi-ld:Room:1"}:             true,
+		{"gateway", "urn:ngsi-ld:Room:2"}:             false,
+		{"gateway", "urn:ngsi-ld:Street:santander:7"}: true,
+		{"gateway", "gateway"}:                        false,
+	}
+	for pair, ok := range allowed {
+		err := verifier.Authorize(pair[0], pair[1])
+		if ok && err != nil {
+			t.Errorf("%s should report %s: %v", pair[0], pair[1], err)
+		}
+		if !ok && !errors.Is(err, ErrUnboundEntity) {
+			t.Errorf("%s should not report %s, got %v", pair[0], pair[1], err)
+		}
+	}
+
+	if err := verifier.Authorize("unknown", "urn:sensor:1"); !errors.Is(err, ErrUnknownSensor) {
+		t.Errorf("expected ErrUnknownSensor, got %v", err)
+	}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	envelope, ok := ParseEnvelope([]byte(`{"sensorId":"s1","timestamp":1,"nonce":"n","signature":"00","body":{"id": "s1"}}`))
+	if !ok || envelope.SensorID != "s1" || string(envelope.Body) != `{"id": "s1"}` {
+		t.Fatalf("unexpected envelope %+v", envelope)
+	}
+
+	for _, payload := range []string{`{"id":"s1","type":"Room"}`, `[1]`, `{"sensorId":"s1","body":{}}`} {
+		if _, ok := ParseEnvelope([]byte(payload)); ok {
+			t.Errorf("%s was parsed as an envelope", payload)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// identityText is signed by Clef when it is opened to learn the public key
+// of the account
+const identityText = "IoT proxy signer check"
+
+// clefSigner signs with a Clef external signer through its account API.
+// Clef does not sign raw hashes: SignHash signs the EIP-191 personal message
+// of the hash, so its scheme is SchemeEIP191. The transactions are signed
+// with the chain ID of the transactor, or the one configured in Clef if it
+// has none.
+type clefSigner struct {
+	client    *rpc.Client
+	account   common.Address
+	publicKey *ecdsa.PublicKey
+}
+
+// OpenClef connects to the Clef external signer at endpoint, which must
+// manage account
+func OpenClef(endpoint string, account common.Address) (Signer, error) {
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	s := &clefSigner{client: client, account: account}
+	if err := s.check(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// check checks that Clef manages the account and recovers its public key
+// from a signature, since Clef does not export it
+func (s *clefSigner) check() error {
+	var version string
+	if err := s.client.Call(&version, "account_version"); err != nil {
+		return err
+	}
+
+	var managed []common.Address
+	if err := s.client.Call(&managed, "account_list"); err != nil {
+		return err
+	}
+	found := false
+	for _, address := range managed {
+		found = found || address == s.account
+	}
+	if !found {
+		return fmt.Errorf("The account %s is not managed by the external signer", s.account.Hex())
+	}
+
+	signature, err := s.signText([]byte(identityText))
+	if err != nil {
+		return err
+	}
+	s.publicKey, err = crypto.SigToPub(accounts.TextHash([]byte(identityText)), signature)
+	return err
+}
+
+// signText signs the EIP-191 personal message of text. V is converted to the
+// recovery id 0 or 1.
+func (s *clefSigner) signText(text []byte) ([]byte, error) {
+	var signature hexutil.Bytes
+	address := common.NewMixedcaseAddress(s.account)
+	if err := s.client.Call(&signature, "account_signData", accounts.MimetypeTextPlain, &address, hexutil.Encode(text)); err != nil {
+		return nil, err
+	}
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("The external signer returned a signature of %d bytes", len(signature))
+	}
+	if signature[64] >= 27 {
+		signature[64] -= 27
+	}
+	return signature, nil
+}
+
+func (s *clefSigner) Address() common.Address {
+	return s.account
+}
+
+func (s *clefSigner) PublicKey() *ecdsa.PublicKey {
+	return s.publicKey
+}
+
+func (s *clefSigner) SignHash(hash []byte) ([]byte, error) {
+	return s.signText(hash)
+}
+
+func (s *clefSigner) Scheme() string {
+	return SchemeEIP191
+}
+
+// signTransactionResult is the result of account_signTransaction
+type signTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+func (s *clefSigner) SignTx(signer types.Signer, tx *types.Transaction) (*types.Transaction, error) {
+	data := hexutil.Bytes(tx.Data())
+	args := &apitypes.SendTxArgs{
+		Data:  &data,
+		Nonce: hexutil.Uint64(tx.Nonce()),
+		Value: hexutil.Big(*tx.Value()),
+		Gas:   hexutil.Uint64(tx.Gas()),
+		From:  common.NewMixedcaseAddress(s.account),
+	}
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To())
+		args.To = &to
+	}
+	switch tx.Type() {
+	case types.LegacyTxType:
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	case types.DynamicFeeTxType:
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	default:
+		return nil, fmt.Errorf("Unsupported transaction type %d", tx.Type())
+	}
+	if chainID := signer.ChainID(); chainID != nil && chainID.Sign() != 0 {
+		args.ChainID = (*hexutil.Big)(chainID)
+	}
+
+	var result signTransactionResult
+	if err := s.client.Call(&result, "account_signTransaction", args); err != nil {
+		return nil, err
+	}
+	return result.Tx, nil
+}
+
+func (s *clefSigner) Close() error {
+	s.client.Close()
+	return nil
+}
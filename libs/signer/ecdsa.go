@@ -0,0 +1,61 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	secp256k1N     = crypto.S256().Params().N
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+)
+
+// parseECPoint decodes the public key of a token. The point is DER encoded
+// in an OCTET STRING by most tokens, but some return it raw.
+func parseECPoint(point []byte) (*ecdsa.PublicKey, error) {
+	raw := point
+	if len(point) != 65 {
+		rest, err := asn1.Unmarshal(point, &raw)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) != 0 {
+			return nil, errors.New("The public key of the token has trailing data")
+		}
+	}
+	return crypto.UnmarshalPubkey(raw)
+}
+
+// recoverableSignature converts the signature r || s of hash made by a token
+// to the [R || S || V] format of Ethereum. s is made low, as required by the
+// transactions, and V is the recovery id that yields publicKey.
+func recoverableSignature(hash, rs []byte, publicKey *ecdsa.PublicKey) ([]byte, error) {
+	if len(rs) != 64 {
+		return nil, errors.New("The signature of the token is not 64 bytes long")
+	}
+
+	s := new(big.Int).SetBytes(rs[32:])
+	if s.Cmp(secp256k1HalfN) > 0 {
+		s.Sub(secp256k1N, s)
+	}
+
+	signature := make([]byte, 65)
+	copy(signature, rs[:32])
+	copy(signature[32:64], math.PaddedBigBytes(s, 32))
+
+	expected := crypto.FromECDSAPub(publicKey)
+	for v := byte(0); v < 2; v++ {
+		signature[64] = v
+		recovered, err := crypto.Ecrecover(hash, signature)
+		if err == nil && bytes.Equal(recovered, expected) {
+			return signature, nil
+		}
+	}
+	return nil, errors.New("The signature of the token does not match its public key")
+}
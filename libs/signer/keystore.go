@@ -0,0 +1,96 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	secrets "administrator/ipfs-node/libs/secrets"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// keystoreSigner signs with a key decrypted from the keystore of the node
+type keystoreSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+// OpenKeystore decrypts the key of account, stored in a file of the folder
+// keystoreDir
+func OpenKeystore(account common.Address, password secrets.Secret, keystoreDir string) (Signer, error) {
+	// Get the file that contains the private key
+	file, err := keyFile(account, keystoreDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the file
+	jsonBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the private key
+	keyWrapper, err := keystore.DecryptKey(jsonBytes, password.Reveal())
+	if err != nil {
+		return nil, err
+	}
+
+	return &keystoreSigner{key: keyWrapper.PrivateKey}, nil
+}
+
+// keyFile returns the file of the keystore that contains the key of account
+func keyFile(account common.Address, keystoreDir string) (string, error) {
+	// The name of the file contains the address
+	libRegEx, err := regexp.Compile("(?i).*" + hex.EncodeToString(account[:]))
+	if err != nil {
+		return "", err
+	}
+
+	// Get all the files of the folder
+	files, err := ioutil.ReadDir(keystoreDir)
+	if err != nil {
+		return "", err
+	}
+
+	// Get the name of the file that matches the expression
+	for _, f := range files {
+		if libRegEx.MatchString(f.Name()) {
+			return filepath.Join(keystoreDir, f.Name()), nil
+		}
+	}
+
+	return "", errors.New("UTC File not found")
+}
+
+func (s *keystoreSigner) Address() common.Address {
+	return crypto.PubkeyToAddress(s.key.PublicKey)
+}
+
+func (s *keystoreSigner) PublicKey() *ecdsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s *keystoreSigner) SignHash(hash []byte) ([]byte, error) {
+	return crypto.Sign(hash, s.key)
+}
+
+func (s *keystoreSigner) Scheme() string {
+	return SchemeHash
+}
+
+func (s *keystoreSigner) SignTx(signer types.Signer, tx *types.Transaction) (*types.Transaction, error) {
+	return types.SignTx(tx, signer, s.key)
+}
+
+func (s *keystoreSigner) Close() error {
+	// The key is zeroed, so it does not stay in memory
+	s.key.D.SetInt64(0)
+	return nil
+}
@@ -0,0 +1,190 @@
+//go:build pkcs11
+// +build pkcs11
+
+package signer
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	secrets "administrator/ipfs-node/libs/secrets"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS11Supported tells whether the proxy was built with the pkcs11 tag
+const PKCS11Supported = true
+
+// pkcs11Signer signs with a secp256k1 key that does not leave a PKCS#11
+// token
+type pkcs11Signer struct {
+	ctx       *pkcs11.Ctx
+	publicKey *ecdsa.PublicKey
+
+	// A session runs one operation at a time
+	mu         sync.Mutex
+	session    pkcs11.SessionHandle
+	privateKey pkcs11.ObjectHandle
+}
+
+// OpenPKCS11 logs in the token of the configuration with pin and looks up
+// its key pair
+func OpenPKCS11(config PKCS11Config, pin secrets.Secret) (Signer, error) {
+	ctx := pkcs11.New(config.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("Could not load the PKCS#11 module %s", config.Module)
+	}
+	err := ctx.Initialize()
+	if err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+
+	s := &pkcs11Signer{ctx: ctx}
+	err = s.open(config, pin)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens a session in the token and reads the key pair
+func (s *pkcs11Signer) open(config PKCS11Config, pin secrets.Secret) error {
+	slot, err := s.findSlot(config.TokenLabel)
+	if err != nil {
+		return err
+	}
+
+	s.session, err = s.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return err
+	}
+	err = s.ctx.Login(s.session, pkcs11.CKU_USER, pin.Reveal())
+	if err != nil {
+		return err
+	}
+
+	s.privateKey, err = s.findObject(pkcs11.CKO_PRIVATE_KEY, config.KeyLabel)
+	if err != nil {
+		return err
+	}
+	publicKey, err := s.findObject(pkcs11.CKO_PUBLIC_KEY, config.KeyLabel)
+	if err != nil {
+		return err
+	}
+
+	attributes, err := s.ctx.GetAttributeValue(s.session, publicKey, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return err
+	}
+	s.publicKey, err = parseECPoint(attributes[0].Value)
+	if err != nil {
+		return fmt.Errorf("The key %s is not a secp256k1 key: %w", config.KeyLabel, err)
+	}
+	return nil
+}
+
+// findSlot returns the slot of the token labelled label, or the first slot
+// with a token if label is empty
+func (s *pkcs11Signer) findSlot(label string) (uint, error) {
+	slots, err := s.ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, slot := range slots {
+		if label == "" {
+			return slot, nil
+		}
+		info, err := s.ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, err
+		}
+		if strings.TrimRight(info.Label, " \x00") == label {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("The PKCS#11 token %q was not found", label)
+}
+
+// findObject returns the object of class labelled label
+func (s *pkcs11Signer) findObject(class uint, label string) (pkcs11.ObjectHandle, error) {
+	err := s.ctx.FindObjectsInit(s.session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	})
+	if err != nil {
+		return 0, err
+	}
+	objects, _, err := s.ctx.FindObjects(s.session, 1)
+	s.ctx.FindObjectsFinal(s.session)
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) == 0 {
+		return 0, fmt.Errorf("The key %q was not found in the PKCS#11 token", label)
+	}
+	return objects[0], nil
+}
+
+func (s *pkcs11Signer) Address() common.Address {
+	return crypto.PubkeyToAddress(*s.publicKey)
+}
+
+func (s *pkcs11Signer) PublicKey() *ecdsa.PublicKey {
+	return s.publicKey
+}
+
+func (s *pkcs11Signer) SignHash(hash []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errors.New("The hash to sign must be 32 bytes long")
+	}
+
+	s.mu.Lock()
+	err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, s.privateKey)
+	var rs []byte
+	if err == nil {
+		rs, err = s.ctx.Sign(s.session, hash)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return recoverableSignature(hash, rs, s.publicKey)
+}
+
+func (s *pkcs11Signer) Scheme() string {
+	return SchemeHash
+}
+
+func (s *pkcs11Signer) SignTx(signer types.Signer, tx *types.Transaction) (*types.Transaction, error) {
+	hash := signer.Hash(tx)
+	signature, err := s.SignHash(hash[:])
+	if err != nil {
+		return nil, err
+	}
+	return tx.WithSignature(signer, signature)
+}
+
+func (s *pkcs11Signer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.session != 0 {
+		s.ctx.Logout(s.session)
+		s.ctx.CloseSession(s.session)
+		s.session = 0
+	}
+	s.ctx.Finalize()
+	s.ctx.Destroy()
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !pkcs11
+// +build !pkcs11
+
+package signer
+
+import (
+	"errors"
+
+	secrets "administrator/ipfs-node/libs/secrets"
+)
+
+// PKCS11Supported tells whether the proxy was built with the pkcs11 tag
+const PKCS11Supported = false
+
+// ErrNoPKCS11 is returned when a PKCS#11 token is configured but the proxy
+// was built without the pkcs11 tag
+var ErrNoPKCS11 = errors.New("The proxy was built without PKCS#11 support, build it with -tags pkcs11")
+
+// OpenPKCS11 fails, PKCS#11 tokens need the pkcs11 build tag
+func OpenPKCS11(config PKCS11Config, pin secrets.Secret) (Signer, error) {
+	return nil, ErrNoPKCS11
+}
@@ -0,0 +1,52 @@
+//go:build pkcs11
+// +build pkcs11
+
+package signer
+
+import (
+	"os"
+	"testing"
+
+	secrets "administrator/ipfs-node/libs/secrets"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TestPKCS11 needs a token with a secp256k1 key pair, for instance in
+// SoftHSM:
+//
+//	softhsm2-util --init-token --free --label proxy --pin 1234 --so-pin 1234
+//	pkcs11-tool --module $SOFTHSM2_MODULE --login --pin 1234 --token-label proxy \
+//		--keypairgen --key-type EC:secp256k1 --label producer
+//	SOFTHSM2_MODULE=/usr/lib/softhsm/libsofthsm2.so go test -tags pkcs11 ./libs/signer
+func TestPKCS11(t *testing.T) {
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if module == "" {
+		t.Skip("SOFTHSM2_MODULE is not set")
+	}
+
+	config := PKCS11Config{Module: module, TokenLabel: "proxy", KeyLabel: "producer"}
+	s, err := OpenPKCS11(config, secrets.Secret("1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 4; i++ {
+		hash := crypto.Keccak256([]byte{byte(i)})
+		signature, err := s.SignHash(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKey, err := crypto.SigToPub(hash, signature)
+		if err != nil || crypto.PubkeyToAddress(*publicKey) != s.Address() {
+			t.Errorf("the signature does not match the key of the token: %v", err)
+		}
+	}
+
+	checkTransactor(t, s)
+
+	if _, err := OpenPKCS11(config, secrets.Secret("0000")); err == nil {
+		t.Error("the token was opened with a wrong PIN")
+	}
+}
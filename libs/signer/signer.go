@@ -0,0 +1,154 @@
+// Package signer signs the transactions and the measurements of the producer
+// account. The key is kept by the signer that is selected in the
+// configuration: the keystore of the node, a Clef external signer or a
+// PKCS#11 token. With the last two, the key never enters the proxy.
+package signer
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	secrets "administrator/ipfs-node/libs/secrets"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Types of signers
+const (
+	TypeKeystore = "keystore"
+	TypeClef     = "clef"
+	TypePKCS11   = "pkcs11"
+)
+
+// Schemes of the signatures made by SignHash
+const (
+	// SchemeHash signs the hash itself
+	SchemeHash = "hash"
+	// SchemeEIP191 signs the EIP-191 personal message of the hash, that is
+	// accounts.TextHash(hash), for the signers that do not sign raw hashes
+	SchemeEIP191 = "eip191"
+)
+
+// ErrWrongAccount is returned when the key of the signer is not the key of
+// the producer account
+var ErrWrongAccount = errors.New("The signer does not hold the key of the producer account")
+
+// Config selects the signer of the producer account. The keystore of the
+// node is used if Type is not set.
+type Config struct {
+	Type   string       `json:"type"`
+	Clef   ClefConfig   `json:"clef"`
+	PKCS11 PKCS11Config `json:"pkcs11"`
+}
+
+// ClefConfig is the configuration of a Clef external signer. Endpoint is
+// the path of its IPC socket or its HTTP URL.
+type ClefConfig struct {
+	Endpoint string `json:"endpoint"`
+}
+
+// PKCS11Config is the configuration of a PKCS#11 token. Module is the path
+// of the PKCS#11 library of the token. The secp256k1 key pair labelled
+// KeyLabel is looked up in the token labelled TokenLabel, or in the first
+// token if it is empty.
+type PKCS11Config struct {
+	Module     string         `json:"module"`
+	TokenLabel string         `json:"tokenLabel"`
+	KeyLabel   string         `json:"keyLabel"`
+	Pin        secrets.Source `json:"pin"`
+}
+
+// Signer holds the key of an account
+type Signer interface {
+	// Address returns the address of the account
+	Address() common.Address
+	// PublicKey returns the public key of the account
+	PublicKey() *ecdsa.PublicKey
+	// SignHash signs a 32 bytes long hash with the scheme returned by
+	// Scheme. The signature is 65 bytes long, in the [R || S || V] format, V
+	// being the recovery id 0 or 1.
+	SignHash(hash []byte) ([]byte, error)
+	// Scheme returns the scheme of the signatures made by SignHash
+	Scheme() string
+	// SignTx signs a transaction of the account
+	SignTx(signer types.Signer, tx *types.Transaction) (*types.Transaction, error)
+	// Close releases the key
+	Close() error
+}
+
+// Open opens the signer selected by the configuration and checks that it
+// holds the key of account. The keystore is the folder keystoreDir,
+// unlocked with the password read from keystorePassword.
+func Open(config Config, account common.Address, keystoreDir string, keystorePassword secrets.Source) (Signer, error) {
+	var s Signer
+	switch config.Type {
+	case TypeKeystore, "":
+		password, err := keystorePassword.Resolve("password of the keystore")
+		if err != nil {
+			return nil, err
+		}
+		s, err = OpenKeystore(account, password, keystoreDir)
+		if err != nil {
+			return nil, err
+		}
+	case TypeClef:
+		var err error
+		s, err = OpenClef(config.Clef.Endpoint, account)
+		if err != nil {
+			return nil, err
+		}
+	case TypePKCS11:
+		pin, err := config.PKCS11.Pin.Resolve("PIN of the PKCS#11 token")
+		if err != nil {
+			return nil, err
+		}
+		s, err = OpenPKCS11(config.PKCS11, pin)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown signer %q", config.Type)
+	}
+
+	if s.Address() != account {
+		s.Close()
+		return nil, fmt.Errorf("%w: %s", ErrWrongAccount, s.Address().Hex())
+	}
+	return s, nil
+}
+
+// NewTransactor creates the options of the transactions signed by s for
+// the chain chainID. The legacy transactions are not replay protected if
+// chainID is nil.
+func NewTransactor(s Signer, chainID *big.Int) *bind.TransactOpts {
+	from := s.Address()
+	signer := types.LatestSignerForChainID(chainID)
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != from {
+				return nil, errors.New("not authorized to sign this account")
+			}
+			return s.SignTx(signer, tx)
+		},
+	}
+}
+
+// SignedDigest returns the digest that is signed when hash is signed with
+// scheme. The signatures of SignHash are verified, or their public key
+// recovered, against it.
+func SignedDigest(scheme string, hash []byte) ([]byte, error) {
+	switch scheme {
+	case SchemeHash:
+		return hash, nil
+	case SchemeEIP191:
+		return accounts.TextHash(hash), nil
+	default:
+		return nil, fmt.Errorf("Unknown signature scheme %q", scheme)
+	}
+}
@@ -0,0 +1,251 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	secrets "administrator/ipfs-node/libs/secrets"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// checkSignHash signs a hash with s and recovers the public key of s from
+// the digest of its scheme
+func checkSignHash(t *testing.T, s Signer) {
+	t.Helper()
+	hash := crypto.Keccak256([]byte("measurement"))
+	signature, err := s.SignHash(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signature) != 65 || signature[64] > 1 {
+		t.Fatalf("the signature is not in the [R || S || V] format: %x", signature)
+	}
+	digest, err := SignedDigest(s.Scheme(), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := crypto.SigToPub(digest, signature)
+	if err != nil || !bytes.Equal(crypto.FromECDSAPub(publicKey), crypto.FromECDSAPub(s.PublicKey())) {
+		t.Errorf("the signature does not match the public key: %v", err)
+	}
+}
+
+// checkTransactor signs a transaction with the transactor of s and checks
+// its sender
+func checkTransactor(t *testing.T, s Signer) {
+	t.Helper()
+	auth := NewTransactor(s, big.NewInt(1337))
+	tx := types.NewTransaction(3, common.HexToAddress("0xc0"), big.NewInt(0), 21000, big.NewInt(1), []byte{1, 2})
+	signed, err := auth.Signer(auth.From, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, err := types.Sender(types.LatestSignerForChainID(big.NewInt(1337)), signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != s.Address() {
+		t.Errorf("the transaction was signed by %s, want %s", from.Hex(), s.Address().Hex())
+	}
+
+	if _, err := auth.Signer(common.HexToAddress("0x1"), tx); err == nil {
+		t.Error("a transaction of another account was signed")
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	dir := t.TempDir()
+	account, err := keystore.StoreKey(dir, "secret", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Open(Config{}, account.Address, dir, secrets.Source{Env: "SIGNER_TEST_PASSWORD"})
+	if err == nil {
+		t.Fatal("the keystore was opened without password")
+	}
+
+	t.Setenv("SIGNER_TEST_PASSWORD", "secret")
+	s, err := Open(Config{}, account.Address, dir, secrets.Source{Env: "SIGNER_TEST_PASSWORD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.Scheme() != SchemeHash {
+		t.Errorf("unexpected scheme %q", s.Scheme())
+	}
+	checkSignHash(t, s)
+	checkTransactor(t, s)
+
+	_, err = Open(Config{}, common.HexToAddress("0x1"), dir, secrets.Source{Env: "SIGNER_TEST_PASSWORD"})
+	if err == nil {
+		t.Error("the key of an unknown account was found")
+	}
+}
+
+// clef is an external signer that holds one key
+type clef struct {
+	key *ecdsa.PrivateKey
+}
+
+func (c *clef) Version() (string, error) {
+	return "6.1.0", nil
+}
+
+func (c *clef) List() ([]common.Address, error) {
+	return []common.Address{crypto.PubkeyToAddress(c.key.PublicKey)}, nil
+}
+
+func (c *clef) SignData(contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if contentType != accounts.MimetypeTextPlain {
+		return nil, errors.New("unsupported content type")
+	}
+	signature, err := crypto.Sign(accounts.TextHash(data), c.key)
+	if err != nil {
+		return nil, err
+	}
+	signature[64] += 27
+	return signature, nil
+}
+
+func (c *clef) SignTransaction(args apitypes.SendTxArgs) (*signTransactionResult, error) {
+	tx := types.NewTransaction(uint64(args.Nonce), args.To.Address(), args.Value.ToInt(), uint64(args.Gas), args.GasPrice.ToInt(), *args.Data)
+	signed, err := types.SignTx(tx, types.NewEIP155Signer(big.NewInt(1337)), c.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return &signTransactionResult{Raw: raw, Tx: signed}, nil
+}
+
+func TestClef(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &clef{key: key}); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := httptest.NewServer(server)
+	defer endpoint.Close()
+
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	s, err := Open(Config{Type: TypeClef, Clef: ClefConfig{Endpoint: endpoint.URL}}, address, "", secrets.Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if !bytes.Equal(crypto.FromECDSAPub(s.PublicKey()), crypto.FromECDSAPub(&key.PublicKey)) {
+		t.Error("the public key was not recovered")
+	}
+
+	// Clef signs the hash as a personal message
+	if s.Scheme() != SchemeEIP191 {
+		t.Errorf("unexpected scheme %q", s.Scheme())
+	}
+	checkSignHash(t, s)
+	checkTransactor(t, s)
+
+	_, err = OpenClef(endpoint.URL, common.HexToAddress("0x1"))
+	if err == nil {
+		t.Error("an account that is not managed by Clef was opened")
+	}
+}
+
+func TestRecoverableSignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		hash := crypto.Keccak256([]byte{byte(i)})
+		signature, err := crypto.Sign(hash, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Tokens may return the high s
+		rs := append([]byte(nil), signature[:64]...)
+		if i%2 == 1 {
+			s := new(big.Int).Sub(secp256k1N, new(big.Int).SetBytes(rs[32:]))
+			copy(rs[32:], common.LeftPadBytes(s.Bytes(), 32))
+		}
+
+		converted, err := recoverableSignature(hash, rs, &key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(converted, signature) {
+			t.Errorf("got %x, want %x", converted, signature)
+		}
+	}
+
+	other, _ := crypto.GenerateKey()
+	signature, _ := crypto.Sign(make([]byte, 32), other)
+	if _, err := recoverableSignature(make([]byte, 32), signature[:64], &key.PublicKey); err == nil {
+		t.Error("the signature of another key was accepted")
+	}
+}
+
+func TestParseECPoint(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := crypto.FromECDSAPub(&key.PublicKey)
+
+	// DER encoded OCTET STRING
+	der := append([]byte{0x04, byte(len(raw))}, raw...)
+	for _, point := range [][]byte{raw, der} {
+		publicKey, err := parseECPoint(point)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(crypto.FromECDSAPub(publicKey), raw) {
+			t.Error("unexpected public key")
+		}
+	}
+
+	if _, err := parseECPoint(der[:40]); err == nil {
+		t.Error("a truncated point was accepted")
+	}
+}
+
+func TestUnknownSigner(t *testing.T) {
+	if _, err := Open(Config{Type: "ledger"}, common.Address{}, "", secrets.Source{}); err == nil {
+		t.Error("an unknown signer was opened")
+	}
+}
+
+func TestSignedDigest(t *testing.T) {
+	hash := crypto.Keccak256([]byte("measurement"))
+	if digest, err := SignedDigest(SchemeHash, hash); err != nil || !bytes.Equal(digest, hash) {
+		t.Errorf("unexpected digest of the hash scheme %x: %v", digest, err)
+	}
+	if digest, err := SignedDigest(SchemeEIP191, hash); err != nil || !bytes.Equal(digest, accounts.TextHash(hash)) {
+		t.Errorf("unexpected digest of the eip191 scheme %x: %v", digest, err)
+	}
+	if _, err := SignedDigest("raw", hash); err == nil {
+		t.Error("an unknown scheme was accepted")
+	}
+}
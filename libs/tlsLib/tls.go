@@ -0,0 +1,203 @@
+// Package tlsLib builds the TLS configuration of the HTTPS listener. The
+// certificates are reloaded when their files change, and the certificates
+// presented by the clients are mapped to the identity of the gateways.
+package tlsLib
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Config is the TLS configuration of the HTTPS listener. If ClientCAFile is
+// set, clients must present a certificate signed by one of its CAs. Gateways
+// maps the common name or a subject alternative name of those certificates
+// to the identity of the gateway. The plain HTTP listener is not started
+// when TLS is configured, since it would bypass the client certificates,
+// unless AllowPlainHTTP is set.
+type Config struct {
+	CertFile       string            `json:"certFile"`
+	KeyFile        string            `json:"keyFile"`
+	ClientCAFile   string            `json:"clientCAFile"`
+	Gateways       map[string]string `json:"gateways"`
+	AllowPlainHTTP bool              `json:"allowPlainHTTP"`
+}
+
+// Reloader serves the current certificates of the HTTPS listener
+type Reloader struct {
+	config  Config
+	watcher *fsnotify.Watcher
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewReloader loads the certificates and watches their files for changes
+func NewReloader(config Config) (*Reloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("The certificate and the key of the HTTPS listener are required")
+	}
+
+	r := &Reloader{config: config}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	r.watcher = watcher
+
+	// Watch the folders instead of the files. Certificates are usually
+	// rotated by replacing the files, which removes the watches of files.
+	dirs := make(map[string]bool)
+	for _, file := range r.files() {
+		dirs[filepath.Dir(file)] = true
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	go r.watch()
+	return r, nil
+}
+
+// TLSConfig returns the TLS configuration of the listener. Every handshake
+// uses the certificates that were loaded last. The configuration of each
+// handshake is a copy of the returned one, so the protocols added to it by
+// the server, such as HTTP/2, are still negotiated.
+func (r *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.Certificates = []tls.Certificate{*r.cert}
+		if r.clientCAs != nil {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+			config.ClientCAs = r.clientCAs
+		}
+		return config, nil
+	}
+	return base
+}
+
+// ClientAuth reports whether clients must present a certificate
+func (r *Reloader) ClientAuth() bool {
+	return r.config.ClientCAFile != ""
+}
+
+// Identity returns the identity of the gateway that presented the verified
+// client certificate of the connection
+func (r *Reloader) Identity(state *tls.ConnectionState) (string, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	cert := state.VerifiedChains[0][0]
+
+	names := []string{cert.Subject.CommonName}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	for _, name := range names {
+		if id, ok := r.config.Gateways[name]; ok && name != "" {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// Close stops watching the certificate files
+func (r *Reloader) Close() error {
+	return r.watcher.Close()
+}
+
+// files returns the files loaded by the reloader
+func (r *Reloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCAFile != "" {
+		files = append(files, r.config.ClientCAFile)
+	}
+	return files
+}
+
+// watch reloads the certificates when one of their files changes
+func (r *Reloader) watch() {
+	watched := make(map[string]bool)
+	for _, file := range r.files() {
+		watched[filepath.Clean(file)] = true
+	}
+
+	for {
+		select {
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if !watched[filepath.Clean(event.Name)] || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+
+			// Keep serving the previous certificates if the new ones
+			// cannot be loaded (e.g. only one of the files was replaced)
+			if err := r.reload(); err != nil {
+				log.Printf("Could not reload the TLS certificates: %v\n", err)
+				continue
+			}
+			log.Println("TLS certificates reloaded")
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Error watching the TLS certificates: %v\n", err)
+		}
+	}
+}
+
+// reload loads the certificates from disk
+func (r *Reloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		pemBytes, err := ioutil.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pemBytes) {
+			return fmt.Errorf("No certificates found in %s", r.config.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package tlsLib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate and its key
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newCert creates a certificate signed by parent, or a self-signed CA if
+// parent is nil
+func newCert(t *testing.T, cn string, dnsNames []string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if cn == "127.0.0.1" {
+		template.IPAddresses = []net.IP{net.ParseIP(cn)}
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// keyPEM encodes the key of the certificate
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// tlsCert converts the certificate to a tls.Certificate
+func (c *testCert) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+// writeFile replaces a file the way certificates are usually rotated
+func writeFile(t *testing.T, path string, data []byte) {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setup starts an HTTPS server that returns the identity of the gateway
+func setup(t *testing.T) (*testCert, Config, *httptest.Server, *Reloader) {
+	dir, err := ioutil.TempDir("", "tlsLib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	ca := newCert(t, "Gateways CA", nil, nil)
+	server := newCert(t, "127.0.0.1", nil, ca)
+
+	config := Config{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		Gateways:     map[string]string{"gw1.example.com": "gateway-1"},
+	}
+	writeFile(t, config.CertFile, server.pem)
+	writeFile(t, config.KeyFile, server.keyPEM(t))
+	writeFile(t, config.ClientCAFile, ca.pem)
+
+	reloader, err := NewReloader(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reloader.Close() })
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := reloader.Identity(r.TLS)
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(id))
+	}))
+	srv.TLS = reloader.TLSConfig()
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return ca, config, srv, reloader
+}
+
+// get sends a request to the server with a client certificate
+func get(srv *httptest.Server, roots *x509.CertPool, client *tls.Certificate) (*http.Response, error) {
+	tlsConfig := &tls.Config{RootCAs: roots}
+	if client != nil {
+		tlsConfig.Certificates = []tls.Certificate{*client}
+	}
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	resp, err := httpClient.Get(srv.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return resp, nil
+}
+
+func TestGatewayIdentity(t *testing.T) {
+	ca, _, srv, _ := setup(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// Gateways are identified by the CN or by a SAN of their certificate
+	gateway := newCert(t, "gateway", []string{"gw1.example.com"}, ca).tlsCert()
+	resp, err := get(srv, roots, &gateway)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 for an allowed gateway, got %d", resp.StatusCode)
+	}
+
+	unknown := newCert(t, "unknown", nil, ca).tlsCert()
+	resp, err = get(srv, roots, &unknown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for an unknown gateway, got %d", resp.StatusCode)
+	}
+
+	// Certificates of other CAs and missing certificates fail the handshake
+	other := newCert(t, "gw1.example.com", nil, newCert(t, "Other CA", nil, nil)).tlsCert()
+	if _, err := get(srv, roots, &other); err == nil {
+		t.Error("expected a handshake error for a certificate of another CA")
+	}
+	if _, err := get(srv, roots, nil); err == nil {
+		t.Error("expected a handshake error without a client certificate")
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	ca, _, srv, _ := setup(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	gateway := newCert(t, "gw1.example.com", nil, ca).tlsCert()
+
+	tlsConfig := &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{gateway}}
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}}
+	resp, err := httpClient.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Errorf("expected a 200 response over HTTP/2, got %d over %s", resp.StatusCode, resp.Proto)
+	}
+
+	// Clients without HTTP/2 are still served
+	resp, err = get(srv, roots, &gateway)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 1 {
+		t.Errorf("expected a 200 response over HTTP/1.1, got %d over %s", resp.StatusCode, resp.Proto)
+	}
+}
+
+func TestCertificateReload(t *testing.T) {
+	ca, config, srv, _ := setup(t)
+	gateway := newCert(t, "gw1.example.com", nil, ca).tlsCert()
+
+	// Rotate the server certificate to one signed by a new CA
+	newCA := newCert(t, "New CA", nil, nil)
+	server := newCert(t, "127.0.0.1", nil, newCA)
+	writeFile(t, config.KeyFile, server.keyPEM(t))
+	writeFile(t, config.CertFile, server.pem)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(newCA.cert)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := get(srv, roots, &gateway)
+		if err == nil && resp.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the new certificate was not served: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestInvalidReloadKeepsCertificate(t *testing.T) {
+	ca, config, srv, reloader := setup(t)
+	gateway := newCert(t, "gw1.example.com", nil, ca).tlsCert()
+
+	writeFile(t, config.CertFile, []byte("not a certificate"))
+	if err := reloader.reload(); err == nil {
+		t.Fatal("expected an error loading an invalid certificate")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	resp, err := get(srv, roots, &gateway)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+	}
+}
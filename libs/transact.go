@@ -0,0 +1,75 @@
+package libs
+
+import (
+	"context"
+	"log"
+	"math/big"
+
+	signer "administrator/ipfs-node/libs/signer"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// sendFunc sends a transaction to a contract with the given options
+type sendFunc func(auth *bind.TransactOpts) (*types.Transaction, error)
+
+// transact sends a transaction of the producer account with the next nonce
+// and waits for it to be confirmed, replacing it while it is stuck. key
+// identifies the transaction: if one was already submitted for key and is
+// still pending, it is waited for instead of sending a duplicate, and
+// resumed is set: the transaction was built by an earlier attempt, not by
+// send. The transaction that was mined is returned, or the latest one sent
+// if none was. After a failure the nonces are read from the node again, so
+// that the nonce of a dropped transaction is reused.
+func transact(ethClient ComponentConfig, key string, send sendFunc) (tx *types.Transaction, receipt *types.Receipt, resumed bool, err error) {
+	ctx := context.Background()
+
+	tx, receipt, resumed, err = ethClient.Confirmer.Resume(ctx, key)
+	if resumed {
+		if err != nil {
+			resyncNonces(ethClient)
+		}
+		return tx, receipt, true, err
+	}
+
+	nonce, err := ethClient.Nonces.Next(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// Prepare authentication parameters
+	auth := signer.NewTransactor(ethClient.Signer, ethClient.ChainID)
+	auth.Nonce = new(big.Int).SetUint64(nonce)
+	auth.Value = big.NewInt(0)
+	sign := auth.Signer
+	err = ethClient.Gas.Apply(ctx, auth)
+	if err != nil {
+		ethClient.Nonces.Release(nonce)
+		return nil, nil, false, err
+	}
+
+	tx, err = send(auth)
+	if err != nil {
+		ethClient.Nonces.Release(nonce)
+		resyncNonces(ethClient)
+		return nil, nil, false, err
+	}
+	ethClient.Nonces.Sent(nonce)
+
+	tx, receipt, err = ethClient.Confirmer.Submit(ctx, key, tx, auth.From, sign)
+	if err != nil {
+		resyncNonces(ethClient)
+		return tx, receipt, false, err
+	}
+
+	return tx, receipt, false, nil
+}
+
+// resyncNonces reads the next nonce of the producer account from the node
+func resyncNonces(ethClient ComponentConfig) {
+	err := ethClient.Nonces.Resync(context.Background())
+	if err != nil {
+		log.Printf("Could not read the nonce of the account from the node: %v\n", err)
+	}
+}
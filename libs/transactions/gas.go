@@ -0,0 +1,193 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Strategies to set the gas limit of the transactions
+const (
+	// LimitFixed uses the configured gas limit
+	LimitFixed = "fixed"
+	// LimitEstimate estimates the gas of every transaction and multiplies it
+	// by the configured multiplier, up to the configured gas limit if set
+	LimitEstimate = "estimate"
+)
+
+// Strategies to set the gas price of the transactions
+const (
+	// PriceFixed uses the configured gas price
+	PriceFixed = "fixed"
+	// PriceOracle uses the gas price suggested by the node
+	PriceOracle = "oracle"
+	// PriceEIP1559 sends dynamic fee transactions (EIP-1559). The maximum
+	// fee is twice the base fee of the latest block plus the priority fee,
+	// so that the transaction stays valid while the base fee rises.
+	PriceEIP1559 = "eip1559"
+)
+
+// ErrNoBaseFee is returned by the eip1559 price strategy when the node does
+// not report the base fee of the blocks
+var ErrNoBaseFee = errors.New("The node does not report the base fee of the blocks (EIP-1559)")
+
+// GasConfig is the configuration of the gas of the transactions. The gas
+// prices and fees are in wei. MaxGasPrice caps the gas price, or the
+// maximum fee of the eip1559 strategy. Its priority fee is PriorityFee or,
+// if 0, the one suggested by the node, capped by MaxPriorityFee. A cap of 0
+// does not cap anything.
+type GasConfig struct {
+	Limit          string  `json:"limit"`
+	GasLimit       uint64  `json:"gasLimit"`
+	Multiplier     float64 `json:"multiplier"`
+	Price          string  `json:"price"`
+	GasPrice       uint64  `json:"gasPrice"`
+	MaxGasPrice    uint64  `json:"maxGasPrice"`
+	PriorityFee    uint64  `json:"priorityFee"`
+	MaxPriorityFee uint64  `json:"maxPriorityFee"`
+}
+
+// GasBackend is the part of the Ethereum client used to price the gas
+type GasBackend interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+}
+
+// GasStrategy sets the gas limit and price of the transactions
+type GasStrategy struct {
+	config  GasConfig
+	backend GasBackend
+}
+
+// NewGasStrategy creates the gas strategy of config
+func NewGasStrategy(config GasConfig, backend GasBackend) *GasStrategy {
+	return &GasStrategy{config: config, backend: backend}
+}
+
+// Apply sets the gas limit and price, or fees, of the options of a
+// transaction
+func (s *GasStrategy) Apply(ctx context.Context, auth *bind.TransactOpts) error {
+	if s.config.Price == PriceEIP1559 {
+		tip, feeCap, err := s.fees(ctx)
+		if err != nil {
+			return err
+		}
+		auth.GasPrice, auth.GasTipCap, auth.GasFeeCap = nil, tip, feeCap
+	} else {
+		price, err := s.gasPrice(ctx)
+		if err != nil {
+			return err
+		}
+		auth.GasPrice, auth.GasTipCap, auth.GasFeeCap = price, nil, nil
+	}
+
+	if s.config.Limit != LimitEstimate {
+		auth.GasLimit = s.config.GasLimit
+		return nil
+	}
+
+	// The contract bindings estimate the gas when the limit is 0. The
+	// estimation is multiplied when the transaction is signed.
+	auth.GasLimit = 0
+	sign := auth.Signer
+	auth.Signer = func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		return sign(address, s.withEstimatedGas(tx))
+	}
+	return nil
+}
+
+// withEstimatedGas returns the transaction with its estimated gas multiplied
+func (s *GasStrategy) withEstimatedGas(tx *types.Transaction) *types.Transaction {
+	gas := uint64(float64(tx.Gas()) * s.config.Multiplier)
+	if s.config.GasLimit > 0 && gas > s.config.GasLimit {
+		gas = s.config.GasLimit
+	}
+
+	return unsignedCopy(tx, gas, tx.GasTipCap(), tx.GasFeeCap())
+}
+
+// unsignedCopy returns an unsigned copy of a transaction with another gas
+// limit and fees. The gas price of a legacy transaction is feeCap.
+func unsignedCopy(tx *types.Transaction, gas uint64, tip, feeCap *big.Int) *types.Transaction {
+	if tx.Type() == types.DynamicFeeTxType {
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      tx.Nonce(),
+			GasTipCap:  tip,
+			GasFeeCap:  feeCap,
+			Gas:        gas,
+			To:         tx.To(),
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    tx.Nonce(),
+		GasPrice: feeCap,
+		Gas:      gas,
+		To:       tx.To(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+	})
+}
+
+// gasPrice returns the price of the gas of the next transaction
+func (s *GasStrategy) gasPrice(ctx context.Context) (*big.Int, error) {
+	var price *big.Int
+	switch s.config.Price {
+	case PriceOracle:
+		suggested, err := s.backend.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		price = suggested
+	default:
+		return new(big.Int).SetUint64(s.config.GasPrice), nil
+	}
+
+	if max := new(big.Int).SetUint64(s.config.MaxGasPrice); max.Sign() > 0 && price.Cmp(max) > 0 {
+		price = max
+	}
+	return price, nil
+}
+
+// fees returns the priority fee and the maximum fee of the next dynamic fee
+// transaction
+func (s *GasStrategy) fees(ctx context.Context) (*big.Int, *big.Int, error) {
+	head, err := s.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if head.BaseFee == nil {
+		return nil, nil, ErrNoBaseFee
+	}
+
+	tip := new(big.Int).SetUint64(s.config.PriorityFee)
+	if tip.Sign() == 0 {
+		tip, err = s.backend.SuggestGasTipCap(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if max := new(big.Int).SetUint64(s.config.MaxPriorityFee); max.Sign() > 0 && tip.Cmp(max) > 0 {
+			tip = max
+		}
+	}
+
+	feeCap := new(big.Int).Mul(head.BaseFee, big.NewInt(2))
+	feeCap.Add(feeCap, tip)
+	if max := new(big.Int).SetUint64(s.config.MaxGasPrice); max.Sign() > 0 && feeCap.Cmp(max) > 0 {
+		feeCap = max
+	}
+
+	// The priority fee cannot be higher than the maximum fee
+	if tip.Cmp(feeCap) > 0 {
+		tip = new(big.Int).Set(feeCap)
+	}
+	return tip, feeCap, nil
+}
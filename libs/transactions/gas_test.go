@@ -0,0 +1,151 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	dataContract "administrator/ipfs-node/contracts/dataContract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeNode suggests fixed gas prices and fees
+type fakeNode struct {
+	gasPrice    int64
+	baseFee     *big.Int
+	priorityFee int64
+}
+
+func (n *fakeNode) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{BaseFee: n.baseFee}, nil
+}
+
+func (n *fakeNode) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(n.gasPrice), nil
+}
+
+func (n *fakeNode) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(n.priorityFee), nil
+}
+
+func TestGasPrice(t *testing.T) {
+	node := &fakeNode{gasPrice: 30}
+	cases := map[string]struct {
+		config GasConfig
+		price  int64
+	}{
+		"fixed":         {GasConfig{Price: PriceFixed, GasPrice: 7}, 7},
+		"oracle":        {GasConfig{Price: PriceOracle}, 30},
+		"oracle capped": {GasConfig{Price: PriceOracle, MaxGasPrice: 20}, 20},
+	}
+
+	for name, c := range cases {
+		c.config.Limit = LimitFixed
+		auth := &bind.TransactOpts{}
+		if err := NewGasStrategy(c.config, node).Apply(context.Background(), auth); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if auth.GasPrice.Int64() != c.price {
+			t.Errorf("%s: expected a gas price of %d, got %s", name, c.price, auth.GasPrice)
+		}
+	}
+}
+
+func TestDynamicFees(t *testing.T) {
+	node := &fakeNode{baseFee: big.NewInt(100), priorityFee: 2}
+	cases := map[string]struct {
+		config      GasConfig
+		tip, feeCap int64
+	}{
+		"suggested tip":  {GasConfig{}, 2, 202},
+		"configured tip": {GasConfig{PriorityFee: 5}, 5, 205},
+		"tip capped":     {GasConfig{MaxPriorityFee: 1}, 1, 201},
+		"max fee capped": {GasConfig{MaxGasPrice: 150}, 2, 150},
+		"both capped":    {GasConfig{PriorityFee: 50, MaxGasPrice: 40}, 40, 40},
+	}
+
+	for name, c := range cases {
+		c.config.Limit = LimitFixed
+		c.config.Price = PriceEIP1559
+		auth := &bind.TransactOpts{GasPrice: big.NewInt(1)}
+		if err := NewGasStrategy(c.config, node).Apply(context.Background(), auth); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if auth.GasPrice != nil || auth.GasTipCap.Int64() != c.tip || auth.GasFeeCap.Int64() != c.feeCap {
+			t.Errorf("%s: expected fees of %d and %d, got %s and %s (gas price %s)", name, c.tip, c.feeCap, auth.GasTipCap, auth.GasFeeCap, auth.GasPrice)
+		}
+	}
+
+	// Networks without EIP-1559
+	node.baseFee = nil
+	err := NewGasStrategy(GasConfig{Price: PriceEIP1559}, node).Apply(context.Background(), &bind.TransactOpts{})
+	if !errors.Is(err, ErrNoBaseFee) {
+		t.Errorf("expected ErrNoBaseFee, got %v", err)
+	}
+}
+
+func TestDynamicFeeTransactions(t *testing.T) {
+	backend, auth := simulated(t)
+
+	// The estimated gas is set on the dynamic fee transaction as well
+	strategy := NewGasStrategy(GasConfig{Limit: LimitEstimate, Multiplier: 1.5, Price: PriceEIP1559, PriorityFee: 1000}, backend)
+	if err := strategy.Apply(context.Background(), auth); err != nil {
+		t.Fatal(err)
+	}
+	_, tx, _, err := dataContract.DeployDataLedgerContract(auth, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Type() != types.DynamicFeeTxType || tx.GasTipCap().Int64() != 1000 || tx.GasFeeCap().Cmp(auth.GasFeeCap) != 0 {
+		t.Fatalf("unexpected transaction of type %d with fees %s and %s", tx.Type(), tx.GasTipCap(), tx.GasFeeCap())
+	}
+	backend.Commit()
+
+	receipt, err := backend.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("the transaction was not mined: %v", err)
+	}
+}
+
+func TestEstimatedGasLimit(t *testing.T) {
+	backend, auth := simulated(t)
+
+	// The estimation of the contract bindings
+	auth.GasLimit = 0
+	_, tx, _, err := dataContract.DeployDataLedgerContract(auth, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	estimated := tx.Gas()
+
+	strategy := NewGasStrategy(GasConfig{Limit: LimitEstimate, Multiplier: 1.5, Price: PriceFixed, GasPrice: 2000000000}, backend)
+	if err := strategy.Apply(context.Background(), auth); err != nil {
+		t.Fatal(err)
+	}
+	_, tx, _, err = dataContract.DeployDataLedgerContract(auth, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := uint64(float64(estimated) * 1.5); tx.Gas() != expected {
+		t.Errorf("expected a gas limit of %d, got %d", expected, tx.Gas())
+	}
+
+	// The configured gas limit caps the estimation
+	backend, auth = simulated(t)
+	strategy = NewGasStrategy(GasConfig{Limit: LimitEstimate, Multiplier: 1.5, GasLimit: estimated, Price: PriceFixed, GasPrice: 2000000000}, backend)
+	if err := strategy.Apply(context.Background(), auth); err != nil {
+		t.Fatal(err)
+	}
+	_, tx, _, err = dataContract.DeployDataLedgerContract(auth, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Gas() != estimated {
+		t.Errorf("expected a gas limit of %d, got %d", estimated, tx.Gas())
+	}
+}
@@ -0,0 +1,121 @@
+package transactions
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NonceSource returns the next nonce of an account known by the node,
+// including its pending transactions
+type NonceSource interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// NonceManager hands out the nonces of an account to concurrent
+// transactions. Every nonce returned by Next must be either marked as sent
+// with Sent or given back with Release.
+type NonceManager struct {
+	source  NonceSource
+	address common.Address
+
+	mu       sync.Mutex
+	synced   bool
+	next     uint64
+	inFlight map[uint64]bool
+	gaps     []uint64
+}
+
+// NewNonceManager creates the nonce manager of the account address. The
+// first nonce is read from the node when it is needed.
+func NewNonceManager(source NonceSource, address common.Address) *NonceManager {
+	return &NonceManager{
+		source:   source,
+		address:  address,
+		inFlight: make(map[uint64]bool),
+	}
+}
+
+// Next returns the nonce of the next transaction. The gaps left by the
+// transactions that were not sent or were dropped are filled first.
+func (m *NonceManager) Next(ctx context.Context) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.synced {
+		if err := m.resync(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	var nonce uint64
+	if len(m.gaps) > 0 {
+		nonce, m.gaps = m.gaps[0], m.gaps[1:]
+	} else {
+		nonce = m.next
+		m.next++
+	}
+	m.inFlight[nonce] = true
+	return nonce, nil
+}
+
+// Sent marks the transaction with the nonce as accepted by the node
+func (m *NonceManager) Sent(nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.inFlight, nonce)
+}
+
+// Release gives back the nonce of a transaction that was not sent, so that
+// it is used by the next one
+func (m *NonceManager) Release(nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.inFlight, nonce)
+	m.addGap(nonce)
+}
+
+// Resync reads the next nonce from the node again. It is called after a
+// transaction fails, since the node may have dropped it or the account may
+// have been used by another client. The nonces between the one of the node
+// and the next one that are not in flight are reused.
+func (m *NonceManager) Resync(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.resync(ctx)
+}
+
+// resync reads the next nonce from the node. m.mu must be held.
+func (m *NonceManager) resync(ctx context.Context) error {
+	pending, err := m.source.PendingNonceAt(ctx, m.address)
+	if err != nil {
+		return err
+	}
+
+	m.gaps = m.gaps[:0]
+	if m.synced && pending < m.next {
+		for nonce := pending; nonce < m.next; nonce++ {
+			if !m.inFlight[nonce] {
+				m.gaps = append(m.gaps, nonce)
+			}
+		}
+	} else {
+		m.next = pending
+	}
+	m.synced = true
+	return nil
+}
+
+// addGap adds a nonce to the sorted list of gaps. m.mu must be held.
+func (m *NonceManager) addGap(nonce uint64) {
+	i := sort.Search(len(m.gaps), func(i int) bool { return m.gaps[i] >= nonce })
+	if i < len(m.gaps) && m.gaps[i] == nonce {
+		return
+	}
+	m.gaps = append(m.gaps, 0)
+	copy(m.gaps[i+1:], m.gaps[i:])
+	m.gaps[i] = nonce
+}
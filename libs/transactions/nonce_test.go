@@ -0,0 +1,117 @@
+package transactions
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fixedNonce is a node whose next nonce is set by the test
+type fixedNonce struct {
+	mu      sync.Mutex
+	pending uint64
+}
+
+func (f *fixedNonce) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pending, nil
+}
+
+func (f *fixedNonce) set(pending uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = pending
+}
+
+// next returns the next nonce or fails the test
+func next(t *testing.T, m *NonceManager) uint64 {
+	nonce, err := m.Next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nonce
+}
+
+func TestConcurrentNonces(t *testing.T) {
+	m := NewNonceManager(&fixedNonce{pending: 7}, common.Address{})
+
+	var mu sync.Mutex
+	seen := make(map[uint64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, err := m.Next(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			m.Sent(nonce)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[nonce] {
+				t.Errorf("nonce %d handed out twice", nonce)
+			}
+			seen[nonce] = true
+		}()
+	}
+	wg.Wait()
+
+	for nonce := uint64(7); nonce < 57; nonce++ {
+		if !seen[nonce] {
+			t.Errorf("nonce %d skipped", nonce)
+		}
+	}
+}
+
+func TestReleasedNoncesAreReused(t *testing.T) {
+	m := NewNonceManager(&fixedNonce{}, common.Address{})
+	for i := 0; i < 3; i++ {
+		next(t, m)
+	}
+
+	m.Release(1)
+	if nonce := next(t, m); nonce != 1 {
+		t.Errorf("expected the released nonce 1, got %d", nonce)
+	}
+	if nonce := next(t, m); nonce != 3 {
+		t.Errorf("expected nonce 3, got %d", nonce)
+	}
+}
+
+func TestResyncFillsGaps(t *testing.T) {
+	source := &fixedNonce{}
+	m := NewNonceManager(source, common.Address{})
+	for i := 0; i < 5; i++ {
+		nonce := next(t, m)
+		if nonce != 3 {
+			m.Sent(nonce)
+		}
+	}
+
+	// The node dropped the transaction with nonce 2; the one with nonce 3
+	// is still being sent
+	source.set(2)
+	if err := m.Resync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []uint64{2, 4, 5} {
+		if nonce := next(t, m); nonce != expected {
+			t.Errorf("expected nonce %d, got %d", expected, nonce)
+		}
+	}
+
+	// Another client used the account
+	source.set(10)
+	if err := m.Resync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if nonce := next(t, m); nonce != 10 {
+		t.Errorf("expected nonce 10, got %d", nonce)
+	}
+}
@@ -0,0 +1,321 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ErrFeeCeiling is returned when the gas price of a stuck transaction cannot
+// be raised because it reached the ceiling
+var ErrFeeCeiling = errors.New("The gas price of the transaction reached the ceiling")
+
+// ErrDropped is returned when the nonce of a submitted transaction was used
+// by another transaction, so none of its versions will be mined
+var ErrDropped = errors.New("The transaction was dropped and its nonce used by another one")
+
+// ReplacementConfig is the configuration of the replacement of the stuck
+// transactions. The transactions not mined After seconds are sent again
+// with the same nonce and a gas price BumpPercent higher, up to MaxGasPrice
+// wei (no ceiling if 0). After 0 disables the replacement.
+type ReplacementConfig struct {
+	After       int    `json:"after"`
+	BumpPercent int    `json:"bumpPercent"`
+	MaxGasPrice uint64 `json:"maxGasPrice"`
+}
+
+// Submission is a submitted transaction that is not confirmed yet. Hashes
+// are the hashes of its versions, the last one being the latest.
+type Submission struct {
+	Key      string        `json:"key"`
+	Nonce    uint64        `json:"nonce"`
+	Hashes   []common.Hash `json:"hashes"`
+	GasPrice *big.Int      `json:"gasPrice"`
+	Sent     time.Time     `json:"sent"`
+}
+
+// submission tracks the versions of a submitted transaction. watched is
+// set while a watcher follows it, guarded by the lock of the confirmer.
+type submission struct {
+	key     string
+	from    common.Address
+	sign    bind.SignerFn
+	sent    time.Time
+	watched bool
+
+	mu  sync.Mutex
+	txs []*types.Transaction
+}
+
+// BumpGasPrice returns the gas price of the replacement of a transaction
+// with the gas price price. ErrFeeCeiling is returned if price already is
+// the ceiling.
+func BumpGasPrice(price *big.Int, percent int, ceiling uint64) (*big.Int, error) {
+	bumped := new(big.Int).Mul(price, big.NewInt(int64(100+percent)))
+	bumped.Div(bumped, big.NewInt(100))
+	if bumped.Cmp(price) <= 0 {
+		bumped.Add(price, big.NewInt(1))
+	}
+
+	if max := new(big.Int).SetUint64(ceiling); ceiling > 0 && bumped.Cmp(max) > 0 {
+		if price.Cmp(max) >= 0 {
+			return nil, ErrFeeCeiling
+		}
+		bumped = max
+	}
+	return bumped, nil
+}
+
+// Submit tracks the transaction sent for key by from and waits until it or
+// one of its replacements is mined and confirmed. The versions of the
+// transaction are signed with sign. The version that was mined is returned.
+// If it is not confirmed in time, the transaction is still tracked and can
+// be waited for with Resume, and it is followed by the watchers if Watch
+// was called.
+func (c *Confirmer) Submit(ctx context.Context, key string, tx *types.Transaction, from common.Address, sign bind.SignerFn) (*types.Transaction, *types.Receipt, error) {
+	s := &submission{key: key, from: from, sign: sign, sent: time.Now(), txs: []*types.Transaction{tx}}
+
+	err := c.persist(s.key, s.from, s.sent, s.txs)
+	if err != nil {
+		log.Printf("Could not persist the transaction %s: %v\n", tx.Hash().Hex(), err)
+	}
+
+	c.mu.Lock()
+	c.submitted[key] = s
+	c.mu.Unlock()
+
+	return c.waitSubmission(ctx, s)
+}
+
+// Resume waits for the transaction submitted for key, if it is still
+// tracked. ok is false if there is no such transaction or it was dropped,
+// so a new one must be sent.
+func (c *Confirmer) Resume(ctx context.Context, key string) (tx *types.Transaction, receipt *types.Receipt, ok bool, err error) {
+	c.mu.Lock()
+	s, ok := c.submitted[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil, nil, false, nil
+	}
+
+	log.Printf("Waiting for the transaction already submitted for %s\n", key)
+	tx, receipt, err = c.waitSubmission(ctx, s)
+	if errors.Is(err, ErrDropped) {
+		return nil, nil, false, nil
+	}
+	return tx, receipt, true, err
+}
+
+// Submitted returns the transactions that are not confirmed yet, sorted by
+// nonce
+func (c *Confirmer) Submitted() []Submission {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	submitted := make([]Submission, 0, len(c.submitted))
+	for _, s := range c.submitted {
+		txs := s.versions()
+		latest := txs[len(txs)-1]
+		hashes := make([]common.Hash, len(txs))
+		for i, tx := range txs {
+			hashes[i] = tx.Hash()
+		}
+		submitted = append(submitted, Submission{
+			Key:      s.key,
+			Nonce:    latest.Nonce(),
+			Hashes:   hashes,
+			GasPrice: latest.GasPrice(),
+			Sent:     s.sent,
+		})
+	}
+	sort.Slice(submitted, func(i, j int) bool { return submitted[i].Nonce < submitted[j].Nonce })
+	return submitted
+}
+
+// waitSubmission waits until a version of the submission is mined and
+// confirmed. If it is not confirmed in time, it is left to the watchers.
+func (c *Confirmer) waitSubmission(ctx context.Context, s *submission) (*types.Transaction, *types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	tx, receipt, err := c.follow(ctx, s)
+	if errors.Is(err, ErrTimeout) {
+		c.watch(s)
+	}
+	return tx, receipt, err
+}
+
+// follow waits until a version of the submission is mined and confirmed,
+// replacing the latest one while it is stuck
+func (c *Confirmer) follow(ctx context.Context, s *submission) (*types.Transaction, *types.Receipt, error) {
+	for {
+		txs := s.versions()
+		latest := txs[len(txs)-1]
+
+		mined, receipt, err := c.waitAnyMined(ctx, s.from, txs)
+		if errors.Is(err, ErrDropped) {
+			c.untrack(s)
+			return nil, nil, fmt.Errorf("%s: %w", latest.Hash().Hex(), err)
+		}
+		if err != nil {
+			return latest, nil, c.waitError(latest, err)
+		}
+
+		// Stuck: send a version with a higher gas price
+		if mined == nil {
+			err := c.replace(ctx, s, len(txs))
+			if err != nil {
+				log.Printf("Could not replace the stuck transaction %s: %v\n", latest.Hash().Hex(), err)
+			}
+			continue
+		}
+
+		if receipt.Status == types.ReceiptStatusFailed {
+			c.untrack(s)
+			return mined, receipt, &RevertError{TxHash: mined.Hash(), Reason: c.revertReason(ctx, mined, receipt)}
+		}
+
+		confirmed, err := c.waitConfirmations(ctx, mined, receipt)
+		if err != nil {
+			return mined, nil, c.waitError(mined, err)
+		}
+		if confirmed {
+			c.untrack(s)
+			return mined, receipt, nil
+		}
+	}
+}
+
+// waitAnyMined waits until one of the versions of a transaction is mined.
+// It returns no transaction if none is mined before the replacement time.
+func (c *Confirmer) waitAnyMined(ctx context.Context, from common.Address, txs []*types.Transaction) (*types.Transaction, *types.Receipt, error) {
+	var stuck <-chan time.Time
+	if c.replacement.After > 0 {
+		timer := time.NewTimer(time.Duration(c.replacement.After) * time.Second)
+		defer timer.Stop()
+		stuck = timer.C
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	nonce := txs[0].Nonce()
+	for {
+		// The nonce is read before the receipts, so a version mined in
+		// between is not taken for a dropped transaction
+		next, err := c.backend.NonceAt(ctx, from, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, tx := range txs {
+			receipt, err := c.backend.TransactionReceipt(ctx, tx.Hash())
+			if err != nil && err != ethereum.NotFound {
+				return nil, nil, err
+			}
+			if receipt != nil {
+				return tx, receipt, nil
+			}
+		}
+
+		if next > nonce {
+			return nil, nil, ErrDropped
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-stuck:
+			return nil, nil, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// replace sends a version of the submission with a higher gas price, unless
+// the version seen by the caller was already replaced
+func (c *Confirmer) replace(ctx context.Context, s *submission, seen int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.txs) != seen {
+		return nil
+	}
+	stuck := s.txs[len(s.txs)-1]
+
+	// The maximum fee of a dynamic fee transaction is raised like the gas
+	// price of a legacy one, and its priority fee as well
+	price, err := BumpGasPrice(stuck.GasFeeCap(), c.replacement.BumpPercent, c.replacement.MaxGasPrice)
+	if err != nil {
+		return err
+	}
+	tip := price
+	if stuck.Type() == types.DynamicFeeTxType {
+		tip, err = BumpGasPrice(stuck.GasTipCap(), c.replacement.BumpPercent, c.replacement.MaxGasPrice)
+		if err != nil {
+			return err
+		}
+		if tip.Cmp(price) > 0 {
+			tip = price
+		}
+	}
+
+	tx, err := s.sign(s.from, unsignedCopy(stuck, stuck.Gas(), tip, price))
+	if err != nil {
+		return err
+	}
+
+	// The replacement is persisted before it is sent, so it is still
+	// watched if the process stops before it is mined
+	err = c.persist(s.key, s.from, s.sent, append(s.txs, tx))
+	if err != nil {
+		return err
+	}
+
+	err = c.backend.SendTransaction(ctx, tx)
+	if err != nil {
+		return err
+	}
+	s.txs = append(s.txs, tx)
+
+	log.Printf("Transaction %s stuck, replaced by %s with a maximum gas price of %s wei\n", stuck.Hash().Hex(), tx.Hash().Hex(), price)
+	return nil
+}
+
+// versions returns the versions of the submission sent so far
+func (s *submission) versions() []*types.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*types.Transaction(nil), s.txs...)
+}
+
+// untrack stops tracking a submission
+func (c *Confirmer) untrack(s *submission) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.submitted[s.key] == s {
+		delete(c.submitted, s.key)
+		if err := c.forget(s.key); err != nil {
+			log.Printf("Could not remove the transaction submitted for %s: %v\n", s.key, err)
+		}
+	}
+}
+
+// txSigner returns the signer of a signed transaction: the latest one of
+// its chain if it is replay protected, Homestead otherwise
+func txSigner(tx *types.Transaction) types.Signer {
+	if tx.Protected() {
+		return types.LatestSignerForChainID(tx.ChainId())
+	}
+	return types.HomesteadSigner{}
+}
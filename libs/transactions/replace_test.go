@@ -0,0 +1,252 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	dataContract "administrator/ipfs-node/contracts/dataContract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// mempool keeps the transactions sent to a simulated chain until the test
+// mines them, so that they can be stuck and replaced
+type mempool struct {
+	*backends.SimulatedBackend
+
+	mu   sync.Mutex
+	sent []*types.Transaction
+}
+
+func (m *mempool) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, tx)
+	return nil
+}
+
+// pending returns the transactions sent so far
+func (m *mempool) pending() []*types.Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*types.Transaction(nil), m.sent...)
+}
+
+// mine mines a transaction in a new block
+func (m *mempool) mine(t *testing.T, tx *types.Transaction) {
+	if err := m.SimulatedBackend.SendTransaction(context.Background(), tx); err != nil {
+		t.Error(err)
+	}
+	m.Commit()
+}
+
+func TestBumpGasPrice(t *testing.T) {
+	cases := map[string]struct {
+		price, ceiling uint64
+		bumped         int64
+	}{
+		"bumped":        {100, 0, 120},
+		"zero price":    {0, 0, 1},
+		"up to ceiling": {100, 110, 110},
+	}
+	for name, c := range cases {
+		bumped, err := BumpGasPrice(new(big.Int).SetUint64(c.price), 20, c.ceiling)
+		if err != nil || bumped.Int64() != c.bumped {
+			t.Errorf("%s: expected %d, got %v (%v)", name, c.bumped, bumped, err)
+		}
+	}
+
+	if _, err := BumpGasPrice(big.NewInt(110), 20, 110); !errors.Is(err, ErrFeeCeiling) {
+		t.Errorf("expected ErrFeeCeiling, got %v", err)
+	}
+}
+
+func TestReplaceStuckTransaction(t *testing.T) {
+	simulated, auth := simulated(t)
+	pool := &mempool{SimulatedBackend: simulated}
+
+	auth.GasPrice = big.NewInt(2000000000)
+	_, tx, _, err := dataContract.DeployDataLedgerContract(auth, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the replacement is mined
+	go func() {
+		for len(pool.pending()) < 2 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		pool.mine(t, pool.pending()[1])
+	}()
+
+	confirmer := NewConfirmer(pool, Config{Timeout: 10, Replacement: ReplacementConfig{After: 1, BumpPercent: 20}})
+	mined, receipt, err := confirmer.Submit(context.Background(), "deploy", tx, auth.From, auth.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mined.Hash() == tx.Hash() || mined.Nonce() != tx.Nonce() || mined.GasPrice().Int64() != 2400000000 {
+		t.Errorf("unexpected mined transaction: nonce %d, gas price %s", mined.Nonce(), mined.GasPrice())
+	}
+	if receipt.TxHash != mined.Hash() {
+		t.Errorf("the receipt is not the one of the mined transaction")
+	}
+	if len(confirmer.Submitted()) != 0 {
+		t.Errorf("the transaction is still tracked: %+v", confirmer.Submitted())
+	}
+}
+
+func TestDroppedTransaction(t *testing.T) {
+	simulated, auth := simulated(t)
+	pool := &mempool{SimulatedBackend: simulated}
+
+	_, tx, _, err := dataContract.DeployDataLedgerContract(auth, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmer := NewConfirmer(pool, Config{Timeout: 1})
+
+	// The transaction is not mined in time but it is still tracked
+	_, _, err = confirmer.Submit(context.Background(), "deploy", tx, auth.From, auth.Signer)
+	if !errors.Is(err, ErrTimeout) || len(confirmer.Submitted()) != 1 {
+		t.Fatalf("expected a tracked transaction after a timeout, got %v", err)
+	}
+
+	// Another transaction with the same nonce is mined
+	other := &bind.TransactOpts{From: auth.From, Signer: auth.Signer, Nonce: new(big.Int).SetUint64(tx.Nonce()), GasLimit: 3000000}
+	_, otherTx, _, err := dataContract.DeployAccessControlContract(other, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.mine(t, otherTx)
+
+	_, _, ok, err := confirmer.Resume(context.Background(), "deploy")
+	if ok || err != nil {
+		t.Errorf("expected a dropped transaction, got %v %v", ok, err)
+	}
+	if len(confirmer.Submitted()) != 0 {
+		t.Errorf("the dropped transaction is still tracked")
+	}
+}
+
+func TestResumeTransactionMinedBeforeRetry(t *testing.T) {
+	simulated, auth := simulated(t)
+	pool := &mempool{SimulatedBackend: simulated}
+
+	_, tx, _, err := dataContract.DeployDataLedgerContract(auth, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmer := NewConfirmer(pool, Config{Timeout: 1})
+
+	// The first attempt gives up before the transaction is mined
+	_, _, err = confirmer.Submit(context.Background(), "store", tx, auth.From, auth.Signer)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	pool.mine(t, tx)
+
+	// The retry gets the transaction of the first attempt instead of
+	// sending its own
+	mined, receipt, ok, err := confirmer.Resume(context.Background(), "store")
+	if !ok || err != nil {
+		t.Fatalf("the transaction of the first attempt was not resumed: %v %v", ok, err)
+	}
+	if mined.Hash() != tx.Hash() || receipt.TxHash != tx.Hash() {
+		t.Errorf("unexpected resumed transaction %s", mined.Hash().Hex())
+	}
+
+	// Once confirmed, it is not resumed again
+	if _, _, ok, _ := confirmer.Resume(context.Background(), "store"); ok {
+		t.Error("a confirmed transaction was resumed")
+	}
+}
+
+func TestReplaceKeepsChainID(t *testing.T) {
+	simulated, auth := simulated(t)
+	pool := &mempool{SimulatedBackend: simulated}
+
+	chainID := big.NewInt(1337)
+	raw := types.NewTransaction(0, common.HexToAddress("0xc0"), big.NewInt(0), 21000, big.NewInt(2000000000), nil)
+	tx, err := auth.Signer(auth.From, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a replacement is mined
+	go func() {
+		for len(pool.pending()) < 2 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		pool.mine(t, pool.pending()[1])
+	}()
+
+	confirmer := NewConfirmer(pool, Config{Timeout: 10, Replacement: ReplacementConfig{After: 1, BumpPercent: 20}})
+	mined, _, err := confirmer.Submit(context.Background(), "transfer", tx, auth.From, auth.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mined.Hash() == tx.Hash() || !mined.Protected() || mined.ChainId().Cmp(chainID) != 0 {
+		t.Errorf("the replacement lost the chain ID: protected %v, chain ID %s", mined.Protected(), mined.ChainId())
+	}
+}
+
+func TestWatchAfterRestart(t *testing.T) {
+	simulated, auth := simulated(t)
+	pool := &mempool{SimulatedBackend: simulated}
+	config := Config{Path: t.TempDir(), Timeout: 1}
+
+	_, tx, _, err := dataContract.DeployDataLedgerContract(auth, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confirmer, err := OpenConfirmer(pool, config, auth.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = confirmer.Submit(context.Background(), "deploy", tx, auth.From, auth.Signer)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if err := confirmer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The submission is recovered and followed until it is mined
+	confirmer, err = OpenConfirmer(pool, config, auth.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer confirmer.Close()
+	if submitted := confirmer.Submitted(); len(submitted) != 1 || submitted[0].Hashes[0] != tx.Hash() {
+		t.Fatalf("the submission was not recovered: %+v", submitted)
+	}
+
+	settled := make(chan *types.Receipt, 1)
+	confirmer.Watch(func(key string, mined *types.Transaction, receipt *types.Receipt, err error) {
+		if key != "deploy" || err != nil {
+			t.Errorf("unexpected settlement of %s: %v", key, err)
+		}
+		settled <- receipt
+	})
+	pool.mine(t, tx)
+
+	select {
+	case receipt := <-settled:
+		if receipt.TxHash != tx.Hash() {
+			t.Errorf("unexpected receipt of %s", receipt.TxHash.Hex())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the submission was not settled")
+	}
+	if len(confirmer.Submitted()) != 0 {
+		t.Errorf("the settled transaction is still tracked")
+	}
+}
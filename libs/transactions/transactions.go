@@ -0,0 +1,205 @@
+// Package transactions manages the transactions sent to the Blockchain. It
+// hands out the nonces of the producer account to concurrent transactions
+// and waits for the transactions to be confirmed. Confirmation is based on
+// the receipts of the transactions instead of polling the state of the
+// contracts.
+package transactions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// ErrTimeout is returned when a transaction is not confirmed in time
+var ErrTimeout = errors.New("The transaction was not confirmed in time")
+
+// pollInterval is the time between the checks of the confirmation depth
+const pollInterval = time.Second
+
+// Config is the configuration of the transactions. Timeout is in seconds.
+// Confirmations is the number of blocks, including the one that mines the
+// transaction, that must be on the chain. The submitted transactions are
+// persisted in the folder Path.
+type Config struct {
+	Path          string            `json:"path"`
+	Timeout       int               `json:"timeout"`
+	Confirmations uint64            `json:"confirmations"`
+	Gas           GasConfig         `json:"gas"`
+	Replacement   ReplacementConfig `json:"replacement"`
+}
+
+// RevertError is returned when a transaction is mined but reverted. Reason
+// is empty if the contract did not give one or it could not be retrieved.
+type RevertError struct {
+	TxHash common.Hash
+	Reason string
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("The transaction %s was reverted", e.TxHash.Hex())
+	}
+	return fmt.Sprintf("The transaction %s was reverted: %s", e.TxHash.Hex(), e.Reason)
+}
+
+// estimateReverts are the messages of the nodes when the gas of a
+// transaction cannot be estimated because it reverts
+var estimateReverts = []string{"execution reverted", "always failing transaction", "gas required exceeds allowance"}
+
+// IsRevert tells whether err reports a reverted transaction: either a
+// *RevertError of a mined transaction or the failed estimation of the gas
+// of a transaction that would revert, which the contract bindings return
+// before sending it
+func IsRevert(err error) bool {
+	var revertErr *RevertError
+	if errors.As(err, &revertErr) {
+		return true
+	}
+	if err == nil {
+		return false
+	}
+	for _, msg := range estimateReverts {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Backend is the part of the Ethereum client used to confirm and replace
+// transactions
+type Backend interface {
+	bind.DeployBackend
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// Confirmer waits for the transactions to be mined and confirmed. It also
+// tracks the submitted transactions and replaces those that are stuck.
+type Confirmer struct {
+	backend       Backend
+	timeout       time.Duration
+	confirmations uint64
+	replacement   ReplacementConfig
+
+	// The submissions are persisted in db, if it is set, and followed by
+	// the watchers until ctx is cancelled
+	db      *leveldb.DB
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	settled SettledFunc
+
+	mu        sync.Mutex
+	submitted map[string]*submission
+}
+
+// NewConfirmer creates a confirmer of the transactions sent to backend. The
+// submissions are only kept in memory.
+func NewConfirmer(backend Backend, config Config) *Confirmer {
+	confirmations := config.Confirmations
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Confirmer{
+		backend:       backend,
+		timeout:       time.Duration(config.Timeout) * time.Second,
+		confirmations: confirmations,
+		replacement:   config.Replacement,
+		ctx:           ctx,
+		cancel:        cancel,
+		submitted:     make(map[string]*submission),
+	}
+}
+
+// waitConfirmations waits until the block of the receipt has enough blocks
+// on top of it. It returns false if the block is no longer in the chain.
+func (c *Confirmer) waitConfirmations(ctx context.Context, tx *types.Transaction, receipt *types.Receipt) (bool, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		head, err := c.backend.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return false, err
+		}
+
+		depth := new(big.Int).Sub(head.Number, receipt.BlockNumber)
+		if depth.Sign() >= 0 && depth.Uint64()+1 >= c.confirmations {
+			current, err := c.backend.TransactionReceipt(ctx, tx.Hash())
+			if err != nil && err != ethereum.NotFound {
+				return false, err
+			}
+			return current != nil && current.BlockHash == receipt.BlockHash, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitError wraps the errors returned while waiting
+func (c *Confirmer) waitError(tx *types.Transaction, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s after %s: %w", tx.Hash().Hex(), c.timeout, ErrTimeout)
+	}
+	return fmt.Errorf("Could not confirm the transaction %s: %w", tx.Hash().Hex(), err)
+}
+
+// revertReason replays the transaction on the state of its block to get the
+// reason of the revert. The reason may be missing if the node does not
+// return it or the state changed since.
+func (c *Confirmer) revertReason(ctx context.Context, tx *types.Transaction, receipt *types.Receipt) string {
+	from, err := types.Sender(txSigner(tx), tx)
+	if err != nil {
+		return ""
+	}
+
+	msg := ethereum.CallMsg{
+		From:     from,
+		To:       tx.To(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+	}
+	_, err = c.backend.CallContract(ctx, msg, receipt.BlockNumber)
+
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return ""
+	}
+	data, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return ""
+	}
+	revert, err := hexutil.Decode(data)
+	if err != nil {
+		return ""
+	}
+	reason, err := abi.UnpackRevert(revert)
+	if err != nil {
+		return ""
+	}
+	return reason
+}
@@ -0,0 +1,134 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	dataContract "administrator/ipfs-node/contracts/dataContract"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// simulated creates a simulated chain with a funded account
+func simulated(t *testing.T) (*backends.SimulatedBackend, *bind.TransactOpts) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth.GasLimit = 3000000
+
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		auth.From: {Balance: new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)},
+	}, 8000000)
+	t.Cleanup(func() { backend.Close() })
+	return backend, auth
+}
+
+func TestConfirmations(t *testing.T) {
+	backend, auth := simulated(t)
+	_, tx, _, err := dataContract.DeployDataLedgerContract(auth, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+
+	// The other confirmations arrive while waiting
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2; i++ {
+			time.Sleep(100 * time.Millisecond)
+			backend.Commit()
+		}
+	}()
+
+	confirmer := NewConfirmer(backend, Config{Timeout: 10, Confirmations: 3})
+	_, receipt, err := confirmer.Submit(context.Background(), "deploy", tx, auth.From, auth.Signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if receipt.TxHash != tx.Hash() {
+		t.Errorf("unexpected receipt %+v", receipt)
+	}
+
+	head, err := backend.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Number.Uint64()-receipt.BlockNumber.Uint64()+1 < 3 {
+		t.Errorf("returned before 3 confirmations: block %d, head %d", receipt.BlockNumber, head.Number)
+	}
+}
+
+func TestRevert(t *testing.T) {
+	backend, auth := simulated(t)
+	_, _, contract, err := dataContract.DeployDataLedgerContract(auth, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+
+	// Only the admin of the contract can set the address
+	tx, err := contract.SetAddress(auth, common.Address{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+
+	_, _, err = NewConfirmer(backend, Config{Timeout: 10}).Submit(context.Background(), "set", tx, auth.From, auth.Signer)
+	var revertErr *RevertError
+	if !errors.As(err, &revertErr) {
+		t.Fatalf("expected a revert error, got %v", err)
+	}
+	if revertErr.TxHash != tx.Hash() || revertErr.Reason != "You do not have privileges to do this action" {
+		t.Errorf("unexpected revert error %+v", revertErr)
+	}
+}
+
+func TestIsRevert(t *testing.T) {
+	backend, auth := simulated(t)
+	_, _, contract, err := dataContract.DeployDataLedgerContract(auth, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.Commit()
+
+	// The estimation of the gas fails because only the admin of the
+	// contract can set the address
+	auth.GasLimit = 0
+	_, err = contract.SetAddress(auth, common.Address{})
+	if !IsRevert(err) {
+		t.Errorf("the failed estimation was not taken for a revert: %v", err)
+	}
+
+	if !IsRevert(&RevertError{}) || IsRevert(errors.New("connection refused")) || IsRevert(nil) {
+		t.Error("unexpected revert")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	backend, auth := simulated(t)
+
+	// The transaction is never mined
+	_, tx, _, err := dataContract.DeployDataLedgerContract(auth, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = NewConfirmer(backend, Config{Timeout: 1}).Submit(context.Background(), "deploy", tx, auth.From, auth.Signer)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package transactions
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// SettledFunc is called when a transaction that was not confirmed in time
+// is settled later. tx and receipt are those of the version that was
+// mined, if any. err is nil if it was confirmed, a *RevertError if it was
+// reverted or wraps ErrDropped if it was dropped.
+type SettledFunc func(key string, tx *types.Transaction, receipt *types.Receipt, err error)
+
+// storedSubmission is a submission persisted in the folder of the confirmer
+type storedSubmission struct {
+	From common.Address       `json:"from"`
+	Sent time.Time            `json:"sent"`
+	Txs  []*types.Transaction `json:"txs"`
+}
+
+// OpenConfirmer creates a confirmer of the transactions sent to backend whose
+// submissions are persisted in the folder config.Path. The submissions
+// found there, sent before a restart, are tracked again; their replacements
+// are signed with sign.
+func OpenConfirmer(backend Backend, config Config, sign bind.SignerFn) (*Confirmer, error) {
+	db, err := leveldb.OpenFile(config.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewConfirmer(backend, config)
+	c.db = db
+
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		stored := storedSubmission{}
+		if err := json.Unmarshal(it.Value(), &stored); err != nil || len(stored.Txs) == 0 {
+			log.Printf("Skipping the corrupted transaction submitted for %s: %v\n", it.Key(), err)
+			continue
+		}
+		key := string(it.Key())
+		c.submitted[key] = &submission{key: key, from: stored.From, sign: sign, sent: stored.Sent, txs: stored.Txs}
+	}
+	if err := it.Error(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if len(c.submitted) > 0 {
+		log.Printf("Recovered %d submitted transactions from %s\n", len(c.submitted), config.Path)
+	}
+	return c, nil
+}
+
+// Watch keeps following the transactions that are not confirmed in time,
+// and those recovered from disk, until they are settled. settled is called
+// for each of them.
+func (c *Confirmer) Watch(settled SettledFunc) {
+	c.mu.Lock()
+	c.settled = settled
+	submitted := make([]*submission, 0, len(c.submitted))
+	for _, s := range c.submitted {
+		submitted = append(submitted, s)
+	}
+	c.mu.Unlock()
+
+	for _, s := range submitted {
+		c.watch(s)
+	}
+}
+
+// watch follows a submission in the background, unless it is already
+// followed or Watch was not called
+func (c *Confirmer) watch(s *submission) {
+	c.mu.Lock()
+	if c.settled == nil || s.watched || c.submitted[s.key] != s || c.ctx.Err() != nil {
+		c.mu.Unlock()
+		return
+	}
+	s.watched = true
+	settled := c.settled
+	c.wg.Add(1)
+	c.mu.Unlock()
+
+	go func() {
+		defer c.wg.Done()
+
+		for {
+			tx, receipt, err := c.follow(c.ctx, s)
+			if c.ctx.Err() != nil {
+				return
+			}
+
+			var revertErr *RevertError
+			if err == nil || errors.Is(err, ErrDropped) || errors.As(err, &revertErr) {
+				c.mu.Lock()
+				s.watched = false
+				c.mu.Unlock()
+
+				settled(s.key, tx, receipt, err)
+				return
+			}
+
+			// The node could not be reached, try again later
+			log.Printf("Could not follow the transaction submitted for %s: %v\n", s.key, err)
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+		}
+	}()
+}
+
+// Close stops the watchers and closes the folder of the submissions. The
+// submissions that are not settled are followed again when the confirmer
+// is opened.
+func (c *Confirmer) Close() error {
+	c.cancel()
+	c.wg.Wait()
+
+	if c.db == nil {
+		return nil
+	}
+	return c.db.Close()
+}
+
+// persist stores the versions of the submission for key
+func (c *Confirmer) persist(key string, from common.Address, sent time.Time, txs []*types.Transaction) error {
+	if c.db == nil {
+		return nil
+	}
+
+	value, err := json.Marshal(storedSubmission{From: from, Sent: sent, Txs: txs})
+	if err != nil {
+		return err
+	}
+	return c.db.Put([]byte(key), value, nil)
+}
+
+// forget removes the submission for key from disk
+func (c *Confirmer) forget(key string) error {
+	if c.db == nil {
+		return nil
+	}
+	return c.db.Delete([]byte(key), nil)
+}
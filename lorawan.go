@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	libs "administrator/ipfs-node/libs"
+	lorawan "administrator/ipfs-node/libs/lorawan"
+	ratelimit "administrator/ipfs-node/libs/ratelimit"
+)
+
+// ChirpStackListener listens to the events of the ChirpStack HTTP
+// integration on /lorawan/chirpstack
+func (myLocalClient localClient) ChirpStackListener(w http.ResponseWriter, req *http.Request) {
+	// ChirpStack posts every kind of event to the same URL
+	if event := req.URL.Query().Get("event"); event != "" && event != "up" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	myLocalClient.uplinkListener(w, req, lorawan.ParseChirpStack)
+}
+
+// TTNListener listens to the uplink messages of The Things Stack webhooks
+// on /lorawan/ttn
+func (myLocalClient localClient) TTNListener(w http.ResponseWriter, req *http.Request) {
+	myLocalClient.uplinkListener(w, req, lorawan.ParseTTN)
+}
+
+// uplinkListener decodes an uplink with the decoder of its device profile
+// and stores the resulting measurement in the ingestion queue
+func (myLocalClient localClient) uplinkListener(w http.ResponseWriter, req *http.Request, parse func([]byte) (*lorawan.Uplink, error)) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	uplink, err := parse(body)
+	if err == lorawan.ErrNotUplink {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	log.Printf("+ Uplink received from device %s\n", uplink.DevEUI)
+
+	// Convert the localClient to libs.ComponentConfig
+	ethClient := libs.ComponentConfig(myLocalClient)
+
+	// The webhooks are signed like the /notify requests. Network servers
+	// that cannot sign them are refused when the signatures are required.
+	provenance, err := verifySensor(ethClient, req, body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	// Decode the payload with the decoder of the device profile
+	measurement, err := ethClient.Config.Get().LoRaWAN.Decode(uplink)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	measurement.Provenance = provenance
+
+	// Check whether the IoT producer has access to the platform
+	err = libs.CheckAccess(ethClient)
+	if err != nil {
+		writeAccessError(w, err)
+		return
+	}
+
+	job, err := enqueueMeasurement(ethClient, measurement)
+	var limitErr *ratelimit.LimitError
+	if errors.As(err, &limitErr) {
+		log.Println(err)
+		writeLimited(w, limitErr)
+		return
+	}
+	if isSensorError(err) {
+		log.Println(err)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(entityResult{
+		ID:     measurement.ID,
+		Status: entityAccepted,
+		JobID:  job.ID,
+		Hash:   "0x" + job.Key,
+	})
+}
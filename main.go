@@ -4,30 +4,127 @@ import (
 	"context"
 	"crypto/elliptic"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/big"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	accessControlContract "administrator/ipfs-node/contracts/accessContract"
 	balanceContract "administrator/ipfs-node/contracts/balanceContract"
 	dataContract "administrator/ipfs-node/contracts/dataContract"
 	libs "administrator/ipfs-node/libs"
+	accesscache "administrator/ipfs-node/libs/accesscache"
+	anchor "administrator/ipfs-node/libs/anchor"
+	coapLib "administrator/ipfs-node/libs/coapLib"
+	config "administrator/ipfs-node/libs/config"
+	ethpool "administrator/ipfs-node/libs/ethpool"
 	ipfsLib "administrator/ipfs-node/libs/ipfsLib"
+	mqttLib "administrator/ipfs-node/libs/mqttLib"
+	ngsi "administrator/ipfs-node/libs/ngsi"
+	queue "administrator/ipfs-node/libs/queue"
+	ratelimit "administrator/ipfs-node/libs/ratelimit"
+	revenue "administrator/ipfs-node/libs/revenue"
+	signer "administrator/ipfs-node/libs/signer"
+	tlsLib "administrator/ipfs-node/libs/tlsLib"
+	transactions "administrator/ipfs-node/libs/transactions"
 
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 	transport "github.com/libp2p/go-libp2p-core/transport"
 	swarm "github.com/libp2p/go-libp2p-swarm"
 
 	"github.com/gorilla/mux"
-	"github.com/mitchellh/mapstructure"
 )
 
 type localClient libs.ComponentConfig
 
+// Possible outcomes of the processing of an entity
+const (
+	entityAccepted  = "accepted"
+	entityStored    = "stored"
+	entityBatched   = "batched"
+	entityDuplicate = "duplicate"
+	entityRejected  = "rejected"
+	entityThrottled = "throttled"
+)
+
+// entityResult reports the outcome of the processing of one of the
+// entities received in a notification or in a batch
+type entityResult struct {
+	ID          string `json:"id,omitempty"`
+	Status      string `json:"status"`
+	JobID       string `json:"jobId,omitempty"`
+	Hash        string `json:"hash,omitempty"`
+	CID         string `json:"cid,omitempty"`
+	TxHash      string `json:"txHash,omitempty"`
+	PriceTxHash string `json:"priceTxHash,omitempty"`
+	Price       int64  `json:"price,omitempty"`
+	PriceRule   string `json:"priceRule,omitempty"`
+	GasUsed     uint64 `json:"gasUsed,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// inputFormat returns the format of the entities of a request. NGSI-LD
+// payloads are sent as application/ld+json. Otherwise, the format set in
+// the inputFormat field of the configuration file is used.
+func inputFormat(ethClient libs.ComponentConfig, req *http.Request) string {
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/ld+json") {
+		return ngsi.FormatNGSILD
+	}
+
+	return configuredInputFormat(ethClient)
+}
+
+// configuredInputFormat returns the format set in the inputFormat field of
+// the configuration file
+func configuredInputFormat(ethClient libs.ComponentConfig) string {
+	return ethClient.Config.Get().InputFormat
+}
+
+// processMeasurement stores a normalized measurement in the platform and
+// reports its outcome. The error is returned if it was rejected.
+func processMeasurement(ethClient libs.ComponentConfig, measurement *ngsi.Measurement) (entityResult, error) {
+	result := entityResult{ID: measurement.ID}
+
+	receipt, err := libs.ProcessMeasurement(ethClient, measurement)
+	if receipt != nil {
+		result.Hash = fmt.Sprintf("0x%x", receipt.Hash)
+		result.CID = receipt.CID
+		if receipt.StoreTx != (common.Hash{}) {
+			result.TxHash = receipt.StoreTx.Hex()
+		}
+		if receipt.PriceTx != (common.Hash{}) {
+			result.PriceTxHash = receipt.PriceTx.Hex()
+		}
+		result.Price = receipt.Price
+		result.PriceRule = receipt.PriceRule
+		result.GasUsed = receipt.GasUsed
+	}
+
+	switch {
+	case err == nil && receipt.Batched:
+		result.Status = entityBatched
+	case err == nil:
+		result.Status = entityStored
+	case errors.Is(err, libs.ErrAlreadyStored):
+		result.Status = entityDuplicate
+	default:
+		log.Println(err)
+		result.Status = entityRejected
+		result.Error = err.Error()
+		return result, err
+	}
+
+	return result, nil
+}
+
 // EventListener listens to new events on /notify and processes them
 func (myLocalClient localClient) EventListener(w http.ResponseWriter, req *http.Request) {
 	// Create a map with body of the message
@@ -35,97 +132,232 @@ func (myLocalClient localClient) EventListener(w http.ResponseWriter, req *http.
 	bodyMap := make(map[string]interface{})
 
 	// Read the body of the message
-	err := json.NewDecoder(req.Body).Decode(&bodyMap)
+	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("+ Measurement received: \n")
-	log.Println(bodyMap)
-
 	// Convert the localClient to libs.ComponentConfig
-	ethClient := libs.ComponentConfig{
-		myLocalClient.EthereumClient,
-		myLocalClient.PrivateKey,
-		myLocalClient.PublicKey,
-		myLocalClient.Address,
-		myLocalClient.DataCon,
-		myLocalClient.AccessCon,
-		myLocalClient.BalanceCon,
-		myLocalClient.IPFSConfig,
-		myLocalClient.GeneralConfig,
+	ethClient := libs.ComponentConfig(myLocalClient)
+
+	// Verify the signature of the sensor before trusting the body
+	provenance, err := verifySensor(ethClient, req, body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	err = json.Unmarshal(body, &bodyMap)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
+	if gateway, ok := requestGateway(req); ok {
+		log.Printf("+ Measurement received from gateway %s: \n", gateway)
+	} else {
+		log.Printf("+ Measurement received: \n")
+	}
+	log.Println(bodyMap)
+
 	// Check whether the IoT producer has access to the platform
 	err = libs.CheckAccess(ethClient)
+	if err != nil {
+		writeAccessError(w, err)
+		return
+	}
+
+	log.Printf("The producer has access to the Blockchain\n\n")
+	format := inputFormat(ethClient, req)
+
+	// Notifications sent by the context broker carry several entities.
+	// Each of them is queued separately and its outcome is reported in
+	// the response.
+	if notification, ok := ngsi.ParseNotification(bodyMap); ok {
+		log.Printf("Queueing %d entities of subscription %s\n", len(notification.Data), notification.SubscriptionID)
+
+		results := make([]entityResult, len(notification.Data))
+		for i, entity := range notification.Data {
+			results[i] = enqueueEntity(ethClient, entity, format, provenance)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(results)
+		return
+	}
+
+	log.Printf("Queueing Measurement\n")
+	measurement, err := ngsi.Normalize(bodyMap, format)
 	if err != nil {
 		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
 
-	log.Printf("The producer has access to the Blockchain\n\n")
-	log.Printf("Processing Measurement\n")
-	err = libs.ProcessMeasurement(ethClient, bodyMap)
+	measurement.Provenance = provenance
+
+	// Store the measurement in the queue. It is processed in background.
+	job, err := enqueueMeasurement(ethClient, measurement)
+	var limitErr *ratelimit.LimitError
+	if errors.As(err, &limitErr) {
+		log.Println(err)
+		writeLimited(w, limitErr)
+		return
+	}
+	if isSensorError(err) {
+		log.Println(err)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(entityResult{
+		ID:     measurement.ID,
+		Status: entityAccepted,
+		JobID:  job.ID,
+		Hash:   "0x" + job.Key,
+	})
+}
+
+// BatchListener listens to arrays of measurements on /notify/batch. Each
+// measurement is queued separately, so one bad item does not make the
+// whole batch fail.
+func (myLocalClient localClient) BatchListener(w http.ResponseWriter, req *http.Request) {
+	// Read the measurements of the batch
+	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		log.Println(err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// Convert the localClient to libs.ComponentConfig
+	ethClient := libs.ComponentConfig(myLocalClient)
+
+	// Verify the signature of the sensor before trusting the body
+	provenance, err := verifySensor(ethClient, req, body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	var batch []interface{}
+	err = json.Unmarshal(body, &batch)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	log.Printf("+ Batch of %d measurements received\n", len(batch))
+
+	// Check whether the IoT producer has access to the platform
+	err = libs.CheckAccess(ethClient)
+	if err != nil {
+		writeAccessError(w, err)
+		return
+	}
+
+	format := inputFormat(ethClient, req)
+	results := make([]entityResult, len(batch))
+	for i, item := range batch {
+		entity, _ := item.(map[string]interface{})
+		results[i] = enqueueEntity(ethClient, entity, format, provenance)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(results)
 }
 
 // Gets configuration parameters
-func initialize() localClient {
-	// Read IPFS configuration file
-	config := libs.ReadConfigFile("config.json")
+func initialize(configPath string) localClient {
+	// Read the configuration file
+	conf, err := config.Load(configPath)
+	if err != nil {
+		fmt.Println(err)
+		panic(err)
+	}
 
 	// Patch to fix swarm error (https://github.com/ipfs/go-ipfs/issues/6468)
 	swarm.DialTimeoutLocal = transport.DialTimeout
 
 	/** Initialize Blockchain link and smart contracts **/
 
-	// Connect to the IPC endpoint of the Ethereum node
-	client, err := ethclient.Dial(config["nodePath"].(string) + "geth.ipc")
+	// Connect to the RPC endpoints of the Ethereum network. The IPC
+	// endpoint of the local node is used if none is configured.
+	ethereumConfig := conf.Ethereum
+	if len(ethereumConfig.Endpoints) == 0 {
+		ethereumConfig.Endpoints = []string{conf.NodePath + "geth.ipc"}
+	}
+	client, err := ethpool.Dial(ethereumConfig)
+	if err != nil {
+		fmt.Println(err)
+		panic(err)
+	}
+
+	// The transactions are signed for the chain of the network
+	chainID, err := client.ChainID(context.Background())
 	if err != nil {
 		fmt.Println(err)
 		panic(err)
 	}
 
-	// Get the private key of the ethereum account
-	privKey, err := libs.GetPrivateKey(config["addr"].(string),
-		config["password"].(string),
-		config["nodePath"].(string)+"keystore/")
+	// Gas limit and price of the transactions
+	gasStrategy := transactions.NewGasStrategy(conf.Transactions.Gas, client)
+
+	// Open the signer that holds the key of the ethereum account
+	txSigner, err := signer.Open(conf.Signer,
+		common.HexToAddress(conf.Addr),
+		conf.NodePath+"keystore/",
+		conf.KeystorePassword)
 	if err != nil {
 		fmt.Println(err)
 		panic(err)
 	}
+	log.Printf("Signing with the %s signer\n", conf.Signer.Type)
 
 	// Initialize the data contract
-	dataContract, err := dataContract.NewDataLedgerContract(common.HexToAddress(config["dataContractAddr"].(string)), client)
+	dataContract, err := dataContract.NewDataLedgerContract(common.HexToAddress(conf.DataContractAddr), client)
 	if err != nil {
 		fmt.Println(err)
 		panic(err)
 	}
 
 	// Initialize the accessControlContract
-	accessContract, err := accessControlContract.NewAccessControlContract(common.HexToAddress(config["accessContractAddr"].(string)), client)
+	accessContract, err := accessControlContract.NewAccessControlContract(common.HexToAddress(conf.AccessContractAddr), client)
 	if err != nil {
 		fmt.Println(err)
 		panic(err)
 	}
 
 	// Store the IoT producer public key in the access smart contract
-	auth := bind.NewKeyedTransactor(privKey)
+	auth := signer.NewTransactor(txSigner, chainID)
 	auth.Value = big.NewInt(0)
-	auth.GasLimit = uint64(400000)
-	auth.GasPrice = big.NewInt(0)
+	err = gasStrategy.Apply(context.Background(), auth)
+	if err != nil {
+		fmt.Println(err)
+		panic(err)
+	}
 
-	publicKeyECDSA := privKey.PublicKey
+	publicKeyECDSA := *txSigner.PublicKey()
 	publicKeyBytes := elliptic.Marshal(publicKeyECDSA.Curve, publicKeyECDSA.X, publicKeyECDSA.Y)
 	publicKeyString := fmt.Sprintf("%x", publicKeyBytes)
 	_, err = accessContract.AddPubKey(auth, publicKeyString)
@@ -134,29 +366,110 @@ func initialize() localClient {
 		panic(err)
 	}
 
+	// Cache the access of the producer and the public key of the
+	// administrator, kept fresh by the events of the access contract
+	accessCache := accesscache.New(accessContract, common.HexToAddress(conf.Addr), conf.Access)
+	err = accessCache.Start()
+	if err != nil {
+		fmt.Println(err)
+		panic(err)
+	}
+
 	// Initialize the balanceContract
-	balanceContract, err := balanceContract.NewBalanceContract(common.HexToAddress(config["balanceContractAddr"].(string)), client)
+	balanceContract, err := balanceContract.NewBalanceContract(common.HexToAddress(conf.BalanceContractAddr), client)
 	if err != nil {
 		fmt.Println(err)
 		panic(err)
 	}
 
-	// Convert the []interface{}  laod on the config file to
-	// an array of strings
-	var auxConfig libs.ConfigIPFS
-	mapstructure.Decode(config, &auxConfig)
+	// Measurements are stored and priced in one transaction if the
+	// deployed contracts support it
+	atomicStore, err := libs.SupportsAtomicStore(client, common.HexToAddress(conf.DataContractAddr), common.HexToAddress(conf.BalanceContractAddr))
+	if err != nil {
+		fmt.Println(err)
+		panic(err)
+	}
+	if !atomicStore {
+		log.Println("The contracts cannot store and price a measurement in one transaction, two transactions are sent. The data contract must dispatch storeInfoWithPrice and know the balance contract through setBalanceAddress")
+	}
+
+	// Settings of the IPFS node
+	auxConfig := libs.ConfigIPFS{
+		IpfsPath:     conf.IpfsPath,
+		IpfsBoostrap: conf.IpfsBoostrap,
+	}
+
+	// Open the durable queue where the measurements wait to be processed
+	ingestionQueue, err := queue.Open(conf.QueuePath, conf.Queue)
+	if err != nil {
+		fmt.Println(err)
+		panic(err)
+	}
+
+	// Load the keys of the sensors that sign their payloads
+	sensorVerifier, err := newSensorVerifier(conf.Sensors)
+	if err != nil {
+		fmt.Println(err)
+		panic(err)
+	}
+
+	// Create the limits of the ingestion
+	sensorLimits, callerLimits := newLimiters(conf.RateLimits)
+
+	// Transactions are confirmed by their receipts. The submitted ones are
+	// persisted, so they are still followed after a restart.
+	confirmer, err := transactions.OpenConfirmer(client, conf.Transactions, signer.NewTransactor(txSigner, chainID).Signer)
+	if err != nil {
+		fmt.Println(err)
+		panic(err)
+	}
+
+	// The nonces of the producer account are shared by the workers
+	nonces := transactions.NewNonceManager(client, common.HexToAddress(conf.Addr))
+
+	// Open the batches of measurements if they are anchored in batches
+	var anchorer *anchor.Anchorer
+	if conf.Anchoring.Enabled {
+		anchorer, err = anchor.Open(conf.Anchoring)
+		if err != nil {
+			fmt.Println(err)
+			panic(err)
+		}
+	}
+
+	// Open the index of the purchases if the revenue is watched
+	var revenueIndex *revenue.Index
+	if conf.Revenue.Enabled {
+		revenueIndex, err = revenue.OpenIndex(conf.Revenue.Path)
+		if err != nil {
+			fmt.Println(err)
+			panic(err)
+		}
+	}
 
 	// Load config in the ComponentConfig
 	myLocalClient := localClient{
 		client,
-		privKey,
+		txSigner,
+		chainID,
 		publicKeyECDSA,
-		common.HexToAddress(config["addr"].(string)),
+		common.HexToAddress(conf.Addr),
 		dataContract,
 		accessContract,
 		balanceContract,
 		auxConfig,
-		config,
+		config.NewStore(configPath, conf),
+		ingestionQueue,
+		sensorVerifier,
+		sensorLimits,
+		callerLimits,
+		confirmer,
+		nonces,
+		gasStrategy,
+		anchorer,
+		atomicStore,
+		accessCache,
+		revenueIndex,
 	}
 
 	/** Start IPFS node **/
@@ -185,27 +498,239 @@ func initialize() localClient {
 // Main function
 func main() {
 
+	// Path of the configuration file
+	configPath := flag.String("config", config.DefaultPath, "path of the configuration file")
+	// Report of the revenue of the purchased measurements
+	revenueReport := flag.Bool("revenue", false, "print the revenue report of the purchased measurements and exit")
+	revenueFrom := flag.String("from", "", "first day (YYYY-MM-DD) of the revenue report")
+	revenueTo := flag.String("to", "", "last day (YYYY-MM-DD) of the revenue report")
+	flag.Parse()
+
+	if *revenueReport {
+		conf, err := config.Load(*configPath)
+		if err == nil {
+			err = printRevenueReport(conf.Revenue.Path, *revenueFrom, *revenueTo)
+		}
+		if err != nil {
+			fmt.Println(err)
+			panic(err)
+		}
+		return
+	}
+
 	// Initialize node configuration
-	myLocalClient := initialize()
+	myLocalClient := initialize(*configPath)
+
+	// main returns when the proxy stops, so that the deferred functions
+	// release the key of the signer and stop the workers and listeners.
+	// It exits with an error afterwards if a server failed.
+	failed := false
+	defer func() {
+		if failed {
+			os.Exit(1)
+		}
+	}()
+	defer myLocalClient.Signer.Close()
 
 	// Start HTTP server to listen to the iot proxy's measurements
 	log.Printf("-- Initializing IoT proxy --")
-	log.Printf("Listening to measurements on port %s\n\n", myLocalClient.GeneralConfig["HTTPport"].(string))
 
 	// Init the route handler
 	r := mux.NewRouter()
 	// Route to process the measurements of the IoT producers
-	r.HandleFunc("/notify", myLocalClient.EventListener).Methods("POST")
+	r.HandleFunc("/notify", myLocalClient.limitCaller(myLocalClient.EventListener)).Methods("POST")
+	// Route to process batches of measurements
+	r.HandleFunc("/notify/batch", myLocalClient.limitCaller(myLocalClient.BatchListener)).Methods("POST")
+	// Routes to process the uplinks of the LoRaWAN network servers
+	r.HandleFunc("/lorawan/chirpstack", myLocalClient.limitCaller(myLocalClient.ChirpStackListener)).Methods("POST")
+	r.HandleFunc("/lorawan/ttn", myLocalClient.limitCaller(myLocalClient.TTNListener)).Methods("POST")
+	// Route to check the state of the queued measurements
+	r.HandleFunc("/jobs/{id}", myLocalClient.JobStatus).Methods("GET")
+	// Route to check the state of a measurement
+	r.HandleFunc("/measurements/{hash}", myLocalClient.MeasurementStatus).Methods("GET")
+	// Route to get the inclusion proof of a measurement anchored in a batch
+	r.HandleFunc("/measurements/{hash}/proof", myLocalClient.MeasurementProof).Methods("GET")
+	// Route to verify an inclusion proof against its anchored root
+	r.HandleFunc("/measurements/verify", myLocalClient.VerifyProof).Methods("POST")
+	// Route to check the usage of the rate limits and quotas
+	r.HandleFunc("/admin/quotas", myLocalClient.requireAdmin(myLocalClient.QuotaUsage)).Methods("GET")
+	// Route to reload the configuration file
+	r.HandleFunc("/admin/reload", myLocalClient.requireAdmin(myLocalClient.ReloadConfig)).Methods("POST")
+	// Route to show which pricing rule would price a payload
+	r.HandleFunc("/admin/pricing/dry-run", myLocalClient.requireAdmin(myLocalClient.PricingDryRun)).Methods("POST")
+	// Route to check the cached access of the producer account
+	r.HandleFunc("/admin/access", myLocalClient.requireAdmin(myLocalClient.AccessStatus)).Methods("GET")
+	// Route to check the state of the Ethereum RPC endpoints
+	r.HandleFunc("/admin/ethereum", myLocalClient.requireAdmin(myLocalClient.EthereumStatus)).Methods("GET")
+	// Route to check the transactions that are not confirmed yet
+	r.HandleFunc("/admin/transactions", myLocalClient.requireAdmin(myLocalClient.SubmittedTransactions)).Methods("GET")
+	// Route to report the revenue of the purchased measurements
+	r.HandleFunc("/admin/revenue", myLocalClient.requireAdmin(myLocalClient.RevenueReport)).Methods("GET")
+
+	// Settings that need a restart are read once
+	conf := myLocalClient.Config.Get()
+
+	// Reload the settings that can be changed live on SIGHUP and when the
+	// configuration file changes
+	go myLocalClient.watchConfig(*configPath)
+
+	// Keep following the transactions that are not confirmed in time, and
+	// update the jobs of their measurements when they are
+	myLocalClient.Confirmer.Watch(myLocalClient.settledTransaction)
+	defer myLocalClient.Confirmer.Close()
+
+	// Pause the workers, leaving the measurements queued, while the account
+	// has no access to the marketplace
+	myLocalClient.Access.Notify(func(allowed bool) {
+		if allowed {
+			myLocalClient.Queue.Resume()
+		} else {
+			myLocalClient.Queue.Pause()
+		}
+	})
+
+	// Start the workers that process the queued measurements. They finish
+	// their jobs before the confirmer is closed.
+	myLocalClient.Queue.Start(conf.QueueWorkers, myLocalClient.processJob)
+	defer myLocalClient.Queue.Stop()
+
+	// Anchor the measurements in batches if it is enabled
+	if myLocalClient.Anchorer != nil {
+		log.Printf("Anchoring the measurements in batches every %d seconds\n", conf.Anchoring.Window)
+		myLocalClient.Anchorer.Start(myLocalClient.anchorBatch)
+		defer myLocalClient.Anchorer.Stop()
+	}
+
+	// Index the purchases of the measurements if the revenue is watched
+	if myLocalClient.Revenue != nil {
+		watcher, err := revenue.NewWatcher(myLocalClient.Revenue,
+			myLocalClient.EthereumClient,
+			myLocalClient.DataCon,
+			common.HexToAddress(conf.BalanceContractAddr),
+			myLocalClient.Address,
+			conf.Revenue)
+		if err != nil {
+			fmt.Println(err)
+			panic(err)
+		}
+		log.Printf("Indexing the purchases of the measurements every %d seconds\n", conf.Revenue.Poll)
+		watcher.Start()
+		defer myLocalClient.Revenue.Close()
+		defer watcher.Stop()
+	}
 
-	// Configure http server
-	srv := &http.Server{
-		Handler:      r,
-		Addr:         ":" + myLocalClient.GeneralConfig["HTTPport"].(string),
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+	// Start the MQTT listener if a broker has been configured
+	mqttConfig := conf.MQTT
+	if mqttConfig.BrokerURL != "" {
+		log.Printf("Listening to measurements on MQTT broker %s\n", mqttConfig.BrokerURL)
+		mqttListener := mqttLib.NewListener(mqttConfig, myLocalClient.acceptMQTTMessage)
+		err := mqttListener.Start()
+		if err != nil {
+			fmt.Println(err)
+			panic(err)
+		}
+		defer mqttListener.Stop()
 	}
 
-	// Start server
-	log.Fatal(srv.ListenAndServe())
+	// Start the CoAP listener if an address has been configured. It has no
+	// DTLS, so only signed measurements are authenticated.
+	coapConfig := conf.CoAP
+	if coapConfig.Addr != "" {
+		log.Printf("Listening to measurements on CoAP address %s\n", coapConfig.Addr)
+		if !conf.Sensors.Required {
+			log.Printf("The CoAP listener has no DTLS and the measurements are not required to be signed: anyone who reaches %s can post them\n", coapConfig.Addr)
+		}
+		coapServer := coapLib.NewServer(myLocalClient.handleCoAP)
+		go func() {
+			log.Println(coapServer.ListenAndServe(coapConfig.Addr))
+		}()
+		defer coapServer.Close()
+	}
+
+	// Start the HTTPS server if a certificate has been configured. When
+	// client certificates are verified, only the allowed gateways can post.
+	var servers []server
+	tlsConfig := conf.TLS
+	httpsPort := conf.HTTPSport
+	if tlsConfig.CertFile != "" && httpsPort != "" {
+		reloader, err := tlsLib.NewReloader(tlsConfig)
+		if err != nil {
+			fmt.Println(err)
+			panic(err)
+		}
+		defer reloader.Close()
+
+		log.Printf("Listening to measurements on TLS port %s\n", httpsPort)
+		tlsSrv := &http.Server{
+			Handler:      requireGateway(reloader, r),
+			Addr:         ":" + httpsPort,
+			TLSConfig:    reloader.TLSConfig(),
+			WriteTimeout: 15 * time.Second,
+			ReadTimeout:  15 * time.Second,
+		}
+		servers = append(servers, server{tlsSrv, func() error {
+			// The certificates are served by the TLS configuration
+			return tlsSrv.ListenAndServeTLS("", "")
+		}})
+	}
+
+	// Configure http server. The routes are not served over plain HTTP
+	// when TLS is configured, unless explicitly allowed.
+	httpPort := conf.HTTPport
+	if httpPort != "" && tlsConfig.CertFile != "" && httpsPort != "" && !tlsConfig.AllowPlainHTTP {
+		log.Printf("The plain HTTP port %s is not served because TLS is configured, set tls.allowPlainHTTP to serve it\n", httpPort)
+		httpPort = ""
+	}
+	if httpPort != "" {
+		log.Printf("Listening to measurements on port %s\n\n", httpPort)
+		srv := &http.Server{
+			Handler:      r,
+			Addr:         ":" + httpPort,
+			WriteTimeout: 15 * time.Second,
+			ReadTimeout:  15 * time.Second,
+		}
+		servers = append(servers, server{srv, srv.ListenAndServe})
+	}
 
+	// Start servers
+	err := serve(servers)
+	if err != nil {
+		log.Println(err)
+		failed = true
+	}
+}
+
+// server is an HTTP server with the function that starts it
+type server struct {
+	*http.Server
+	listen func() error
+}
+
+// serve runs the servers until the process is interrupted or one of them
+// fails, and then shuts them down
+func serve(servers []server) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	failed := make(chan error, len(servers))
+	for _, s := range servers {
+		go func(s server) {
+			failed <- s.listen()
+		}(s)
+	}
+
+	var err error
+	select {
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down\n", sig)
+	case err = <-failed:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	for _, s := range servers {
+		s.Shutdown(ctx)
+	}
+	return err
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+
+	libs "administrator/ipfs-node/libs"
+	anchor "administrator/ipfs-node/libs/anchor"
+	queue "administrator/ipfs-node/libs/queue"
+
+	"github.com/gorilla/mux"
+)
+
+// Processing states of a measurement that are not outcomes of the processing
+const (
+	measurementQueued = "queued"
+	measurementFailed = "failed"
+)
+
+// ledgerRecord is the JSON representation of the ledger record of a
+// measurement
+type ledgerRecord struct {
+	URI         string `json:"uri"`
+	Description string `json:"description"`
+	Addr        string `json:"addr"`
+}
+
+// measurementStatus is returned by GET /measurements/{hash}
+type measurementStatus struct {
+	Hash        string        `json:"hash"`
+	State       string        `json:"state"`
+	JobID       string        `json:"jobId,omitempty"`
+	CID         string        `json:"cid,omitempty"`
+	TxHash      string        `json:"txHash,omitempty"`
+	PriceTxHash string        `json:"priceTxHash,omitempty"`
+	GasUsed     uint64        `json:"gasUsed,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Price       *big.Int      `json:"price"`
+	Ledger      *ledgerRecord `json:"ledger,omitempty"`
+	Anchor      *anchorRecord `json:"anchor,omitempty"`
+}
+
+// anchorRecord is the JSON representation of the batch that anchors a
+// measurement
+type anchorRecord struct {
+	Root        string `json:"root"`
+	ManifestCID string `json:"manifestCid"`
+	TxHash      string `json:"txHash"`
+}
+
+// MeasurementStatus reports the processing state of a measurement, the
+// transactions sent to store it and its current state in the Blockchain
+func (myLocalClient localClient) MeasurementStatus(w http.ResponseWriter, req *http.Request) {
+	hashString := strings.TrimPrefix(strings.ToLower(mux.Vars(req)["hash"]), "0x")
+	hashBytes, err := hex.DecodeString(hashString)
+	if err != nil || len(hashBytes) != 32 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("The hash must be a 32 bytes long hex string"))
+		return
+	}
+	hash := libs.ByteToByte32(hashBytes)
+
+	// Convert the localClient to libs.ComponentConfig
+	ethClient := libs.ComponentConfig(myLocalClient)
+
+	// Read the state of the measurement from the Blockchain
+	onChain, err := libs.GetOnChainMeasurement(ethClient, hash)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	status := measurementStatus{
+		Hash:  "0x" + hashString,
+		Price: onChain.Price,
+	}
+	if onChain.Stored {
+		status.State = entityStored
+		status.Ledger = &ledgerRecord{
+			URI:         onChain.Ledger.URI,
+			Description: onChain.Ledger.Description,
+			Addr:        onChain.Ledger.Addr.Hex(),
+		}
+	}
+
+	// The measurement may have been anchored in a batch
+	anchored := false
+	if myLocalClient.Anchorer != nil {
+		record, state := myLocalClient.Anchorer.Lookup(hash)
+		if state == anchor.StateAnchored {
+			anchored = true
+			status.Anchor = &anchorRecord{
+				Root:        record.Root.Hex(),
+				ManifestCID: record.ManifestCID,
+				TxHash:      record.TxHash.Hex(),
+			}
+		}
+	}
+
+	// Complete the status with the job that processed the measurement
+	job, ok := myLocalClient.Queue.GetByKey(hashString)
+	if !ok && !onChain.Stored && !anchored {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if ok {
+		status.JobID = job.ID
+		switch job.State {
+		case queue.StatePending:
+			status.State = measurementQueued
+		case queue.StateFailed:
+			status.State = measurementFailed
+			status.Error = job.Error
+		}
+
+		var result entityResult
+		if len(job.Result) > 0 && json.Unmarshal(job.Result, &result) == nil {
+			if job.State == queue.StateDone {
+				status.State = result.Status
+			}
+			if anchored && result.Status == entityBatched {
+				status.State = anchor.StateAnchored
+			}
+			status.CID = result.CID
+			status.TxHash = result.TxHash
+			status.PriceTxHash = result.PriceTxHash
+			status.GasUsed = result.GasUsed
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	libs "administrator/ipfs-node/libs"
+	mqttLib "administrator/ipfs-node/libs/mqttLib"
+)
+
+// acceptMQTTMessage stores the measurements published by the gateways in
+// the ingestion queue. The message is acknowledged once this function
+// returns without error.
+func (myLocalClient localClient) acceptMQTTMessage(topic string, payload []byte) error {
+	// Convert the localClient to libs.ComponentConfig
+	ethClient := libs.ComponentConfig(myLocalClient)
+
+	// Signed payloads are sent in an envelope, since MQTT messages have no
+	// headers
+	payload, provenance, err := verifyEnvelope(ethClient, payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", mqttLib.ErrRejected, err)
+	}
+
+	body := make(map[string]interface{})
+	err = json.Unmarshal(payload, &body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", mqttLib.ErrRejected, err)
+	}
+
+	// The gateways are identified by the topic they publish to. Messages
+	// over the limits are kept in the broker and retried later.
+	err = ethClient.CallerLimits.Allow(topic)
+	if err != nil {
+		return err
+	}
+
+	// Check whether the IoT producer has access to the platform. If it has
+	// not, the message is kept in the broker.
+	err = libs.CheckAccess(ethClient)
+	if err != nil {
+		return err
+	}
+
+	err = acceptBody(ethClient, body, configuredInputFormat(ethClient), provenance)
+	if errors.Is(err, errRejected) {
+		return fmt.Errorf("%w: %v", mqttLib.ErrRejected, err)
+	}
+	return err
+}
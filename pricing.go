@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	libs "administrator/ipfs-node/libs"
+	ngsi "administrator/ipfs-node/libs/ngsi"
+	pricing "administrator/ipfs-node/libs/pricing"
+)
+
+// pricedEntity is the price that a measurement would get
+type pricedEntity struct {
+	ID    string `json:"id"`
+	Rule  string `json:"rule,omitempty"`
+	Price int64  `json:"price"`
+	Error string `json:"error,omitempty"`
+}
+
+// PricingDryRun shows which rule would price the entities of a payload, a
+// single entity or a notification of the context broker, without storing
+// them
+func (myLocalClient localClient) PricingDryRun(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	bodyMap := make(map[string]interface{})
+	err = json.Unmarshal(body, &bodyMap)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	ethClient := libs.ComponentConfig(myLocalClient)
+	conf := ethClient.Config.Get()
+	engine, err := pricing.NewEngine(conf.Pricing, conf.PriceMeasurements)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	entities := []map[string]interface{}{bodyMap}
+	if notification, ok := ngsi.ParseNotification(bodyMap); ok {
+		entities = notification.Data
+	}
+
+	format := inputFormat(ethClient, req)
+	results := make([]pricedEntity, len(entities))
+	for i, entity := range entities {
+		measurement, err := ngsi.Normalize(entity, format)
+		if err != nil {
+			results[i].ID, _ = entity["id"].(string)
+			results[i].Error = err.Error()
+			continue
+		}
+		match := engine.Price(measurement)
+		results[i] = pricedEntity{ID: measurement.ID, Rule: match.Rule, Price: match.Price}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
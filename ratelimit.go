@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ratelimit "administrator/ipfs-node/libs/ratelimit"
+)
+
+// newLimiters creates the limiters of the sensors and of the callers
+func newLimiters(limitsConfig ratelimit.Config) (*ratelimit.Limiter, *ratelimit.Limiter) {
+	return ratelimit.NewLimiter(limitsConfig.Sensor), ratelimit.NewLimiter(limitsConfig.Caller)
+}
+
+// callerIdentity identifies the caller of a request: the gateway that
+// authenticated with its client certificate or, otherwise, its IP address
+func callerIdentity(req *http.Request) string {
+	if gateway, ok := requestGateway(req); ok {
+		return gateway
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// writeLimited answers a request that exceeded a limit
+func writeLimited(w http.ResponseWriter, limitErr *ratelimit.LimitError) {
+	w.Header().Set("Retry-After", strconv.Itoa(limitErr.RetryAfterSeconds()))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte(limitErr.Error()))
+}
+
+// limitCaller applies the limits of the callers to an ingestion route
+func (myLocalClient localClient) limitCaller(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var limitErr *ratelimit.LimitError
+		if err := myLocalClient.CallerLimits.Allow(callerIdentity(req)); errors.As(err, &limitErr) {
+			writeLimited(w, limitErr)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// requireAdmin protects the admin routes. If an adminToken is configured, it
+// must be sent as a bearer token. Otherwise, only local requests are served.
+func (myLocalClient localClient) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token := myLocalClient.Config.Get().AdminToken
+		if token != "" {
+			sent := []byte(req.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(sent, []byte("Bearer "+token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		} else if ip := net.ParseIP(callerIdentity(req)); ip == nil || !ip.IsLoopback() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// QuotaUsage returns the current usage of the limits of the sensors and of
+// the callers. The ?key parameter filters the keys by prefix.
+func (myLocalClient localClient) QuotaUsage(w http.ResponseWriter, req *http.Request) {
+	prefix := req.URL.Query().Get("key")
+	filter := func(usage []ratelimit.Usage) []ratelimit.Usage {
+		filtered := usage[:0]
+		for _, u := range usage {
+			if strings.HasPrefix(u.Key, prefix) {
+				filtered = append(filtered, u)
+			}
+		}
+		return filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]ratelimit.Usage{
+		"sensors": filter(myLocalClient.SensorLimits.Usage()),
+		"callers": filter(myLocalClient.CallerLimits.Usage()),
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	ipfsLib "administrator/ipfs-node/libs/ipfsLib"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay groups the events of the configuration file generated by a
+// single save
+const reloadDelay = 500 * time.Millisecond
+
+// reloadResult reports the outcome of a reload of the configuration
+type reloadResult struct {
+	Reloaded        bool     `json:"reloaded"`
+	RestartRequired []string `json:"restartRequired,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// watchConfig reloads the configuration on SIGHUP and when its file changes
+func (myLocalClient localClient) watchConfig(path string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	// The folder is watched, so the file can be replaced by editors
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(filepath.Dir(path))
+	}
+	if err != nil {
+		log.Printf("Could not watch the configuration file, only SIGHUP reloads it: %v\n", err)
+	} else {
+		defer watcher.Close()
+		events = watcher.Events
+		watchErrors = watcher.Errors
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-signals:
+			myLocalClient.reloadConfig()
+		case event := <-events:
+			if filepath.Clean(event.Name) == filepath.Clean(path) && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				pending = time.After(reloadDelay)
+			}
+		case err := <-watchErrors:
+			log.Printf("Error while watching the configuration file: %v\n", err)
+		case <-pending:
+			pending = nil
+			myLocalClient.reloadConfig()
+		}
+	}
+}
+
+// reloadConfig reloads the configuration file and applies the settings that
+// can be changed live: pricing, descriptions, rate limits and bootstrap
+// peers. The other settings are reported and kept until the next restart.
+func (myLocalClient localClient) reloadConfig() reloadResult {
+	previous := myLocalClient.Config.Get()
+	conf, restart, err := myLocalClient.Config.Reload()
+	if err != nil {
+		log.Printf("Could not reload the configuration, keeping the current one: %v\n", err)
+		return reloadResult{Error: err.Error()}
+	}
+
+	myLocalClient.SensorLimits.SetLimit(conf.RateLimits.Sensor)
+	myLocalClient.CallerLimits.SetLimit(conf.RateLimits.Caller)
+
+	if !reflect.DeepEqual(previous.IpfsBoostrap, conf.IpfsBoostrap) {
+		go ipfsLib.ConnectToPeers(context.Background(), myLocalClient.IPFSConfig.IpfsCore, conf.IpfsBoostrap)
+	}
+
+	log.Println("Configuration reloaded")
+	if len(restart) > 0 {
+		log.Printf("These settings changed but need a restart to be applied: %s\n", strings.Join(restart, ", "))
+	}
+	return reloadResult{Reloaded: true, RestartRequired: restart}
+}
+
+// ReloadConfig reloads the configuration file and reports the settings that
+// need a restart
+func (myLocalClient localClient) ReloadConfig(w http.ResponseWriter, req *http.Request) {
+	result := myLocalClient.reloadConfig()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !result.Reloaded {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	revenue "administrator/ipfs-node/libs/revenue"
+)
+
+// dateLayout is the layout of the days that delimit a revenue report
+const dateLayout = "2006-01-02"
+
+// reportPeriod parses the first and the last day (UTC) of a revenue report.
+// Any of them may be empty to leave the period open.
+func reportPeriod(from, to string) (time.Time, time.Time, error) {
+	start := time.Time{}
+	if from != "" {
+		day, err := time.Parse(dateLayout, from)
+		if err != nil {
+			return start, start, fmt.Errorf("The first day of the report must be YYYY-MM-DD: %w", err)
+		}
+		start = day
+	}
+
+	// The last day is included in the report
+	end := time.Now().UTC().AddDate(0, 0, 1)
+	if to != "" {
+		day, err := time.Parse(dateLayout, to)
+		if err != nil {
+			return start, start, fmt.Errorf("The last day of the report must be YYYY-MM-DD: %w", err)
+		}
+		end = day.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// RevenueReport returns the revenue of the measurements of the producer
+// purchased between the days from and to of the query
+func (myLocalClient localClient) RevenueReport(w http.ResponseWriter, req *http.Request) {
+	if myLocalClient.Revenue == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("The revenue watcher is not enabled"))
+		return
+	}
+
+	from, to, err := reportPeriod(req.URL.Query().Get("from"), req.URL.Query().Get("to"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	report, err := myLocalClient.Revenue.Report(from, to)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// printRevenueReport prints the revenue report of the index in path. The
+// index is locked by a running proxy, whose report is served at
+// /admin/revenue.
+func printRevenueReport(path, from, to string) error {
+	start, end, err := reportPeriod(from, to)
+	if err != nil {
+		return err
+	}
+
+	index, err := revenue.OpenIndex(path)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	report, err := index.Report(start, end)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	libs "administrator/ipfs-node/libs"
+	ngsi "administrator/ipfs-node/libs/ngsi"
+	sensors "administrator/ipfs-node/libs/sensors"
+)
+
+// Headers that carry the signature of the sensor that sent a body
+const (
+	sensorIDHeader        = "X-Sensor-Id"
+	sensorTimestampHeader = "X-Sensor-Timestamp"
+	sensorNonceHeader     = "X-Sensor-Nonce"
+	sensorSignatureHeader = "X-Sensor-Signature"
+)
+
+// newSensorVerifier creates the verifier of the sensors' signatures. It
+// returns nil if no registry of sensors has been configured.
+func newSensorVerifier(sensorsConfig sensors.Config) (*sensors.Verifier, error) {
+	if sensorsConfig.RegistryFile == "" {
+		return nil, nil
+	}
+
+	registry, err := sensors.LoadRegistry(sensorsConfig.RegistryFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return sensors.NewVerifier(registry, time.Duration(sensorsConfig.Window)*time.Second), nil
+}
+
+// verifySensor checks the signature of the sensor that sent the body of a
+// request. It returns nil if the body is not signed and the signatures are
+// not required.
+func verifySensor(ethClient libs.ComponentConfig, req *http.Request, body []byte) (*ngsi.Provenance, error) {
+	sensorID := req.Header.Get(sensorIDHeader)
+	if sensorID == "" {
+		if ethClient.Config.Get().Sensors.Required {
+			return nil, fmt.Errorf("%w: the request is not signed", sensors.ErrInvalidSignature)
+		}
+		return nil, nil
+	}
+
+	if ethClient.Sensors == nil {
+		return nil, fmt.Errorf("%w: %s", sensors.ErrUnknownSensor, sensorID)
+	}
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(sensorTimestampHeader), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid timestamp: %v", sensors.ErrInvalidSignature, err)
+	}
+
+	return ethClient.Sensors.Verify(sensorID, timestamp, req.Header.Get(sensorNonceHeader), req.Header.Get(sensorSignatureHeader), body)
+}
+
+// verifyEnvelope checks the signature of a payload received by a transport
+// without headers. Signed payloads are sensors.Envelope, whose body is
+// returned along with its provenance. Unsigned payloads are returned as
+// they are, unless the signatures are required.
+func verifyEnvelope(ethClient libs.ComponentConfig, payload []byte) ([]byte, *ngsi.Provenance, error) {
+	envelope, ok := sensors.ParseEnvelope(payload)
+	if !ok {
+		if ethClient.Config.Get().Sensors.Required {
+			return nil, nil, fmt.Errorf("%w: the payload is not signed", sensors.ErrInvalidSignature)
+		}
+		return payload, nil, nil
+	}
+
+	if ethClient.Sensors == nil {
+		return nil, nil, fmt.Errorf("%w: %s", sensors.ErrUnknownSensor, envelope.SensorID)
+	}
+
+	provenance, err := ethClient.Sensors.Verify(envelope.SensorID, envelope.Timestamp, envelope.Nonce, envelope.Signature, envelope.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return envelope.Body, provenance, nil
+}
+
+// authorizeSensor checks that a measurement was signed by a sensor it is
+// bound to. Unsigned measurements are only accepted if the signatures are
+// not required.
+func authorizeSensor(ethClient libs.ComponentConfig, measurement *ngsi.Measurement) error {
+	if measurement.Provenance == nil {
+		if ethClient.Config.Get().Sensors.Required {
+			return fmt.Errorf("%w: the measurement %s is not signed", sensors.ErrInvalidSignature, measurement.ID)
+		}
+		return nil
+	}
+
+	if ethClient.Sensors == nil {
+		return fmt.Errorf("%w: %s", sensors.ErrUnknownSensor, measurement.Provenance.SensorID)
+	}
+	return ethClient.Sensors.Authorize(measurement.Provenance.SensorID, measurement.ID)
+}
+
+// isSensorError tells whether err was returned because a measurement is not
+// signed by a sensor it is bound to
+func isSensorError(err error) bool {
+	return errors.Is(err, sensors.ErrInvalidSignature) ||
+		errors.Is(err, sensors.ErrUnknownSensor) ||
+		errors.Is(err, sensors.ErrUnboundEntity) ||
+		errors.Is(err, sensors.ErrExpired) ||
+		errors.Is(err, sensors.ErrReplayed)
+}
@@ -0,0 +1,32 @@
+curl 10.10.46.20:5053/notify/batch -s -S --header 'Content-Type: application/json' --header 'Accept: application/json' -X POST -d @- <<EOF
+[
+  {
+    "id":"urn:ngsi-ld:TrafficFlowObserved:santander:traffic:flow:1001",
+    "type":"TrafficFlowObserved",
+    "dateObserved":{
+        "type":"ISO8601",
+        "value":"2020-09-09T11:58:00.00Z",
+        "metadata":{}
+    },
+    "intensity":{
+        "type":"Number",
+        "value":281,
+        "metadata":{}
+    }
+  },
+  {
+    "id":"urn:ngsi-ld:TrafficFlowObserved:santander:traffic:flow:1002",
+    "type":"TrafficFlowObserved",
+    "dateObserved":{
+        "type":"ISO8601",
+        "value":"2020-09-09T11:59:00.00Z",
+        "metadata":{}
+    },
+    "intensity":{
+        "type":"Number",
+        "value":97,
+        "metadata":{}
+    }
+  }
+]
+EOF
\ No newline at end of file
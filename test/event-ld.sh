@@ -0,0 +1,29 @@
+curl 10.10.46.20:5053/notify -s -S --header 'Content-Type: application/ld+json' --header 'Accept: application/json' -X POST -d @- <<EOF
+{
+  "@context":[
+      "https://smartdatamodels.org/context.jsonld"
+  ],
+  "id":"urn:ngsi-ld:TrafficFlowObserved:santander:traffic:flow:1001",
+  "type":"TrafficFlowObserved",
+  "intensity":{
+      "type":"Property",
+      "value":281,
+      "observedAt":"2020-09-09T11:58:00.00Z"
+  },
+  "location":{
+      "type":"GeoProperty",
+      "value":{
+        "type":"Point",
+        "coordinates":[
+            -3.8295937,
+            43.4535859
+        ]
+      }
+  },
+  "occupancy":{
+      "type":"Property",
+      "value":0.08,
+      "observedAt":"2020-09-09T11:58:00.00Z"
+  }
+}
+EOF
\ No newline at end of file
@@ -0,0 +1,8 @@
+curl https://10.10.46.20:8053/notify -s -S --cacert server-ca.crt --cert gateway.crt --key gateway.key --header 'Content-Type: application/json' --header 'Accept: application/json' -X POST -d @- <<EOF
+{
+  "id":"urn:ngsi-ld:TrafficFlowObserved:1001",
+  "type":"TrafficFlowObserved",
+  "dateObserved":"2020-09-09T11:58:00Z",
+  "intensity":281
+}
+EOF
\ No newline at end of file
@@ -0,0 +1,16 @@
+curl 127.0.0.1:5053/admin/pricing/dry-run -s -S --header 'Content-Type: application/json' --header 'Accept: application/json' -X POST -d @- <<EOF
+{
+  "id":"urn:ngsi-ld:TrafficFlowObserved:santander:traffic:flow:1001",
+  "type":"TrafficFlowObserved",
+  "dateObserved":{
+      "type":"ISO8601",
+      "value":"2020-09-09T06:30:00.00Z",
+      "metadata":{}
+  },
+  "intensity":{
+      "type":"Number",
+      "value":281,
+      "metadata":{}
+  }
+}
+EOF
\ No newline at end of file
@@ -0,0 +1,11 @@
+curl 127.0.0.1:5053/measurements/verify -s -S --header 'Content-Type: application/json' --header 'Accept: application/json' -X POST -d @- <<EOF
+{
+  "root":"0x4a1d2cbe4d0d6e7c5fa1d3e0a3b1a4a6e54f5f46b6a8d0f5a3b4c7e2f1d0c9b8",
+  "proof":{
+      "leaf":"0x2f6b1c3a7e9d4f0a5b8c6d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e0f1a",
+      "index":1,
+      "size":2,
+      "siblings":["0x9c2e5b8a1d4f7c0e3b6a9d2f5c8e1b4a7d0f3c6e9b2a5d8f1c4e7b0a3d6f9c2e"]
+  }
+}
+EOF
\ No newline at end of file
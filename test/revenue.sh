@@ -0,0 +1 @@
+curl '127.0.0.1:5053/admin/revenue?from=2020-11-01&to=2020-11-30' -s -S --header 'Accept: application/json' --header "Authorization: Bearer ${ADMIN_TOKEN}"
\ No newline at end of file
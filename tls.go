@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	tlsLib "administrator/ipfs-node/libs/tlsLib"
+)
+
+// gatewayKey is the key of the identity of the gateway in the context of
+// the requests received over HTTPS
+type gatewayKey struct{}
+
+// requireGateway only lets through the requests whose client certificate is
+// mapped to one of the allowed gateways. The identity of the gateway is
+// stored in the context of the request.
+func requireGateway(reloader *tlsLib.Reloader, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !reloader.ClientAuth() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id, ok := reloader.Identity(r.TLS)
+		if !ok {
+			http.Error(w, "The client certificate does not belong to an allowed gateway", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), gatewayKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestGateway returns the identity of the gateway that sent the request,
+// if it was authenticated with a client certificate
+func requestGateway(r *http.Request) (string, bool) {
+	id, ok := r.Context().Value(gatewayKey{}).(string)
+	return id, ok
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// SubmittedTransactions returns the transactions sent to the Blockchain
+// that are not confirmed yet, with the versions sent to replace them
+func (myLocalClient localClient) SubmittedTransactions(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(myLocalClient.Confirmer.Submitted())
+}